@@ -14,6 +14,7 @@ provider "komodo-provider" {
   api_secret     = var.komodo_api_secret
   github_token   = var.github_token
   github_orgname = "ManidaeCloud"
+  git_account    = "oidebrett"
 }
 
 resource "komodo-provider_user" "client_syncresources" {
@@ -0,0 +1,153 @@
+package githost
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// giteaHost talks to the Gitea API (/api/v1), which Forgejo implements as
+// well.
+type giteaHost struct {
+	rest    *restClient
+	baseURL string
+}
+
+func newGitea(cfg Config) (*giteaHost, error) {
+	token := cfg.Token
+	return &giteaHost{
+		rest: &restClient{
+			baseURL:    cfg.BaseURL + "/api/v1",
+			httpClient: cfg.HTTPClient,
+			authorize: func(req *http.Request) {
+				req.Header.Set("Authorization", "token "+token)
+			},
+		},
+		baseURL: cfg.BaseURL,
+	}, nil
+}
+
+type giteaRepository struct {
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+func (r giteaRepository) toRepository() *Repository {
+	defaultBranch := r.DefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+	return &Repository{Owner: r.Owner.Login, Name: r.Name, DefaultBranch: defaultBranch}
+}
+
+func repoPath(owner, repo string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+func (h *giteaHost) CurrentUser(ctx context.Context) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := h.rest.do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
+func (h *giteaHost) Identity(ctx context.Context) (*Identity, error) {
+	login, err := h.CurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Login: login}, nil
+}
+
+func (h *giteaHost) CreateRepository(ctx context.Context, owner, name string, opts CreateRepositoryOptions) (*Repository, error) {
+	path := "/user/repos"
+	if owner != "" {
+		path = "/orgs/" + url.PathEscape(owner) + "/repos"
+	}
+	body := map[string]any{
+		"name":        name,
+		"description": opts.Description,
+		"private":     opts.Private,
+		"auto_init":   opts.AutoInit,
+	}
+	var repo giteaRepository
+	if err := h.rest.do(ctx, http.MethodPost, path, body, &repo); err != nil {
+		return nil, err
+	}
+	return repo.toRepository(), nil
+}
+
+func (h *giteaHost) GetRepository(ctx context.Context, owner, name string) (*Repository, error) {
+	var repo giteaRepository
+	if err := h.rest.do(ctx, http.MethodGet, repoPath(owner, name), nil, &repo); err != nil {
+		return nil, err
+	}
+	return repo.toRepository(), nil
+}
+
+func (h *giteaHost) DeleteRepository(ctx context.Context, owner, name string) error {
+	return h.rest.do(ctx, http.MethodDelete, repoPath(owner, name), nil, nil)
+}
+
+func (h *giteaHost) ArchiveRepository(ctx context.Context, owner, name string) error {
+	body := map[string]any{"archived": true}
+	return h.rest.do(ctx, http.MethodPatch, repoPath(owner, name), body, nil)
+}
+
+func (h *giteaHost) GetFile(ctx context.Context, owner, repo, path, ref string) (*File, error) {
+	endpoint := repoPath(owner, repo) + "/contents/" + path
+	if ref != "" {
+		endpoint += "?ref=" + url.QueryEscape(ref)
+	}
+	var file struct {
+		Content string `json:"content"`
+		SHA     string `json:"sha"`
+	}
+	if err := h.rest.do(ctx, http.MethodGet, endpoint, nil, &file); err != nil {
+		return nil, err
+	}
+	content, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Content: string(content), SHA: file.SHA}, nil
+}
+
+func (h *giteaHost) PutFile(ctx context.Context, owner, repo, path string, opts PutFileOptions) error {
+	body := map[string]any{
+		"message": opts.Message,
+		"content": base64.StdEncoding.EncodeToString([]byte(opts.Content)),
+		"branch":  opts.Branch,
+		"committer": map[string]string{
+			"name":  opts.CommitterName,
+			"email": opts.CommitterEmail,
+		},
+	}
+	// Gitea creates files with POST and replaces them with PUT + sha.
+	method := http.MethodPost
+	if opts.SHA != "" {
+		method = http.MethodPut
+		body["sha"] = opts.SHA
+	}
+	return h.rest.do(ctx, method, repoPath(owner, repo)+"/contents/"+path, body, nil)
+}
+
+func (h *giteaHost) AddDeployKey(ctx context.Context, owner, repo, title, key string, readOnly bool) error {
+	body := map[string]any{
+		"title":     title,
+		"key":       key,
+		"read_only": readOnly,
+	}
+	return h.rest.do(ctx, http.MethodPost, repoPath(owner, repo)+"/keys", body, nil)
+}
+
+func (h *giteaHost) KomodoGitProvider() (string, bool) {
+	return komodoGitProvider(h.baseURL)
+}
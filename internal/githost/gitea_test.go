@@ -0,0 +1,135 @@
+package githost
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func newTestGitea(t *testing.T, routes map[string]testResponse) (Host, *[]recordedRequest) {
+	t.Helper()
+	server, requests := newTestHost(t, routes)
+	host, err := New(Config{Provider: ProviderGitea, BaseURL: server.URL + "/", Token: "tok", HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	return host, requests
+}
+
+func TestGiteaHost(t *testing.T) {
+	repo := `{"name":"app","default_branch":"","owner":{"login":"acme"}}`
+	host, requests := newTestGitea(t, map[string]testResponse{
+		"GET /api/v1/user":                                    {status: http.StatusOK, body: `{"login":"bob"}`},
+		"POST /api/v1/orgs/acme/repos":                        {status: http.StatusCreated, body: repo},
+		"POST /api/v1/user/repos":                             {status: http.StatusCreated, body: `{"name":"app","owner":{"login":"bob"}}`},
+		"GET /api/v1/repos/acme/app/contents/resources.toml":  {status: http.StatusOK, body: `{"content":"W1tzdGFja11dCg==","sha":"abc"}`},
+		"POST /api/v1/repos/acme/app/contents/resources.toml": {status: http.StatusCreated, body: `{}`},
+		"PUT /api/v1/repos/acme/app/contents/resources.toml":  {status: http.StatusOK, body: `{}`},
+		"DELETE /api/v1/repos/acme/app":                       {status: http.StatusNoContent},
+		"PATCH /api/v1/repos/acme/app":                        {status: http.StatusOK, body: repo},
+		"POST /api/v1/repos/acme/app/keys":                    {status: http.StatusCreated, body: `{"id":1}`},
+	})
+	ctx := context.Background()
+
+	identity, err := host.Identity(ctx)
+	if err != nil {
+		t.Fatalf("Identity: %s", err)
+	}
+	if identity.Login != "bob" || identity.Scopes != nil {
+		t.Errorf("Identity() = %+v, want login bob without scopes", identity)
+	}
+
+	got, err := host.CreateRepository(ctx, "acme", "app", CreateRepositoryOptions{Description: "sync", Private: true, AutoInit: true})
+	if err != nil {
+		t.Fatalf("CreateRepository: %s", err)
+	}
+	if want := (&Repository{Owner: "acme", Name: "app", DefaultBranch: "main"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateRepository() = %+v, want %+v", got, want)
+	}
+	if _, err := host.CreateRepository(ctx, "", "app", CreateRepositoryOptions{}); err != nil {
+		t.Fatalf("CreateRepository for the user: %s", err)
+	}
+
+	file, err := host.GetFile(ctx, "acme", "app", "resources.toml", "main")
+	if err != nil {
+		t.Fatalf("GetFile: %s", err)
+	}
+	if file.Content != "[[stack]]\n" || file.SHA != "abc" {
+		t.Errorf("GetFile() = %+v, want the decoded content and sha abc", file)
+	}
+
+	put := PutFileOptions{Message: "Add resources.toml", Content: "[[stack]]\n", Branch: "main", CommitterName: "komodo", CommitterEmail: "komodo@example.com"}
+	if err := host.PutFile(ctx, "acme", "app", "resources.toml", put); err != nil {
+		t.Fatalf("PutFile create: %s", err)
+	}
+	put.SHA = "abc"
+	if err := host.PutFile(ctx, "acme", "app", "resources.toml", put); err != nil {
+		t.Fatalf("PutFile update: %s", err)
+	}
+	if err := host.AddDeployKey(ctx, "acme", "app", "komodo", "ssh-ed25519 AAAA", true); err != nil {
+		t.Fatalf("AddDeployKey: %s", err)
+	}
+	if err := host.ArchiveRepository(ctx, "acme", "app"); err != nil {
+		t.Fatalf("ArchiveRepository: %s", err)
+	}
+	if err := host.DeleteRepository(ctx, "acme", "app"); err != nil {
+		t.Fatalf("DeleteRepository: %s", err)
+	}
+
+	if len(*requests) != 9 {
+		t.Fatalf("got %d requests, want 9", len(*requests))
+	}
+	r := *requests
+	for _, req := range r {
+		if req.Authorization != "token tok" {
+			t.Errorf("%s %s: Authorization = %q, want %q", req.Method, req.Path, req.Authorization, "token tok")
+		}
+	}
+	checkRequest(t, r[0], "GET", "/api/v1/user", nil)
+	checkRequest(t, r[1], "POST", "/api/v1/orgs/acme/repos", map[string]any{"name": "app", "description": "sync", "private": true, "auto_init": true})
+	checkRequest(t, r[2], "POST", "/api/v1/user/repos", map[string]any{"name": "app", "private": false})
+	checkRequest(t, r[3], "GET", "/api/v1/repos/acme/app/contents/resources.toml", nil)
+	if r[3].Query != "ref=main" {
+		t.Errorf("GetFile query = %q, want ref=main", r[3].Query)
+	}
+	committer := map[string]any{"name": "komodo", "email": "komodo@example.com"}
+	checkRequest(t, r[4], "POST", "/api/v1/repos/acme/app/contents/resources.toml", map[string]any{"content": "W1tzdGFja11dCg==", "branch": "main", "message": "Add resources.toml", "committer": committer, "sha": nil})
+	checkRequest(t, r[5], "PUT", "/api/v1/repos/acme/app/contents/resources.toml", map[string]any{"content": "W1tzdGFja11dCg==", "sha": "abc"})
+	checkRequest(t, r[6], "POST", "/api/v1/repos/acme/app/keys", map[string]any{"title": "komodo", "key": "ssh-ed25519 AAAA", "read_only": true})
+	checkRequest(t, r[7], "PATCH", "/api/v1/repos/acme/app", map[string]any{"archived": true})
+	checkRequest(t, r[8], "DELETE", "/api/v1/repos/acme/app", nil)
+}
+
+func TestGiteaHostErrors(t *testing.T) {
+	host, _ := newTestGitea(t, map[string]testResponse{
+		"POST /api/v1/orgs/acme/repos":                       {status: http.StatusConflict, body: `{"message":"repository already exists"}`},
+		"POST /api/v1/repos/acme/app/keys":                   {status: http.StatusUnprocessableEntity, body: `{"message":"key is already in use"}`},
+		"GET /api/v1/repos/acme/app/contents/resources.toml": {status: http.StatusOK, body: `{"content":"not base64!","sha":"abc"}`},
+	})
+	ctx := context.Background()
+
+	if _, err := host.GetRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRepository of a missing repository = %v, want ErrNotFound", err)
+	}
+	if _, err := host.GetFile(ctx, "acme", "missing", "resources.toml", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile of a missing file = %v, want ErrNotFound", err)
+	}
+	if err := host.DeleteRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteRepository of a missing repository = %v, want ErrNotFound", err)
+	}
+	if _, err := host.GetFile(ctx, "acme", "app", "resources.toml", ""); err == nil {
+		t.Error("GetFile with invalid base64 content succeeded")
+	}
+
+	_, err := host.CreateRepository(ctx, "acme", "app", CreateRepositoryOptions{})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict || errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateRepository of an existing repository = %v, want an HTTP 409 error", err)
+	}
+	err = host.AddDeployKey(ctx, "acme", "app", "komodo", "ssh-ed25519 AAAA", true)
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("AddDeployKey of a used key = %v, want an HTTP 422 error", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package githost abstracts the git hosting service that holds the
+// <name>_syncresources repositories read by Komodo resource syncs.
+//
+// GitHub (including GitHub Enterprise Server), Gitea/Forgejo and GitLab are
+// supported. All of them are driven through the same small Host interface so
+// the provider does not care where the repository lives.
+package githost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Supported hosting providers.
+const (
+	ProviderGitHub = "github"
+	ProviderGitea  = "gitea"
+	ProviderGitLab = "gitlab"
+)
+
+// ErrNotFound is returned (possibly wrapped) when a repository or file does
+// not exist.
+var ErrNotFound = errors.New("not found")
+
+// Repository is a repository on the git host.
+type Repository struct {
+	Owner         string
+	Name          string
+	DefaultBranch string
+}
+
+// File is a file read from a repository.
+type File struct {
+	Content string
+	// SHA identifies the current revision of the file. Hosts that need it to
+	// update a file (GitHub, Gitea) require it to be passed back in
+	// PutFileOptions.
+	SHA string
+}
+
+// CreateRepositoryOptions describes a repository to create.
+type CreateRepositoryOptions struct {
+	Description string
+	Private     bool
+	// AutoInit creates an initial commit so the default branch exists.
+	AutoInit bool
+}
+
+// PutFileOptions describes a file to create or update.
+type PutFileOptions struct {
+	Message string
+	Content string
+	Branch  string
+	// SHA of the file being replaced. Empty when creating a new file.
+	SHA            string
+	CommitterName  string
+	CommitterEmail string
+}
+
+// Identity describes the credentials a Host authenticates with.
+type Identity struct {
+	// Login is the authenticated user, or the account a GitHub App is
+	// installed on.
+	Login string
+	// Scopes are the OAuth scopes granted to a classic GitHub token. Nil when
+	// the host does not report scopes (fine-grained tokens, GitHub Apps,
+	// Gitea, GitLab).
+	Scopes []string
+}
+
+// Host is a git hosting service.
+type Host interface {
+	// CurrentUser returns the login of the authenticated account.
+	CurrentUser(ctx context.Context) (string, error)
+	// Identity checks that the credentials are accepted and reports who they
+	// belong to.
+	Identity(ctx context.Context) (*Identity, error)
+
+	// CreateRepository creates a repository under owner, which is an
+	// organization/group, or the authenticated user when empty.
+	CreateRepository(ctx context.Context, owner, name string, opts CreateRepositoryOptions) (*Repository, error)
+	GetRepository(ctx context.Context, owner, name string) (*Repository, error)
+	DeleteRepository(ctx context.Context, owner, name string) error
+	// ArchiveRepository makes a repository read-only while keeping its
+	// contents and history.
+	ArchiveRepository(ctx context.Context, owner, name string) error
+
+	// GetFile reads path at ref (a branch name; empty for the default branch).
+	GetFile(ctx context.Context, owner, repo, path, ref string) (*File, error)
+	// PutFile creates path, or replaces it when opts.SHA is set.
+	PutFile(ctx context.Context, owner, repo, path string, opts PutFileOptions) error
+
+	AddDeployKey(ctx context.Context, owner, repo, title, key string, readOnly bool) error
+
+	// KomodoGitProvider returns the git_provider domain and git_https flag a
+	// Komodo resource sync needs to clone from this host.
+	KomodoGitProvider() (domain string, https bool)
+}
+
+// Config selects and configures a Host.
+type Config struct {
+	// Provider is one of ProviderGitHub (the default), ProviderGitea or
+	// ProviderGitLab.
+	Provider string
+	// BaseURL is the root URL of a self-hosted instance. For GitHub it is the
+	// Enterprise Server URL; empty means github.com. It is required for Gitea
+	// and defaults to gitlab.com for GitLab.
+	BaseURL string
+	Token   string
+	// GitHubApp authenticates as a GitHub App installation instead of with
+	// Token. Only supported for ProviderGitHub.
+	GitHubApp *GitHubApp
+	// HTTPClient is used for all requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// New returns the Host described by cfg.
+func New(cfg Config) (Host, error) {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	if cfg.GitHubApp != nil && cfg.Provider != "" && cfg.Provider != ProviderGitHub {
+		return nil, fmt.Errorf("GitHub App authentication is not supported for %s", cfg.Provider)
+	}
+
+	switch cfg.Provider {
+	case "", ProviderGitHub:
+		return newGitHub(cfg)
+	case ProviderGitea:
+		cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("a base URL is required for %s", ProviderGitea)
+		}
+		return newGitea(cfg)
+	case ProviderGitLab:
+		cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = "https://gitlab.com"
+		}
+		return newGitLab(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported git provider %q", cfg.Provider)
+	}
+}
+
+// komodoGitProvider derives the Komodo git_provider/git_https pair from a
+// host's base URL.
+func komodoGitProvider(baseURL string) (string, bool) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(baseURL, "/"), true
+	}
+	return u.Host, u.Scheme != "http"
+}
@@ -0,0 +1,131 @@
+package githost
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// testResponse is what the test host answers a route with.
+type testResponse struct {
+	status int
+	body   string
+	header http.Header
+}
+
+// recordedRequest is a request as the test host received it.
+type recordedRequest struct {
+	Method string
+	// Path is the escaped path, so GitLab's encoded project paths can be
+	// told apart from nested ones.
+	Path          string
+	Query         string
+	Authorization string
+	PrivateToken  string
+	Body          map[string]any
+}
+
+// newTestHost starts a git host that answers each "METHOD /path" route with
+// its response and everything else with a 404, recording every request.
+func newTestHost(t *testing.T, routes map[string]testResponse) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded := recordedRequest{
+			Method:        r.Method,
+			Path:          r.URL.EscapedPath(),
+			Query:         r.URL.RawQuery,
+			Authorization: r.Header.Get("Authorization"),
+			PrivateToken:  r.Header.Get("PRIVATE-TOKEN"),
+		}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &recorded.Body); err != nil {
+				t.Errorf("decoding %s %s body: %s", r.Method, recorded.Path, err)
+			}
+		}
+		requests = append(requests, recorded)
+
+		resp, ok := routes[r.Method+" "+recorded.Path]
+		if !ok {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		for key, values := range resp.header {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// checkRequest checks that got is a method request for path whose JSON body
+// has at least the fields in body.
+func checkRequest(t *testing.T, got recordedRequest, method, path string, body map[string]any) {
+	t.Helper()
+	if got.Method != method || got.Path != path {
+		t.Errorf("request = %s %s, want %s %s", got.Method, got.Path, method, path)
+		return
+	}
+	for key, want := range body {
+		if !reflect.DeepEqual(got.Body[key], want) {
+			t.Errorf("%s %s: body[%q] = %#v, want %#v", method, path, key, got.Body[key], want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"github default", Config{Token: "tok"}, false},
+		{"github enterprise", Config{Provider: ProviderGitHub, BaseURL: "https://ghe.example.com", Token: "tok"}, false},
+		{"gitea", Config{Provider: ProviderGitea, BaseURL: "https://gitea.example.com/", Token: "tok"}, false},
+		{"gitea without base URL", Config{Provider: ProviderGitea, Token: "tok"}, true},
+		{"gitlab default", Config{Provider: ProviderGitLab, Token: "tok"}, false},
+		{"unknown provider", Config{Provider: "bitbucket", Token: "tok"}, true},
+		{"app on gitea", Config{Provider: ProviderGitea, BaseURL: "https://gitea.example.com", GitHubApp: &GitHubApp{AppID: 1, InstallationID: 2}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("New() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKomodoGitProvider(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		wantDomain string
+		wantHTTPS  bool
+	}{
+		{"github.com", Config{}, "github.com", true},
+		{"github enterprise", Config{BaseURL: "https://ghe.example.com/"}, "ghe.example.com", true},
+		{"gitea over http", Config{Provider: ProviderGitea, BaseURL: "http://gitea.internal:3000/"}, "gitea.internal:3000", false},
+		{"gitlab.com", Config{Provider: ProviderGitLab}, "gitlab.com", true},
+		{"self-hosted gitlab", Config{Provider: ProviderGitLab, BaseURL: "https://git.example.com"}, "git.example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %s", err)
+			}
+			domain, https := host.KomodoGitProvider()
+			if domain != tt.wantDomain || https != tt.wantHTTPS {
+				t.Errorf("KomodoGitProvider() = %q, %t, want %q, %t", domain, https, tt.wantDomain, tt.wantHTTPS)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package githost
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"golang.org/x/oauth2"
+)
+
+type gitHubHost struct {
+	client  *github.Client
+	baseURL string
+	// app is set when authenticating as a GitHub App installation.
+	app *appInstallation
+}
+
+func newGitHub(cfg Config) (*gitHubHost, error) {
+	newClient := func(httpClient *http.Client) (*github.Client, error) {
+		if cfg.BaseURL == "" {
+			return github.NewClient(httpClient), nil
+		}
+		client, err := github.NewEnterpriseClient(cfg.BaseURL, cfg.BaseURL, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub Enterprise base URL: %v", err)
+		}
+		return client, nil
+	}
+
+	var app *appInstallation
+	var ts oauth2.TokenSource
+	if cfg.GitHubApp != nil {
+		var err error
+		app, ts, err = newAppInstallation(cfg.GitHubApp, cfg.HTTPClient.Transport, newClient)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: cfg.Token},
+		)
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, cfg.HTTPClient)
+	client, err := newClient(oauth2.NewClient(ctx, ts))
+	if err != nil {
+		return nil, err
+	}
+
+	return &gitHubHost{client: client, baseURL: cfg.BaseURL, app: app}, nil
+}
+
+// notFound maps a go-github 404 onto ErrNotFound.
+func (h *gitHubHost) notFound(resp *github.Response, err error) error {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
+
+func (h *gitHubHost) CurrentUser(ctx context.Context) (string, error) {
+	if h.app != nil {
+		return h.app.accountLogin(ctx)
+	}
+	user, _, err := h.client.Users.Get(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return user.GetLogin(), nil
+}
+
+func (h *gitHubHost) Identity(ctx context.Context) (*Identity, error) {
+	if h.app != nil {
+		login, err := h.app.accountLogin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Make sure the installation actually hands out tokens.
+		if _, err := h.app.tokens.Token(); err != nil {
+			return nil, err
+		}
+		return &Identity{Login: login}, nil
+	}
+
+	user, resp, err := h.client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{Login: user.GetLogin()}
+	// Only classic tokens report their scopes.
+	if header, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		identity.Scopes = []string{}
+		for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				identity.Scopes = append(identity.Scopes, scope)
+			}
+		}
+	}
+	return identity, nil
+}
+
+func (h *gitHubHost) CreateRepository(ctx context.Context, owner, name string, opts CreateRepositoryOptions) (*Repository, error) {
+	repo, _, err := h.client.Repositories.Create(ctx, owner, &github.Repository{
+		Name:        github.String(name),
+		Description: github.String(opts.Description),
+		Private:     github.Bool(opts.Private),
+		AutoInit:    github.Bool(opts.AutoInit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gitHubRepository(repo), nil
+}
+
+func (h *gitHubHost) GetRepository(ctx context.Context, owner, name string) (*Repository, error) {
+	repo, resp, err := h.client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return nil, h.notFound(resp, err)
+	}
+	return gitHubRepository(repo), nil
+}
+
+func (h *gitHubHost) DeleteRepository(ctx context.Context, owner, name string) error {
+	resp, err := h.client.Repositories.Delete(ctx, owner, name)
+	if err != nil {
+		return h.notFound(resp, err)
+	}
+	return nil
+}
+
+func (h *gitHubHost) ArchiveRepository(ctx context.Context, owner, name string) error {
+	_, resp, err := h.client.Repositories.Edit(ctx, owner, name, &github.Repository{Archived: github.Bool(true)})
+	if err != nil {
+		return h.notFound(resp, err)
+	}
+	return nil
+}
+
+func (h *gitHubHost) GetFile(ctx context.Context, owner, repo, path, ref string) (*File, error) {
+	var opts *github.RepositoryContentGetOptions
+	if ref != "" {
+		opts = &github.RepositoryContentGetOptions{Ref: ref}
+	}
+	fileContent, _, resp, err := h.client.Repositories.GetContents(ctx, owner, repo, path, opts)
+	if err != nil {
+		return nil, h.notFound(resp, err)
+	}
+	if fileContent == nil {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrNotFound, path)
+	}
+	content, err := fileContent.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return &File{Content: content, SHA: fileContent.GetSHA()}, nil
+}
+
+func (h *gitHubHost) PutFile(ctx context.Context, owner, repo, path string, opts PutFileOptions) error {
+	fileOpts := &github.RepositoryContentFileOptions{
+		Message: github.String(opts.Message),
+		Content: []byte(opts.Content),
+		Branch:  github.String(opts.Branch),
+		Committer: &github.CommitAuthor{
+			Name:  github.String(opts.CommitterName),
+			Email: github.String(opts.CommitterEmail),
+		},
+	}
+	if opts.SHA != "" {
+		fileOpts.SHA = github.String(opts.SHA)
+	}
+	_, _, err := h.client.Repositories.CreateFile(ctx, owner, repo, path, fileOpts)
+	return err
+}
+
+func (h *gitHubHost) AddDeployKey(ctx context.Context, owner, repo, title, key string, readOnly bool) error {
+	_, _, err := h.client.Repositories.CreateKey(ctx, owner, repo, &github.Key{
+		Title:    github.String(title),
+		Key:      github.String(key),
+		ReadOnly: github.Bool(readOnly),
+	})
+	return err
+}
+
+func (h *gitHubHost) KomodoGitProvider() (string, bool) {
+	if h.baseURL == "" {
+		return "github.com", true
+	}
+	return komodoGitProvider(h.baseURL)
+}
+
+func gitHubRepository(repo *github.Repository) *Repository {
+	defaultBranch := repo.GetDefaultBranch()
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+	return &Repository{
+		Owner:         repo.GetOwner().GetLogin(),
+		Name:          repo.GetName(),
+		DefaultBranch: defaultBranch,
+	}
+}
@@ -0,0 +1,183 @@
+package githost
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"golang.org/x/oauth2"
+)
+
+// GitHubApp authenticates as a GitHub App installation instead of with a
+// personal access token. Installation tokens are minted on demand and
+// refreshed shortly before they expire (GitHub issues them for one hour).
+type GitHubApp struct {
+	AppID          int64
+	InstallationID int64
+	// PrivateKey is the PEM encoded private key of the app.
+	PrivateKey []byte
+}
+
+// appJWTLifetime is how long the JWT used to request installation tokens is
+// valid. GitHub rejects anything over 10 minutes.
+const appJWTLifetime = 9 * time.Minute
+
+// parseAppPrivateKey parses a PKCS#1 ("RSA PRIVATE KEY", what GitHub
+// generates) or PKCS#8 PEM encoded RSA key.
+func parseAppPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// appJWTTransport signs every request with a fresh app JWT. It is only used
+// for the app-level endpoints that exchange the JWT for installation tokens.
+type appJWTTransport struct {
+	appID int64
+	key   *rsa.PrivateKey
+	base  http.RoundTripper
+}
+
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.signJWT(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// signJWT returns an RS256 JWT identifying the app. iat is backdated a
+// minute to allow for clock drift between us and GitHub.
+func (t *appJWTTransport) signJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(t.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %v", err)
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
+
+// installationTokenSource mints installation access tokens through the
+// app-authenticated client. Wrap it in oauth2.ReuseTokenSource so a token is
+// only requested when the cached one is about to expire.
+type installationTokenSource struct {
+	apps           *github.AppsService
+	installationID int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	// oauth2.TokenSource has no context; bound the request ourselves.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	token, _, err := s.apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub App installation token: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
+
+// appInstallation authenticates a gitHubHost as an app installation.
+type appInstallation struct {
+	apps           *github.AppsService
+	installationID int64
+	tokens         oauth2.TokenSource
+
+	mu    sync.Mutex
+	owner string
+}
+
+// newAppInstallation returns the installation for app together with an
+// auto-refreshing source of installation tokens. newClient builds a
+// go-github client for the configured GitHub (Enterprise) instance.
+func newAppInstallation(app *GitHubApp, base http.RoundTripper, newClient func(*http.Client) (*github.Client, error)) (*appInstallation, oauth2.TokenSource, error) {
+	if app.AppID == 0 || app.InstallationID == 0 {
+		return nil, nil, errors.New("GitHub App ID and installation ID are required")
+	}
+	key, err := parseAppPrivateKey(app.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	appClient, err := newClient(&http.Client{
+		Transport: &appJWTTransport{appID: app.AppID, key: key, base: base},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ts := oauth2.ReuseTokenSource(nil, &installationTokenSource{
+		apps:           appClient.Apps,
+		installationID: app.InstallationID,
+	})
+	installation := &appInstallation{apps: appClient.Apps, installationID: app.InstallationID, tokens: ts}
+	return installation, ts, nil
+}
+
+// accountLogin returns the login of the user or organization the app is
+// installed on. Installation tokens cannot call GET /user, so this stands in
+// for the authenticated user.
+func (i *appInstallation) accountLogin(ctx context.Context) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.owner != "" {
+		return i.owner, nil
+	}
+	installation, _, err := i.apps.GetInstallation(ctx, i.installationID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub App installation: %v", err)
+	}
+	i.owner = installation.GetAccount().GetLogin()
+	return i.owner, nil
+}
@@ -0,0 +1,250 @@
+package githost
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestAppKey returns an RSA key and its PKCS#1 PEM encoding, the format
+// GitHub hands out app keys in.
+func newTestAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// verifyAppJWT checks the header and RS256 signature of token against key
+// and returns its claims.
+func verifyAppJWT(t *testing.T, token string, key *rsa.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT has %d parts, want 3", len(parts))
+	}
+	enc := base64.RawURLEncoding
+	decode := func(part string) []byte {
+		data, err := enc.DecodeString(part)
+		if err != nil {
+			t.Fatalf("decoding JWT part %q: %s", part, err)
+		}
+		return data
+	}
+
+	var header map[string]string
+	if err := json.Unmarshal(decode(parts[0]), &header); err != nil {
+		t.Fatalf("decoding JWT header: %s", err)
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Errorf("JWT header = %v, want RS256 JWT", header)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], decode(parts[2])); err != nil {
+		t.Errorf("JWT signature does not verify: %s", err)
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(decode(parts[1]), &claims); err != nil {
+		t.Fatalf("decoding JWT claims: %s", err)
+	}
+	return claims
+}
+
+func TestAppJWT(t *testing.T) {
+	key, _ := newTestAppKey(t)
+	transport := &appJWTTransport{appID: 12345, key: key}
+	now := time.Unix(1_700_000_000, 0)
+
+	token, err := transport.signJWT(now)
+	if err != nil {
+		t.Fatalf("signJWT: %s", err)
+	}
+	claims := verifyAppJWT(t, token, &key.PublicKey)
+	want := map[string]any{
+		"iat": float64(now.Add(-time.Minute).Unix()),
+		"exp": float64(now.Add(appJWTLifetime).Unix()),
+		"iss": "12345",
+	}
+	if fmt.Sprint(claims) != fmt.Sprint(want) {
+		t.Errorf("JWT claims = %v, want %v", claims, want)
+	}
+
+	other, _ := newTestAppKey(t)
+	parts := strings.Split(token, ".")
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if rsa.VerifyPKCS1v15(&other.PublicKey, crypto.SHA256, digest[:], signature) == nil {
+		t.Error("JWT signature verifies against an unrelated key")
+	}
+}
+
+func TestParseAppPrivateKey(t *testing.T) {
+	key, pkcs1 := newTestAppKey(t)
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling PKCS#8: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating EC key: %s", err)
+	}
+	ecBytes, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("marshalling EC key: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"pkcs1", pkcs1, false},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes}), false},
+		{"ec key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecBytes}), true},
+		{"not pem", []byte("ghp_notakey"), true},
+		{"garbage der", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("garbage")}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAppPrivateKey(tt.data)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("parseAppPrivateKey() error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && !got.Equal(key) {
+				t.Error("parseAppPrivateKey() returned a different key")
+			}
+		})
+	}
+}
+
+func TestGitHubAppInstallation(t *testing.T) {
+	key, keyPEM := newTestAppKey(t)
+
+	// The first token GitHub hands out is about to expire, so the next
+	// request mints another; that one lasts an hour and is reused.
+	var mu sync.Mutex
+	var minted, installationLookups int
+	var usedTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth := r.Header.Get("Authorization")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v3/app/installations/99/access_tokens":
+			claims := verifyAppJWT(t, strings.TrimPrefix(auth, "Bearer "), &key.PublicKey)
+			if claims["iss"] != "12345" {
+				t.Errorf("access token request issuer = %v, want 12345", claims["iss"])
+			}
+			minted++
+			expiry := time.Now().Add(time.Hour)
+			if minted == 1 {
+				expiry = time.Now().Add(5 * time.Second)
+			}
+			fmt.Fprintf(w, `{"token":"ghs_%d","expires_at":%q}`, minted, expiry.UTC().Format(time.RFC3339))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/app/installations/99":
+			verifyAppJWT(t, strings.TrimPrefix(auth, "Bearer "), &key.PublicKey)
+			installationLookups++
+			fmt.Fprint(w, `{"id":99,"account":{"login":"acme"}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/acme/app":
+			usedTokens = append(usedTokens, auth)
+			fmt.Fprint(w, `{"name":"app","default_branch":"main","owner":{"login":"acme"}}`)
+		default:
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, err := New(Config{
+		BaseURL:    server.URL,
+		GitHubApp:  &GitHubApp{AppID: 12345, InstallationID: 99, PrivateKey: keyPEM},
+		HTTPClient: server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := host.GetRepository(ctx, "acme", "app"); err != nil {
+			t.Fatalf("GetRepository: %s", err)
+		}
+	}
+	if want := []string{"token ghs_1", "token ghs_2", "token ghs_2"}; fmt.Sprint(usedTokens) != fmt.Sprint(want) {
+		t.Errorf("requests authenticated with %v, want %v", usedTokens, want)
+	}
+	if minted != 2 {
+		t.Errorf("minted %d installation tokens, want 2", minted)
+	}
+
+	// The installation's account stands in for the authenticated user and
+	// is only looked up once.
+	for i := 0; i < 2; i++ {
+		login, err := host.CurrentUser(ctx)
+		if err != nil {
+			t.Fatalf("CurrentUser: %s", err)
+		}
+		if login != "acme" {
+			t.Errorf("CurrentUser() = %q, want acme", login)
+		}
+	}
+	identity, err := host.Identity(ctx)
+	if err != nil {
+		t.Fatalf("Identity: %s", err)
+	}
+	if identity.Login != "acme" || identity.Scopes != nil {
+		t.Errorf("Identity() = %+v, want login acme without scopes", identity)
+	}
+	if installationLookups != 1 {
+		t.Errorf("looked up the installation %d times, want 1", installationLookups)
+	}
+}
+
+func TestGitHubAppInstallationErrors(t *testing.T) {
+	_, keyPEM := newTestAppKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if _, err := New(Config{GitHubApp: &GitHubApp{InstallationID: 99, PrivateKey: keyPEM}}); err == nil {
+		t.Error("New without an app ID succeeded")
+	}
+	if _, err := New(Config{GitHubApp: &GitHubApp{AppID: 12345, InstallationID: 99, PrivateKey: []byte("not a key")}}); err == nil {
+		t.Error("New with an invalid private key succeeded")
+	}
+
+	host, err := New(Config{
+		BaseURL:    server.URL,
+		GitHubApp:  &GitHubApp{AppID: 12345, InstallationID: 99, PrivateKey: keyPEM},
+		HTTPClient: server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	ctx := context.Background()
+	if _, err := host.GetRepository(ctx, "acme", "app"); err == nil || !strings.Contains(err.Error(), "failed to create GitHub App installation token") {
+		t.Errorf("GetRepository with a rejected app = %v, want an installation token error", err)
+	}
+	if _, err := host.Identity(ctx); err == nil || !strings.Contains(err.Error(), "failed to get GitHub App installation") {
+		t.Errorf("Identity with a rejected app = %v, want an installation error", err)
+	}
+}
@@ -0,0 +1,152 @@
+package githost
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// newTestGitHub returns a GitHub Enterprise host for a test server, which
+// go-github addresses under /api/v3.
+func newTestGitHub(t *testing.T, routes map[string]testResponse) (Host, *[]recordedRequest) {
+	t.Helper()
+	server, requests := newTestHost(t, routes)
+	host, err := New(Config{Provider: ProviderGitHub, BaseURL: server.URL, Token: "tok", HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	return host, requests
+}
+
+func TestGitHubHost(t *testing.T) {
+	repo := `{"name":"app","default_branch":"trunk","owner":{"login":"acme"}}`
+	host, requests := newTestGitHub(t, map[string]testResponse{
+		"GET /api/v3/user": {
+			status: http.StatusOK,
+			body:   `{"login":"bob"}`,
+			header: http.Header{"X-Oauth-Scopes": {"repo, admin:public_key"}},
+		},
+		"POST /api/v3/orgs/acme/repos": {status: http.StatusCreated, body: repo},
+		"POST /api/v3/user/repos":      {status: http.StatusCreated, body: `{"name":"app","owner":{"login":"bob"}}`},
+		"GET /api/v3/repos/acme/app/contents/resources.toml": {
+			status: http.StatusOK,
+			body:   `{"type":"file","encoding":"base64","content":"W1tzdGFja11dCg==","sha":"abc"}`,
+		},
+		"PUT /api/v3/repos/acme/app/contents/resources.toml": {status: http.StatusOK, body: `{"content":{"sha":"def"}}`},
+		"POST /api/v3/repos/acme/app/keys":                   {status: http.StatusCreated, body: `{"id":1}`},
+		"PATCH /api/v3/repos/acme/app":                       {status: http.StatusOK, body: repo},
+		"DELETE /api/v3/repos/acme/app":                      {status: http.StatusNoContent},
+	})
+	ctx := context.Background()
+
+	identity, err := host.Identity(ctx)
+	if err != nil {
+		t.Fatalf("Identity: %s", err)
+	}
+	if want := (&Identity{Login: "bob", Scopes: []string{"repo", "admin:public_key"}}); !reflect.DeepEqual(identity, want) {
+		t.Errorf("Identity() = %+v, want %+v", identity, want)
+	}
+
+	got, err := host.CreateRepository(ctx, "acme", "app", CreateRepositoryOptions{Description: "sync", Private: true, AutoInit: true})
+	if err != nil {
+		t.Fatalf("CreateRepository: %s", err)
+	}
+	if want := (&Repository{Owner: "acme", Name: "app", DefaultBranch: "trunk"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateRepository() = %+v, want %+v", got, want)
+	}
+	got, err = host.CreateRepository(ctx, "", "app", CreateRepositoryOptions{})
+	if err != nil {
+		t.Fatalf("CreateRepository for the user: %s", err)
+	}
+	if got.DefaultBranch != "main" {
+		t.Errorf("default branch of a repository without one = %q, want main", got.DefaultBranch)
+	}
+
+	file, err := host.GetFile(ctx, "acme", "app", "resources.toml", "trunk")
+	if err != nil {
+		t.Fatalf("GetFile: %s", err)
+	}
+	if file.Content != "[[stack]]\n" || file.SHA != "abc" {
+		t.Errorf("GetFile() = %+v, want the decoded content and sha abc", file)
+	}
+
+	put := PutFileOptions{Message: "Update resources.toml", Content: "[[stack]]\n", Branch: "trunk", SHA: "abc", CommitterName: "komodo", CommitterEmail: "komodo@example.com"}
+	if err := host.PutFile(ctx, "acme", "app", "resources.toml", put); err != nil {
+		t.Fatalf("PutFile: %s", err)
+	}
+	if err := host.AddDeployKey(ctx, "acme", "app", "komodo", "ssh-ed25519 AAAA", true); err != nil {
+		t.Fatalf("AddDeployKey: %s", err)
+	}
+	if err := host.ArchiveRepository(ctx, "acme", "app"); err != nil {
+		t.Fatalf("ArchiveRepository: %s", err)
+	}
+	if err := host.DeleteRepository(ctx, "acme", "app"); err != nil {
+		t.Fatalf("DeleteRepository: %s", err)
+	}
+
+	if len(*requests) != 8 {
+		t.Fatalf("got %d requests, want 8", len(*requests))
+	}
+	r := *requests
+	for _, req := range r {
+		if req.Authorization != "Bearer tok" {
+			t.Errorf("%s %s: Authorization = %q, want %q", req.Method, req.Path, req.Authorization, "Bearer tok")
+		}
+	}
+	checkRequest(t, r[0], "GET", "/api/v3/user", nil)
+	checkRequest(t, r[1], "POST", "/api/v3/orgs/acme/repos", map[string]any{"name": "app", "description": "sync", "private": true, "auto_init": true})
+	checkRequest(t, r[2], "POST", "/api/v3/user/repos", map[string]any{"name": "app", "private": false})
+	checkRequest(t, r[3], "GET", "/api/v3/repos/acme/app/contents/resources.toml", nil)
+	if r[3].Query != "ref=trunk" {
+		t.Errorf("GetFile query = %q, want ref=trunk", r[3].Query)
+	}
+	checkRequest(t, r[4], "PUT", "/api/v3/repos/acme/app/contents/resources.toml", map[string]any{
+		"message": "Update resources.toml", "content": "W1tzdGFja11dCg==", "branch": "trunk", "sha": "abc",
+		"committer": map[string]any{"name": "komodo", "email": "komodo@example.com"},
+	})
+	checkRequest(t, r[5], "POST", "/api/v3/repos/acme/app/keys", map[string]any{"title": "komodo", "key": "ssh-ed25519 AAAA", "read_only": true})
+	checkRequest(t, r[6], "PATCH", "/api/v3/repos/acme/app", map[string]any{"archived": true})
+	checkRequest(t, r[7], "DELETE", "/api/v3/repos/acme/app", nil)
+}
+
+func TestGitHubHostErrors(t *testing.T) {
+	host, _ := newTestGitHub(t, map[string]testResponse{
+		"GET /api/v3/user":             {status: http.StatusUnauthorized, body: `{"message":"Bad credentials"}`},
+		"POST /api/v3/orgs/acme/repos": {status: http.StatusUnprocessableEntity, body: `{"message":"Repository creation failed."}`},
+		"GET /api/v3/repos/acme/app/contents/sync": {
+			status: http.StatusOK,
+			body:   `[{"type":"file","name":"resources.toml","path":"sync/resources.toml"}]`,
+		},
+		"POST /api/v3/repos/acme/app/keys": {status: http.StatusUnprocessableEntity, body: `{"message":"key is already in use"}`},
+	})
+	ctx := context.Background()
+
+	if _, err := host.Identity(ctx); err == nil {
+		t.Error("Identity with a rejected token succeeded")
+	}
+	if _, err := host.GetRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRepository of a missing repository = %v, want ErrNotFound", err)
+	}
+	if _, err := host.GetFile(ctx, "acme", "missing", "resources.toml", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile of a missing file = %v, want ErrNotFound", err)
+	}
+	if _, err := host.GetFile(ctx, "acme", "app", "sync", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile of a directory = %v, want ErrNotFound", err)
+	}
+	if err := host.DeleteRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteRepository of a missing repository = %v, want ErrNotFound", err)
+	}
+	if err := host.ArchiveRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ArchiveRepository of a missing repository = %v, want ErrNotFound", err)
+	}
+
+	_, err := host.CreateRepository(ctx, "acme", "app", CreateRepositoryOptions{})
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateRepository of an existing repository = %v, want a non-ErrNotFound error", err)
+	}
+	if err := host.AddDeployKey(ctx, "acme", "app", "komodo", "ssh-ed25519 AAAA", true); err == nil {
+		t.Error("AddDeployKey of a used key succeeded")
+	}
+}
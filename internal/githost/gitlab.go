@@ -0,0 +1,174 @@
+package githost
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// gitLabHost talks to the GitLab REST API (/api/v4). Owners map onto GitLab
+// namespaces (groups or the user's own namespace) and repositories onto
+// projects.
+type gitLabHost struct {
+	rest    *restClient
+	baseURL string
+}
+
+func newGitLab(cfg Config) (*gitLabHost, error) {
+	token := cfg.Token
+	return &gitLabHost{
+		rest: &restClient{
+			baseURL:    cfg.BaseURL + "/api/v4",
+			httpClient: cfg.HTTPClient,
+			authorize: func(req *http.Request) {
+				req.Header.Set("PRIVATE-TOKEN", token)
+			},
+		},
+		baseURL: cfg.BaseURL,
+	}, nil
+}
+
+type gitLabProject struct {
+	ID            int    `json:"id"`
+	Path          string `json:"path"`
+	DefaultBranch string `json:"default_branch"`
+	Namespace     struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+}
+
+func (p gitLabProject) toRepository() *Repository {
+	defaultBranch := p.DefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+	return &Repository{Owner: p.Namespace.FullPath, Name: p.Path, DefaultBranch: defaultBranch}
+}
+
+// projectPath returns the API path of the project owner/name, addressed by
+// its URL-encoded full path.
+func projectPath(owner, name string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+name)
+}
+
+func (h *gitLabHost) CurrentUser(ctx context.Context) (string, error) {
+	var user struct {
+		Username string `json:"username"`
+	}
+	if err := h.rest.do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+func (h *gitLabHost) Identity(ctx context.Context) (*Identity, error) {
+	login, err := h.CurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Login: login}, nil
+}
+
+func (h *gitLabHost) CreateRepository(ctx context.Context, owner, name string, opts CreateRepositoryOptions) (*Repository, error) {
+	visibility := "public"
+	if opts.Private {
+		visibility = "private"
+	}
+	body := map[string]any{
+		"name":                   name,
+		"path":                   name,
+		"description":            opts.Description,
+		"visibility":             visibility,
+		"initialize_with_readme": opts.AutoInit,
+	}
+
+	// Without a namespace_id GitLab creates the project in the user's own
+	// namespace.
+	if owner != "" {
+		var namespace struct {
+			ID int `json:"id"`
+		}
+		if err := h.rest.do(ctx, http.MethodGet, "/namespaces/"+url.PathEscape(owner), nil, &namespace); err != nil {
+			return nil, fmt.Errorf("failed to look up namespace %s: %w", owner, err)
+		}
+		body["namespace_id"] = namespace.ID
+	}
+
+	var project gitLabProject
+	if err := h.rest.do(ctx, http.MethodPost, "/projects", body, &project); err != nil {
+		return nil, err
+	}
+	return project.toRepository(), nil
+}
+
+func (h *gitLabHost) GetRepository(ctx context.Context, owner, name string) (*Repository, error) {
+	var project gitLabProject
+	if err := h.rest.do(ctx, http.MethodGet, projectPath(owner, name), nil, &project); err != nil {
+		return nil, err
+	}
+	return project.toRepository(), nil
+}
+
+func (h *gitLabHost) DeleteRepository(ctx context.Context, owner, name string) error {
+	return h.rest.do(ctx, http.MethodDelete, projectPath(owner, name), nil, nil)
+}
+
+func (h *gitLabHost) ArchiveRepository(ctx context.Context, owner, name string) error {
+	return h.rest.do(ctx, http.MethodPost, projectPath(owner, name)+"/archive", nil, nil)
+}
+
+func (h *gitLabHost) GetFile(ctx context.Context, owner, repo, path, ref string) (*File, error) {
+	if ref == "" {
+		project, err := h.GetRepository(ctx, owner, repo)
+		if err != nil {
+			return nil, err
+		}
+		ref = project.DefaultBranch
+	}
+
+	endpoint := projectPath(owner, repo) + "/repository/files/" + url.PathEscape(path) + "?ref=" + url.QueryEscape(ref)
+	var file struct {
+		Content string `json:"content"`
+		BlobID  string `json:"blob_id"`
+	}
+	if err := h.rest.do(ctx, http.MethodGet, endpoint, nil, &file); err != nil {
+		return nil, err
+	}
+	content, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Content: string(content), SHA: file.BlobID}, nil
+}
+
+func (h *gitLabHost) PutFile(ctx context.Context, owner, repo, path string, opts PutFileOptions) error {
+	body := map[string]any{
+		"branch":         opts.Branch,
+		"content":        opts.Content,
+		"commit_message": opts.Message,
+		"author_name":    opts.CommitterName,
+		"author_email":   opts.CommitterEmail,
+	}
+	// GitLab does not need the previous revision, only whether the file
+	// already exists (PUT) or not (POST).
+	method := http.MethodPost
+	if opts.SHA != "" {
+		method = http.MethodPut
+	}
+	return h.rest.do(ctx, method, projectPath(owner, repo)+"/repository/files/"+url.PathEscape(path), body, nil)
+}
+
+func (h *gitLabHost) AddDeployKey(ctx context.Context, owner, repo, title, key string, readOnly bool) error {
+	body := map[string]any{
+		"title":    title,
+		"key":      key,
+		"can_push": !readOnly,
+	}
+	return h.rest.do(ctx, http.MethodPost, projectPath(owner, repo)+"/deploy_keys", body, nil)
+}
+
+func (h *gitLabHost) KomodoGitProvider() (string, bool) {
+	return komodoGitProvider(h.baseURL)
+}
@@ -0,0 +1,159 @@
+package githost
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestGitLab(t *testing.T, routes map[string]testResponse) (Host, *[]recordedRequest) {
+	t.Helper()
+	server, requests := newTestHost(t, routes)
+	host, err := New(Config{Provider: ProviderGitLab, BaseURL: server.URL, Token: "tok", HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	return host, requests
+}
+
+func TestGitLabHost(t *testing.T) {
+	project := `{"id":7,"path":"app","default_branch":"trunk","namespace":{"full_path":"acme/infra"}}`
+	host, requests := newTestGitLab(t, map[string]testResponse{
+		"GET /api/v4/user":                        {status: http.StatusOK, body: `{"username":"bob"}`},
+		"GET /api/v4/namespaces/acme%2Finfra":     {status: http.StatusOK, body: `{"id":42}`},
+		"POST /api/v4/projects":                   {status: http.StatusCreated, body: project},
+		"GET /api/v4/projects/acme%2Finfra%2Fapp": {status: http.StatusOK, body: project},
+		"GET /api/v4/projects/acme%2Finfra%2Fapp/repository/files/sync%2Fresources.toml":  {status: http.StatusOK, body: `{"content":"W1tzdGFja11dCg==","blob_id":"abc"}`},
+		"POST /api/v4/projects/acme%2Finfra%2Fapp/repository/files/sync%2Fresources.toml": {status: http.StatusCreated, body: `{}`},
+		"PUT /api/v4/projects/acme%2Finfra%2Fapp/repository/files/sync%2Fresources.toml":  {status: http.StatusOK, body: `{}`},
+		"POST /api/v4/projects/acme%2Finfra%2Fapp/deploy_keys":                            {status: http.StatusCreated, body: `{"id":1}`},
+		"POST /api/v4/projects/acme%2Finfra%2Fapp/archive":                                {status: http.StatusCreated, body: project},
+		"DELETE /api/v4/projects/acme%2Finfra%2Fapp":                                      {status: http.StatusAccepted, body: `{"message":"202 Accepted"}`},
+	})
+	ctx := context.Background()
+
+	identity, err := host.Identity(ctx)
+	if err != nil {
+		t.Fatalf("Identity: %s", err)
+	}
+	if identity.Login != "bob" {
+		t.Errorf("Identity() login = %q, want bob", identity.Login)
+	}
+
+	got, err := host.CreateRepository(ctx, "acme/infra", "app", CreateRepositoryOptions{Description: "sync", Private: true, AutoInit: true})
+	if err != nil {
+		t.Fatalf("CreateRepository: %s", err)
+	}
+	if want := (&Repository{Owner: "acme/infra", Name: "app", DefaultBranch: "trunk"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateRepository() = %+v, want %+v", got, want)
+	}
+	if _, err := host.CreateRepository(ctx, "", "app", CreateRepositoryOptions{}); err != nil {
+		t.Fatalf("CreateRepository for the user: %s", err)
+	}
+
+	// Without a ref, the file is read from the project's default branch.
+	file, err := host.GetFile(ctx, "acme/infra", "app", "sync/resources.toml", "")
+	if err != nil {
+		t.Fatalf("GetFile: %s", err)
+	}
+	if file.Content != "[[stack]]\n" || file.SHA != "abc" {
+		t.Errorf("GetFile() = %+v, want the decoded content and blob id abc", file)
+	}
+
+	put := PutFileOptions{Message: "Add resources.toml", Content: "[[stack]]\n", Branch: "trunk", CommitterName: "komodo", CommitterEmail: "komodo@example.com"}
+	if err := host.PutFile(ctx, "acme/infra", "app", "sync/resources.toml", put); err != nil {
+		t.Fatalf("PutFile create: %s", err)
+	}
+	put.SHA = "abc"
+	if err := host.PutFile(ctx, "acme/infra", "app", "sync/resources.toml", put); err != nil {
+		t.Fatalf("PutFile update: %s", err)
+	}
+	if err := host.AddDeployKey(ctx, "acme/infra", "app", "komodo", "ssh-ed25519 AAAA", true); err != nil {
+		t.Fatalf("AddDeployKey: %s", err)
+	}
+	if err := host.ArchiveRepository(ctx, "acme/infra", "app"); err != nil {
+		t.Fatalf("ArchiveRepository: %s", err)
+	}
+	if err := host.DeleteRepository(ctx, "acme/infra", "app"); err != nil {
+		t.Fatalf("DeleteRepository: %s", err)
+	}
+
+	if len(*requests) != 11 {
+		t.Fatalf("got %d requests, want 11", len(*requests))
+	}
+	r := *requests
+	for _, req := range r {
+		if req.PrivateToken != "tok" || req.Authorization != "" {
+			t.Errorf("%s %s: PRIVATE-TOKEN = %q, Authorization = %q, want only the token header", req.Method, req.Path, req.PrivateToken, req.Authorization)
+		}
+	}
+	base := "/api/v4/projects/acme%2Finfra%2Fapp"
+	checkRequest(t, r[0], "GET", "/api/v4/user", nil)
+	checkRequest(t, r[1], "GET", "/api/v4/namespaces/acme%2Finfra", nil)
+	checkRequest(t, r[2], "POST", "/api/v4/projects", map[string]any{
+		"name": "app", "path": "app", "description": "sync", "visibility": "private",
+		"initialize_with_readme": true, "namespace_id": float64(42),
+	})
+	checkRequest(t, r[3], "POST", "/api/v4/projects", map[string]any{"visibility": "public", "namespace_id": nil})
+	checkRequest(t, r[4], "GET", base, nil)
+	checkRequest(t, r[5], "GET", base+"/repository/files/sync%2Fresources.toml", nil)
+	if r[5].Query != "ref=trunk" {
+		t.Errorf("GetFile query = %q, want ref=trunk", r[5].Query)
+	}
+	checkRequest(t, r[6], "POST", base+"/repository/files/sync%2Fresources.toml", map[string]any{
+		"branch": "trunk", "content": "[[stack]]\n", "commit_message": "Add resources.toml",
+		"author_name": "komodo", "author_email": "komodo@example.com",
+	})
+	checkRequest(t, r[7], "PUT", base+"/repository/files/sync%2Fresources.toml", map[string]any{"content": "[[stack]]\n"})
+	checkRequest(t, r[8], "POST", base+"/deploy_keys", map[string]any{"title": "komodo", "key": "ssh-ed25519 AAAA", "can_push": false})
+	checkRequest(t, r[9], "POST", base+"/archive", nil)
+	checkRequest(t, r[10], "DELETE", base, nil)
+}
+
+func TestGitLabHostErrors(t *testing.T) {
+	host, requests := newTestGitLab(t, map[string]testResponse{
+		"GET /api/v4/namespaces/acme":                  {status: http.StatusOK, body: `{"id":42}`},
+		"POST /api/v4/projects":                        {status: http.StatusBadRequest, body: `{"message":{"path":["has already been taken"]}}`},
+		"POST /api/v4/projects/acme%2Fapp/deploy_keys": {status: http.StatusBadRequest, body: `{"message":{"key":["has already been taken"]}}`},
+		"POST /api/v4/projects/acme%2Fapp/archive":     {status: http.StatusForbidden, body: `{"message":"403 Forbidden"}`},
+	})
+	ctx := context.Background()
+
+	_, err := host.CreateRepository(ctx, "missing-group", "app", CreateRepositoryOptions{})
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "failed to look up namespace missing-group") {
+		t.Errorf("CreateRepository in a missing namespace = %v, want a namespace ErrNotFound", err)
+	}
+	if last := (*requests)[len(*requests)-1]; last.Method != http.MethodGet {
+		t.Errorf("CreateRepository in a missing namespace sent %s %s after the lookup failed", last.Method, last.Path)
+	}
+
+	var httpErr *HTTPError
+	_, err = host.CreateRepository(ctx, "acme", "app", CreateRepositoryOptions{})
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("CreateRepository of a taken path = %v, want an HTTP 400 error", err)
+	}
+	if _, err := host.GetRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRepository of a missing project = %v, want ErrNotFound", err)
+	}
+	// The default branch lookup fails first when no ref is given.
+	if _, err := host.GetFile(ctx, "acme", "missing", "resources.toml", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile in a missing project = %v, want ErrNotFound", err)
+	}
+	if _, err := host.GetFile(ctx, "acme", "app", "resources.toml", "main"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile of a missing file = %v, want ErrNotFound", err)
+	}
+	if err := host.DeleteRepository(ctx, "acme", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteRepository of a missing project = %v, want ErrNotFound", err)
+	}
+	err = host.ArchiveRepository(ctx, "acme", "app")
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusForbidden {
+		t.Errorf("ArchiveRepository without permission = %v, want an HTTP 403 error", err)
+	}
+	err = host.AddDeployKey(ctx, "acme", "app", "komodo", "ssh-ed25519 AAAA", true)
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("AddDeployKey of a used key = %v, want an HTTP 400 error", err)
+	}
+}
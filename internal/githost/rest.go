@@ -0,0 +1,79 @@
+package githost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// restClient is the minimal JSON-over-HTTP client shared by the Gitea and
+// GitLab hosts, which have no go-github equivalent in this module.
+type restClient struct {
+	baseURL    string
+	httpClient *http.Client
+	// authorize adds the host specific authentication header to req.
+	authorize func(req *http.Request)
+}
+
+// HTTPError is returned for non-2xx responses from a REST host.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: HTTP %d: %s", e.Method, e.URL, e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// do sends body (if non-nil) as JSON and decodes a JSON response into out
+// (if non-nil). A 404 is reported as ErrNotFound.
+func (c *restClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	url := strings.TrimSuffix(c.baseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		httpErr := &HTTPError{Method: method, URL: url, StatusCode: resp.StatusCode, Body: string(respBody)}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %v", ErrNotFound, httpErr)
+		}
+		return httpErr
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
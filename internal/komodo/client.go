@@ -0,0 +1,146 @@
+// Package komodo is a small typed client for the Komodo core HTTP API.
+//
+// Komodo exposes three RPC style endpoints — /read, /write and /execute —
+// which all take a POST body of the form {"type": "<Request>", "params": {...}}.
+// The client marshals typed request params, decodes typed responses and turns
+// non-200 responses into *APIError values so callers never have to build JSON
+// by hand.
+package komodo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to a single Komodo core using an API key / secret pair.
+type Client struct {
+	endpoint   string
+	apiKey     string
+	apiSecret  string
+	httpClient *http.Client
+	// coreVersion is set by SetCoreVersion once the core has been asked.
+	coreVersion *Version
+	retry       RetryPolicy
+}
+
+// NewClient returns a Client for the core at endpoint. If httpClient is nil
+// http.DefaultClient is used.
+func NewClient(endpoint, apiKey, apiSecret string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		apiKey:     apiKey,
+		apiSecret:  apiSecret,
+		httpClient: httpClient,
+		retry:      DefaultRetryPolicy,
+	}
+}
+
+// Endpoint returns the base URL of the Komodo core, without a trailing slash.
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// request is the envelope every Komodo API call is wrapped in.
+type request struct {
+	Type   string `json:"type"`
+	Params any    `json:"params"`
+}
+
+// Read calls the /read endpoint with the given request type and params and
+// decodes the response into out (which may be nil).
+func (c *Client) Read(ctx context.Context, typ string, params, out any, opts ...CallOption) error {
+	return c.do(ctx, "read", typ, params, out, opts)
+}
+
+// Write calls the /write endpoint.
+func (c *Client) Write(ctx context.Context, typ string, params, out any, opts ...CallOption) error {
+	return c.do(ctx, "write", typ, params, out, opts)
+}
+
+// Auth calls the /auth endpoint, which serves requests about the caller
+// such as GetUser.
+func (c *Client) Auth(ctx context.Context, typ string, params, out any, opts ...CallOption) error {
+	return c.do(ctx, "auth", typ, params, out, opts)
+}
+
+// Execute calls the /execute endpoint. Execute requests are asynchronous on
+// the core side and return an Update describing the queued operation.
+func (c *Client) Execute(ctx context.Context, typ string, params, out any, opts ...CallOption) error {
+	return c.do(ctx, "execute", typ, params, out, opts)
+}
+
+// do sends the request, retrying it as the client's RetryPolicy allows, and
+// decodes the response into out.
+func (c *Client) do(ctx context.Context, path, typ string, params, out any, opts []CallOption) error {
+	var options callOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if params == nil {
+		params = struct{}{}
+	}
+	body, err := json.Marshal(request{Type: typ, Params: params})
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %w", typ, err)
+	}
+
+	var respBody []byte
+	for attempt := 1; ; attempt++ {
+		respBody, err = c.send(ctx, path, typ, body)
+		if err == nil || attempt >= c.retry.MaxAttempts || !c.retry.retryable(ctx, path, options, err) {
+			break
+		}
+		if sleepErr := sleep(ctx, c.retry.backoff(attempt, err)); sleepErr != nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error decoding %s response: %w", typ, err)
+	}
+	return nil
+}
+
+// send makes a single attempt at a request and returns the response body.
+func (c *Client) send(ctx context.Context, path, typ string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s request: %w", typ, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", c.apiKey)
+	req.Header.Set("X-Api-Secret", c.apiSecret)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending %s request: %w", typ, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s response: %w", typ, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(typ, resp.StatusCode, resp.Status, respBody)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, apiErr
+	}
+	return respBody, nil
+}
@@ -0,0 +1,107 @@
+package komodo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordedRequest is a request as the core received it.
+type recordedRequest struct {
+	Path      string
+	APIKey    string
+	APISecret string
+	Type      string
+	Params    map[string]any
+}
+
+// newTestCore starts a core that records each request and answers with
+// response.
+func newTestCore(t *testing.T, status int, response string) (*Client, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Type   string         `json:"type"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request body: %s", err)
+		}
+		requests = append(requests, recordedRequest{
+			Path:      r.URL.Path,
+			APIKey:    r.Header.Get("X-Api-Key"),
+			APISecret: r.Header.Get("X-Api-Secret"),
+			Type:      body.Type,
+			Params:    body.Params,
+		})
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL+"/", "key", "secret", server.Client()), &requests
+}
+
+func TestClientEscapesNames(t *testing.T) {
+	names := []string{
+		`plain`,
+		`with "quotes"`,
+		`back\slash`,
+		`"}],"type":"DeleteServer`,
+		"new\nline",
+	}
+	for _, name := range names {
+		client, requests := newTestCore(t, http.StatusOK, `{"_id":{"$oid":"6650f1"},"name":"x"}`)
+
+		if _, err := client.GetResourceSync(context.Background(), name); err != nil {
+			t.Fatalf("GetResourceSync(%q): %s", name, err)
+		}
+		if _, err := client.UpdateServer(context.Background(), name, ServerConfig{Address: Ptr(name)}); err != nil {
+			t.Fatalf("UpdateServer(%q): %s", name, err)
+		}
+
+		if len(*requests) != 2 {
+			t.Fatalf("core saw %d requests, want 2", len(*requests))
+		}
+		read, write := (*requests)[0], (*requests)[1]
+		if read.Path != "/read" || read.Type != "GetResourceSync" || read.Params["sync"] != name {
+			t.Errorf("GetResourceSync(%q) sent %+v", name, read)
+		}
+		config, _ := write.Params["config"].(map[string]any)
+		if write.Path != "/write" || write.Type != "UpdateServer" || write.Params["id"] != name || config["address"] != name {
+			t.Errorf("UpdateServer(%q) sent %+v", name, write)
+		}
+		if read.APIKey != "key" || read.APISecret != "secret" {
+			t.Errorf("credentials sent as %q/%q", read.APIKey, read.APISecret)
+		}
+	}
+}
+
+func TestClientDecodesResponse(t *testing.T) {
+	client, _ := newTestCore(t, http.StatusOK, `{"_id":{"$oid":"6650f1"},"name":"sync \"a\""}`)
+	sync, err := client.GetResourceSync(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("GetResourceSync: %s", err)
+	}
+	if sync.ID != "6650f1" || sync.Name != `sync "a"` {
+		t.Errorf("GetResourceSync = %+v", sync)
+	}
+}
+
+func TestClientReturnsAPIError(t *testing.T) {
+	client, _ := newTestCore(t, http.StatusInternalServerError,
+		`{"error":"failed to update server","trace":["name \"x\" already exists"]}`)
+	_, err := client.UpdateServer(context.Background(), "x", ServerConfig{})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("UpdateServer error = %v (%T), want *APIError", err, err)
+	}
+	if apiErr.Operation != "UpdateServer" || apiErr.StatusCode != 500 || apiErr.Message != "failed to update server" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if got, want := apiErr.Cause(), `failed to update server: name "x" already exists`; got != want {
+		t.Errorf("Cause() = %q, want %q", got, want)
+	}
+}
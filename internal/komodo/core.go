@@ -0,0 +1,113 @@
+package komodo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a Komodo core version, e.g. 1.17.5.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion parses a "major.minor.patch" version. A leading "v" and any
+// pre-release or build suffix ("-rc.1", "+abc") are ignored.
+func ParseVersion(s string) (Version, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		nums[i] = n
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is older than other.
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// MinFileContentsVersion is the first core that supports resource syncs whose
+// TOML is stored in Komodo (file_contents) rather than read from a repo. The
+// provider's ContextWare and inline ResourceSetup syncs depend on it; calls
+// that need it are refused with RequireCoreVersion.
+var MinFileContentsVersion = Version{Major: 1, Minor: 16}
+
+// GetVersionResponse is the response of GetVersion.
+type GetVersionResponse struct {
+	Version string `json:"version"`
+}
+
+// GetVersion returns the version of the Komodo core.
+func (c *Client) GetVersion(ctx context.Context) (Version, error) {
+	var resp GetVersionResponse
+	if err := c.Read(ctx, "GetVersion", struct{}{}, &resp); err != nil {
+		return Version{}, err
+	}
+	return ParseVersion(resp.Version)
+}
+
+// User is the subset of a Komodo user the provider uses.
+type User struct {
+	ID       ObjectID `json:"_id"`
+	Username string   `json:"username"`
+	Enabled  bool     `json:"enabled"`
+	Admin    bool     `json:"admin"`
+}
+
+// GetUser returns the user the API key belongs to.
+func (c *Client) GetUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.Auth(ctx, "GetUser", struct{}{}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetCoreVersion records the version of the core the client talks to, as
+// found by GetVersion. Until it is set the version is unknown.
+func (c *Client) SetCoreVersion(v Version) {
+	c.coreVersion = &v
+}
+
+// CoreVersion returns the recorded core version, if any.
+func (c *Client) CoreVersion() (Version, bool) {
+	if c.coreVersion == nil {
+		return Version{}, false
+	}
+	return *c.coreVersion, true
+}
+
+// RequireCoreVersion returns an error if the recorded core version is older
+// than min. feature names what needs it in the error. An unknown version is
+// assumed to be new enough.
+func (c *Client) RequireCoreVersion(min Version, feature string) error {
+	v, ok := c.CoreVersion()
+	if !ok || !v.Less(min) {
+		return nil
+	}
+	return fmt.Errorf("%s requires Komodo core %s or newer, but %s is running %s", feature, min, c.endpoint, v)
+}
@@ -0,0 +1,102 @@
+package komodo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Version
+		wantErr bool
+	}{
+		{value: "1.17.5", want: Version{1, 17, 5}},
+		{value: "v1.16.0", want: Version{1, 16, 0}},
+		{value: " 1.16 ", want: Version{1, 16, 0}},
+		{value: "2", want: Version{2, 0, 0}},
+		{value: "1.18.0-rc.1", want: Version{1, 18, 0}},
+		{value: "1.18.0+abc", want: Version{1, 18, 0}},
+		{value: "", wantErr: true},
+		{value: "1.2.3.4", wantErr: true},
+		{value: "1.x.0", wantErr: true},
+		{value: "1.-1.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseVersion(%q) = %s, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q) returned error: %s", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		want bool
+	}{
+		{Version{1, 15, 9}, Version{1, 16, 0}, true},
+		{Version{1, 16, 0}, Version{1, 16, 0}, false},
+		{Version{1, 16, 1}, Version{1, 16, 0}, false},
+		{Version{0, 99, 99}, Version{1, 0, 0}, true},
+		{Version{2, 0, 0}, Version{1, 99, 0}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Less(tt.b); got != tt.want {
+			t.Errorf("%s.Less(%s) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRequireCoreVersion(t *testing.T) {
+	client := NewClient("http://komodo", "key", "secret", nil)
+	if err := client.RequireCoreVersion(MinFileContentsVersion, "inline"); err != nil {
+		t.Errorf("unknown core version refused: %s", err)
+	}
+	client.SetCoreVersion(Version{1, 15, 3})
+	if err := client.RequireCoreVersion(MinFileContentsVersion, "inline"); err == nil {
+		t.Error("core 1.15.3 accepted for a 1.16 feature")
+	}
+	client.SetCoreVersion(Version{1, 16, 0})
+	if err := client.RequireCoreVersion(MinFileContentsVersion, "inline"); err != nil {
+		t.Errorf("core 1.16.0 refused: %s", err)
+	}
+}
+
+func TestGetUserUsesAuthEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/auth" {
+			http.Error(w, `{"error":"unknown request"}`, http.StatusNotFound)
+			return
+		}
+		var req struct {
+			Type string `json:"type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Type != "GetUser" {
+			t.Errorf("request type = %q (%v), want GetUser", req.Type, err)
+		}
+		w.Write([]byte(`{"_id":{"$oid":"abc"},"username":"terraform","enabled":true}`))
+	}))
+	defer server.Close()
+
+	user, err := NewClient(server.URL, "key", "secret", server.Client()).GetUser(context.Background())
+	if err != nil {
+		t.Fatalf("GetUser: %s", err)
+	}
+	if user.Username != "terraform" || !user.Enabled {
+		t.Errorf("GetUser = %+v, want enabled user terraform", user)
+	}
+}
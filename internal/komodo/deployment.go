@@ -0,0 +1,144 @@
+package komodo
+
+import "context"
+
+// DeploymentImage is the image a deployment runs: either an image reference
+// ({"type": "Image", "params": {"image": "nginx:1.27"}}) or a Komodo build.
+type DeploymentImage struct {
+	Type   string                `json:"type"`
+	Params DeploymentImageParams `json:"params"`
+}
+
+type DeploymentImageParams struct {
+	// Image is set for type Image.
+	Image string `json:"image,omitempty"`
+	// BuildID is set for type Build.
+	BuildID string `json:"build_id,omitempty"`
+}
+
+// DeploymentImage types.
+const (
+	DeploymentImageTypeImage = "Image"
+	DeploymentImageTypeBuild = "Build"
+)
+
+// ImageDeployment returns the DeploymentImage for a plain image reference.
+func ImageDeployment(image string) *DeploymentImage {
+	return &DeploymentImage{Type: DeploymentImageTypeImage, Params: DeploymentImageParams{Image: image}}
+}
+
+// BuildDeployment returns the DeploymentImage for the latest version of a
+// Komodo build.
+func BuildDeployment(buildID string) *DeploymentImage {
+	return &DeploymentImage{Type: DeploymentImageTypeBuild, Params: DeploymentImageParams{BuildID: buildID}}
+}
+
+// DeploymentConfig is the config block of a Komodo deployment. As with
+// ServerConfig, nil fields are omitted so the type doubles as a partial
+// config for updates.
+type DeploymentConfig struct {
+	// ServerID is the id (or name) of the server the container runs on.
+	ServerID *string          `json:"server_id,omitempty"`
+	Image    *DeploymentImage `json:"image,omitempty"`
+	// Ports, Volumes, Environment and Labels hold one entry per line, e.g.
+	// "8080:80" or "KEY=value".
+	Ports       *string `json:"ports,omitempty"`
+	Volumes     *string `json:"volumes,omitempty"`
+	Environment *string `json:"environment,omitempty"`
+	Labels      *string `json:"labels,omitempty"`
+	// Restart is the docker restart policy: no, on-failure, always or
+	// unless-stopped.
+	Restart *string `json:"restart,omitempty"`
+	Network *string `json:"network,omitempty"`
+	// RedeployOnBuild redeploys the container whenever its build finishes.
+	// Only meaningful for a Build image.
+	RedeployOnBuild *bool `json:"redeploy_on_build,omitempty"`
+}
+
+// Deployment is a Komodo deployment: a single container on one server.
+type Deployment struct {
+	ID          ObjectID         `json:"_id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Config      DeploymentConfig `json:"config"`
+}
+
+type GetDeploymentParams struct {
+	Deployment string `json:"deployment"`
+}
+
+type CreateDeploymentParams struct {
+	Name   string           `json:"name"`
+	Config DeploymentConfig `json:"config"`
+}
+
+type UpdateDeploymentParams struct {
+	ID     string           `json:"id"`
+	Config DeploymentConfig `json:"config"`
+}
+
+type DeleteDeploymentParams struct {
+	ID string `json:"id"`
+}
+
+type DeployParams struct {
+	Deployment string `json:"deployment"`
+}
+
+type DestroyParams struct {
+	Deployment string `json:"deployment"`
+}
+
+// GetDeployment looks a deployment up by name or id.
+func (c *Client) GetDeployment(ctx context.Context, deployment string) (*Deployment, error) {
+	var out Deployment
+	if err := c.Read(ctx, "GetDeployment", GetDeploymentParams{Deployment: deployment}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDeployment creates a new deployment.
+func (c *Client) CreateDeployment(ctx context.Context, name string, config DeploymentConfig) (*Deployment, error) {
+	var out Deployment
+	if err := c.Write(ctx, "CreateDeployment", CreateDeploymentParams{Name: name, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDeployment applies a partial config update to a deployment.
+func (c *Client) UpdateDeployment(ctx context.Context, id string, config DeploymentConfig) (*Deployment, error) {
+	var out Deployment
+	if err := c.Write(ctx, "UpdateDeployment", UpdateDeploymentParams{ID: id, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteDeployment deletes the deployment with the given name or id. Komodo
+// also removes its container.
+func (c *Client) DeleteDeployment(ctx context.Context, id string) error {
+	return c.Write(ctx, "DeleteDeployment", DeleteDeploymentParams{ID: id}, nil, RetryOnKinds(ErrorKindBusy))
+}
+
+// DeployDeployment queues a Deploy of the deployment, which (re)creates its
+// container, and returns its Update.
+func (c *Client) DeployDeployment(ctx context.Context, deployment string) (*Update, error) {
+	var out Update
+	if err := c.Execute(ctx, "Deploy", DeployParams{Deployment: deployment}, &out, RetryOnKinds(ErrorKindBusy)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DestroyDeployment queues a Destroy of the deployment, which stops and
+// removes its container, and returns its Update.
+func (c *Client) DestroyDeployment(ctx context.Context, deployment string) (*Update, error) {
+	var out Update
+	if err := c.Execute(ctx, "Destroy", DestroyParams{Deployment: deployment}, &out, RetryOnKinds(ErrorKindBusy)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
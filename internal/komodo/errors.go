@@ -0,0 +1,172 @@
+package komodo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// APIError is returned when the Komodo core answers with a non-200 status.
+type APIError struct {
+	// Operation is the request type that failed, e.g. "GetServer".
+	Operation  string
+	StatusCode int
+	Status     string
+	// Message is the top level error reported by the core, and Trace the
+	// chain of underlying causes, outermost first. Both are empty when the
+	// body was not Komodo's error JSON (e.g. a reverse proxy error page).
+	Message string
+	Trace   []string
+	// Body is the raw response body returned by the core. It may echo
+	// request content such as resources.toml; use Cause for display.
+	Body string
+	// RetryAfter is the wait the core (or a proxy in front of it) asked for
+	// in a Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+// errorResponse is the JSON body Komodo sends with a failed request.
+type errorResponse struct {
+	Error string   `json:"error"`
+	Trace []string `json:"trace"`
+}
+
+// newAPIError builds an APIError, decoding Komodo's error JSON from body
+// when possible.
+func newAPIError(operation string, statusCode int, status string, body []byte) *APIError {
+	apiErr := &APIError{
+		Operation:  operation,
+		StatusCode: statusCode,
+		Status:     status,
+		Body:       string(body),
+	}
+	var resp errorResponse
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != "" {
+		apiErr.Message = resp.Error
+		apiErr.Trace = resp.Trace
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s failed with HTTP status %s: %s", e.Operation, e.Status, e.Cause())
+}
+
+// maxCauseLength caps how much of a single error message or trace entry is
+// shown.
+const maxCauseLength = 500
+
+// Cause returns a readable, redacted description of why the request failed:
+// the message and its trace, or the raw body if the core sent no error JSON.
+func (e *APIError) Cause() string {
+	return strings.Join(e.Causes(), ": ")
+}
+
+// Causes returns the redacted message followed by each trace entry, or just
+// the (redacted) raw body if the core sent no error JSON.
+func (e *APIError) Causes() []string {
+	if e.Message == "" {
+		return []string{Redact(truncate(strings.TrimSpace(e.Body), maxCauseLength))}
+	}
+	causes := []string{Redact(truncate(e.Message, maxCauseLength))}
+	for _, cause := range e.Trace {
+		causes = append(causes, Redact(truncate(cause, maxCauseLength)))
+	}
+	return causes
+}
+
+// PEM private keys, and KEY=value lines whose name marks them as secret, as
+// found in resources.toml environments. The value pattern also matches the
+// JSON escaped form (KEY=\"...\") found in request bodies.
+var (
+	privateKeyPattern  = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`)
+	secretValuePattern = regexp.MustCompile(`(?i)([A-Z0-9_]*(PRIVATE_KEY|SECRET|PASSWORD|TOKEN|API_KEY)[A-Z0-9_]*\s*=\s*)\\?"?[^"\\\n]*\\?"?`)
+)
+
+// Redact replaces secrets in s with "***": content that must not end up in
+// error messages or logs even when the core echoes it back.
+func Redact(s string) string {
+	s = privateKeyPattern.ReplaceAllString(s, "***")
+	return secretValuePattern.ReplaceAllString(s, "${1}***")
+}
+
+// RedactPatterns returns the patterns Redact masks, for log masks that can
+// only take regular expressions. Those hide the whole match, so the key name
+// of a secret value is masked along with it.
+func RedactPatterns() []*regexp.Regexp {
+	return []*regexp.Regexp{privateKeyPattern, secretValuePattern}
+}
+
+// truncate shortens s to at most n bytes, marking the cut.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "...(truncated)"
+}
+
+// ErrorKind classifies an APIError by what the caller can do about it.
+type ErrorKind string
+
+const (
+	ErrorKindUnknown  ErrorKind = "Unknown"
+	ErrorKindNotFound ErrorKind = "NotFound"
+	// ErrorKindBusy means the target resource is running another action,
+	// e.g. a procedure that is still executing. Retrying later usually works.
+	ErrorKindBusy ErrorKind = "Busy"
+)
+
+// Komodo 1.x cores, including every version from MinFileContentsVersion on,
+// send no error codes: lookups of unknown resources and actions on a busy
+// resource both fail with a 500 whose cause is one of these fixed messages.
+// They are matched against a whole decoded message or trace entry, never
+// searched for in free text.
+var (
+	notFoundMessage = regexp.MustCompile(`(?i)^did not find any \S+ matching `)
+	busyMessage     = regexp.MustCompile(`(?i)^(\w+ busy|resource is busy)$`)
+)
+
+// Kind classifies the error from its status code and, for the 500s older
+// cores send, its decoded message and trace. An error without Komodo's error
+// JSON is only classified by its status code.
+func (e *APIError) Kind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrorKindNotFound
+	case http.StatusConflict:
+		return ErrorKindBusy
+	case http.StatusInternalServerError:
+	default:
+		return ErrorKindUnknown
+	}
+	for _, cause := range append([]string{e.Message}, e.Trace...) {
+		cause = strings.TrimSpace(cause)
+		switch {
+		case notFoundMessage.MatchString(cause):
+			return ErrorKindNotFound
+		case busyMessage.MatchString(cause):
+			return ErrorKindBusy
+		}
+	}
+	return ErrorKindUnknown
+}
+
+// ErrorKindOf returns the ErrorKind of err if it is (or wraps) an APIError,
+// and ErrorKindUnknown otherwise.
+func ErrorKindOf(err error) ErrorKind {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return ErrorKindUnknown
+	}
+	return apiErr.Kind()
+}
+
+// IsNotFound reports whether err is an APIError for a resource that does not
+// exist.
+func IsNotFound(err error) bool {
+	return ErrorKindOf(err) == ErrorKindNotFound
+}
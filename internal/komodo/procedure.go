@@ -0,0 +1,101 @@
+package komodo
+
+import "context"
+
+// Execution is a single executable request inside a procedure stage, e.g.
+// {"type": "DeployStack", "params": {"stack": "my_stack"}}.
+type Execution struct {
+	Type   string         `json:"type"`
+	Params map[string]any `json:"params"`
+}
+
+// EnabledExecution wraps an Execution with its per-execution enabled flag.
+type EnabledExecution struct {
+	Execution Execution `json:"execution"`
+	Enabled   bool      `json:"enabled"`
+}
+
+// ProcedureStage is a group of executions that Komodo runs in parallel.
+type ProcedureStage struct {
+	Name       string             `json:"name"`
+	Enabled    bool               `json:"enabled"`
+	Executions []EnabledExecution `json:"executions"`
+}
+
+// ProcedureConfig is the config block of a Komodo procedure.
+type ProcedureConfig struct {
+	Stages []ProcedureStage `json:"stages,omitempty"`
+}
+
+// Procedure is a Komodo procedure.
+type Procedure struct {
+	ID          ObjectID        `json:"_id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Tags        []string        `json:"tags"`
+	Config      ProcedureConfig `json:"config"`
+}
+
+type GetProcedureParams struct {
+	Procedure string `json:"procedure"`
+}
+
+type CreateProcedureParams struct {
+	Name   string          `json:"name"`
+	Config ProcedureConfig `json:"config"`
+}
+
+type UpdateProcedureParams struct {
+	ID     string          `json:"id"`
+	Config ProcedureConfig `json:"config"`
+}
+
+type DeleteProcedureParams struct {
+	ID string `json:"id"`
+}
+
+type RunProcedureParams struct {
+	Procedure string `json:"procedure"`
+}
+
+// GetProcedure looks a procedure up by name or id.
+func (c *Client) GetProcedure(ctx context.Context, procedure string) (*Procedure, error) {
+	var out Procedure
+	if err := c.Read(ctx, "GetProcedure", GetProcedureParams{Procedure: procedure}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateProcedure creates a new procedure.
+func (c *Client) CreateProcedure(ctx context.Context, name string, config ProcedureConfig) (*Procedure, error) {
+	var out Procedure
+	if err := c.Write(ctx, "CreateProcedure", CreateProcedureParams{Name: name, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateProcedure updates a procedure. Stages, when set, replace all of the
+// procedure's stages.
+func (c *Client) UpdateProcedure(ctx context.Context, id string, config ProcedureConfig) (*Procedure, error) {
+	var out Procedure
+	if err := c.Write(ctx, "UpdateProcedure", UpdateProcedureParams{ID: id, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteProcedure deletes the procedure with the given name or id.
+func (c *Client) DeleteProcedure(ctx context.Context, id string) error {
+	return c.Write(ctx, "DeleteProcedure", DeleteProcedureParams{ID: id}, nil, RetryOnKinds(ErrorKindBusy))
+}
+
+// RunProcedure queues a run of the given procedure and returns its Update.
+func (c *Client) RunProcedure(ctx context.Context, procedure string) (*Update, error) {
+	var out Update
+	if err := c.Execute(ctx, "RunProcedure", RunProcedureParams{Procedure: procedure}, &out, RetryOnKinds(ErrorKindBusy)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,153 @@
+package komodo
+
+import "context"
+
+// ResourceSyncConfig is the config block of a Komodo resource sync. As with
+// ServerConfig, nil fields are omitted so the type doubles as a partial
+// config for updates.
+type ResourceSyncConfig struct {
+	Repo         *string   `json:"repo,omitempty"`
+	Branch       *string   `json:"branch,omitempty"`
+	GitProvider  *string   `json:"git_provider,omitempty"`
+	GitAccount   *string   `json:"git_account,omitempty"`
+	ResourcePath *[]string `json:"resource_path,omitempty"`
+	FileContents *string   `json:"file_contents,omitempty"`
+	FilesOnHost  *bool     `json:"files_on_host,omitempty"`
+	// Delete removes resources that are missing from the sync's files when
+	// it runs.
+	Delete            *bool `json:"delete,omitempty"`
+	IncludeUserGroups *bool `json:"include_user_groups,omitempty"`
+	IncludeVariables  *bool `json:"include_variables,omitempty"`
+	// WebhookEnabled lets a push to the repository refresh or run the sync
+	// through its webhook URL.
+	WebhookEnabled *bool `json:"webhook_enabled,omitempty"`
+	// WebhookSecret overrides the core's default webhook secret.
+	WebhookSecret *string `json:"webhook_secret,omitempty"`
+}
+
+// ResourceSync is a Komodo resource sync.
+type ResourceSync struct {
+	ID          ObjectID           `json:"_id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Tags        []string           `json:"tags"`
+	Config      ResourceSyncConfig `json:"config"`
+	Info        ResourceSyncInfo   `json:"info"`
+}
+
+// ResourceSyncInfo is the state Komodo keeps about a sync between runs.
+type ResourceSyncInfo struct {
+	LastSyncTs int64 `json:"last_sync_ts"`
+	// PendingError is set when the sync's files could not be read or
+	// parsed.
+	PendingError string `json:"pending_error"`
+	// ResourceUpdates are the changes a run of the sync would make to
+	// resources, as of the last refresh.
+	ResourceUpdates []ResourceDiff `json:"resource_updates"`
+}
+
+// ResourceDiff is a pending change to one resource.
+type ResourceDiff struct {
+	// Target is the resource changed. Its ID is empty for a resource the
+	// sync would create.
+	Target ResourceTarget `json:"target"`
+	Data   DiffData       `json:"data"`
+}
+
+// DiffData describes a ResourceDiff. Only the fields the provider reports
+// are decoded.
+type DiffData struct {
+	// Type is Create, Update or Delete.
+	Type string `json:"type"`
+	Data struct {
+		// Name is set for Create.
+		Name string `json:"name"`
+	} `json:"data"`
+}
+
+type GetResourceSyncParams struct {
+	Sync string `json:"sync"`
+}
+
+type CreateResourceSyncParams struct {
+	Name   string             `json:"name"`
+	Config ResourceSyncConfig `json:"config"`
+}
+
+type UpdateResourceSyncParams struct {
+	ID     string             `json:"id"`
+	Config ResourceSyncConfig `json:"config"`
+}
+
+type DeleteResourceSyncParams struct {
+	ID string `json:"id"`
+}
+
+type RefreshResourceSyncPendingParams struct {
+	Sync string `json:"sync"`
+}
+
+type RunSyncParams struct {
+	Sync string `json:"sync"`
+}
+
+// GetResourceSync looks a resource sync up by name or id.
+func (c *Client) GetResourceSync(ctx context.Context, sync string) (*ResourceSync, error) {
+	var out ResourceSync
+	if err := c.Read(ctx, "GetResourceSync", GetResourceSyncParams{Sync: sync}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateResourceSync creates a new resource sync.
+func (c *Client) CreateResourceSync(ctx context.Context, name string, config ResourceSyncConfig) (*ResourceSync, error) {
+	if config.FileContents != nil {
+		if err := c.RequireCoreVersion(MinFileContentsVersion, "a resource sync with file_contents"); err != nil {
+			return nil, err
+		}
+	}
+	var out ResourceSync
+	if err := c.Write(ctx, "CreateResourceSync", CreateResourceSyncParams{Name: name, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateResourceSync applies a partial config update to a resource sync.
+func (c *Client) UpdateResourceSync(ctx context.Context, id string, config ResourceSyncConfig) (*ResourceSync, error) {
+	if config.FileContents != nil {
+		if err := c.RequireCoreVersion(MinFileContentsVersion, "a resource sync with file_contents"); err != nil {
+			return nil, err
+		}
+	}
+	var out ResourceSync
+	if err := c.Write(ctx, "UpdateResourceSync", UpdateResourceSyncParams{ID: id, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteResourceSync deletes the resource sync with the given name or id.
+func (c *Client) DeleteResourceSync(ctx context.Context, id string) error {
+	return c.Write(ctx, "DeleteResourceSync", DeleteResourceSyncParams{ID: id}, nil, RetryOnKinds(ErrorKindBusy))
+}
+
+// RefreshResourceSyncPending recomputes the pending changes of a sync from
+// its current files and returns the sync.
+func (c *Client) RefreshResourceSyncPending(ctx context.Context, sync string) (*ResourceSync, error) {
+	var out ResourceSync
+	if err := c.Write(ctx, "RefreshResourceSyncPending", RefreshResourceSyncPendingParams{Sync: sync}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunSync queues a run of the given resource sync and returns its Update.
+func (c *Client) RunSync(ctx context.Context, sync string) (*Update, error) {
+	var out Update
+	if err := c.Execute(ctx, "RunSync", RunSyncParams{Sync: sync}, &out, RetryOnKinds(ErrorKindBusy)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,183 @@
+package komodo
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides which failed calls the client repeats and how long it
+// waits in between. Reads are repeated freely. Writes and executions are
+// only repeated when the core cannot have acted on them, since repeating
+// e.g. a CreateServer or RunProcedure that did go through would create a
+// duplicate or run the procedure twice.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first. 1
+	// disables retries.
+	MaxAttempts int
+	// BaseBackoff is the wait before the first retry; it doubles on each
+	// further retry up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Jitter randomises each wait by up to ±Jitter of its length (0 to 1) so
+	// parallel resources do not retry in lockstep.
+	Jitter float64
+	// RetryableStatusCodes are HTTP statuses worth retrying a read on.
+	// Komodo answers most errors, including not found, with a 500, so 500
+	// is not retried unless the error kind is retryable.
+	RetryableStatusCodes []int
+	// UnprocessedStatusCodes are HTTP statuses that mean the request was
+	// turned away before the core acted on it. Writes and executions are
+	// retried on these only.
+	UnprocessedStatusCodes []int
+	// RetryableKinds are Komodo error kinds worth retrying. They apply to
+	// reads, and to writes and executions that opt in with RetryOnKinds.
+	RetryableKinds []ErrorKind
+}
+
+// DefaultRetryPolicy retries reads on transport errors, gateway errors, rate
+// limiting and busy resources, and writes and executions on rate limiting
+// and unavailability, for about half a minute.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: 2 * time.Second,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+	RetryableStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+	UnprocessedStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusServiceUnavailable,
+	},
+	RetryableKinds: []ErrorKind{ErrorKindBusy},
+}
+
+// SetRetryPolicy replaces the client's retry policy, DefaultRetryPolicy
+// unless set.
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
+
+// CallOption adjusts a single Read, Write or Execute call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	retryKinds []ErrorKind
+}
+
+// RetryOnKinds lets a write or execution be retried on the given error
+// kinds, as far as the client's RetryPolicy lists them too. Only use it for
+// kinds that mean the core refused the request, such as ErrorKindBusy.
+func RetryOnKinds(kinds ...ErrorKind) CallOption {
+	return func(o *callOptions) {
+		o.retryKinds = append(o.retryKinds, kinds...)
+	}
+}
+
+// retryable reports whether err is worth another attempt at a call to path
+// ("read", "auth", "write" or "execute").
+func (p RetryPolicy) retryable(ctx context.Context, path string, opts callOptions, err error) bool {
+	if ctx.Err() != nil {
+		// Once the caller's context is done nothing is worth retrying.
+		return false
+	}
+	// The provider only sends lookups such as GetUser to /auth, so they are
+	// as safe to repeat as reads.
+	read := path == "read" || path == "auth"
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// A connection reset, refused connection or client timeout. A read
+		// can always be repeated; anything else only if it never left.
+		return read || notSent(err)
+	}
+	kind := apiErr.Kind()
+	if slices.Contains(p.RetryableKinds, kind) && (read || slices.Contains(opts.retryKinds, kind)) {
+		return true
+	}
+	if kind == ErrorKindNotFound {
+		return false
+	}
+	if read {
+		return slices.Contains(p.RetryableStatusCodes, apiErr.StatusCode)
+	}
+	return slices.Contains(p.UnprocessedStatusCodes, apiErr.StatusCode)
+}
+
+// notSent reports whether err shows the request never reached the core:
+// the name did not resolve, the connection was refused or the TLS handshake
+// failed.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return true
+	}
+	var certErr *tls.CertificateVerificationError
+	return errors.As(err, &certErr)
+}
+
+// backoff returns how long to wait before retry number retry (1 for the
+// first retry) after err. A Retry-After sent by the core takes precedence.
+func (p RetryPolicy) backoff(retry int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+
+	wait := p.BaseBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(wait))
+	}
+	return wait
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// sleep waits for d, returning early with ctx's error if it is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
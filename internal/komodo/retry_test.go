@@ -0,0 +1,182 @@
+package komodo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		retry int
+		err   error
+		want  time.Duration
+	}{
+		{1, errors.New("reset"), time.Second},
+		{2, errors.New("reset"), 2 * time.Second},
+		{3, errors.New("reset"), 4 * time.Second},
+		{4, errors.New("reset"), 5 * time.Second},
+		{10, errors.New("reset"), 5 * time.Second},
+		{1, &APIError{StatusCode: 429, RetryAfter: 12 * time.Second}, 12 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.retry, tt.err); got != tt.want {
+			t.Errorf("backoff(%d, %v) = %s, want %s", tt.retry, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{BaseBackoff: 10 * time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1, errors.New("reset")); got < 8*time.Second || got > 12*time.Second {
+			t.Fatalf("backoff with 20%% jitter = %s, want 8s to 12s", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	busy := &APIError{StatusCode: 500, Message: "procedure busy"}
+	notFound := &APIError{StatusCode: 500, Message: "did not find any procedure matching x"}
+	reset := fmt.Errorf("error sending RunProcedure request: %w", errors.New("connection reset by peer"))
+	refused := fmt.Errorf("error sending RunProcedure request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	unresolved := fmt.Errorf("error sending RunProcedure request: %w", &net.DNSError{Err: "no such host", Name: "komodo"})
+	busyOptIn := callOptions{retryKinds: []ErrorKind{ErrorKindBusy}}
+
+	tests := []struct {
+		name string
+		path string
+		opts callOptions
+		err  error
+		want bool
+	}{
+		{"read transport error", "read", callOptions{}, reset, true},
+		{"write transport error", "write", callOptions{}, reset, false},
+		{"execute transport error", "execute", callOptions{}, reset, false},
+		{"execute refused connection", "execute", callOptions{}, refused, true},
+		{"write unresolved host", "write", callOptions{}, unresolved, true},
+		{"read 502", "read", callOptions{}, &APIError{StatusCode: 502}, true},
+		{"write 502", "write", callOptions{}, &APIError{StatusCode: 502}, false},
+		{"write 503", "write", callOptions{}, &APIError{StatusCode: 503}, true},
+		{"execute 429", "execute", callOptions{}, &APIError{StatusCode: 429}, true},
+		{"read 500", "read", callOptions{}, &APIError{StatusCode: 500, Message: "boom"}, false},
+		{"read busy", "read", callOptions{}, busy, true},
+		{"execute busy", "execute", callOptions{}, busy, false},
+		{"execute busy opted in", "execute", busyOptIn, busy, true},
+		{"read not found", "read", callOptions{}, notFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultRetryPolicy.retryable(context.Background(), tt.path, tt.opts, tt.err); got != tt.want {
+				t.Errorf("retryable = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if DefaultRetryPolicy.retryable(ctx, "read", callOptions{}, reset) {
+		t.Error("retryable after the context is done = true, want false")
+	}
+}
+
+// TestClientDoesNotRepeatWrites checks that a connection dropped after the
+// core received a write is not retried, while a read is.
+func TestClientDoesNotRepeatWrites(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijacking connection: %s", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "key", "secret", server.Client())
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	for _, tt := range []struct {
+		call func() error
+		want int32
+	}{
+		{func() error { return client.Write(context.Background(), "CreateServer", nil, nil) }, 1},
+		{func() error { return client.Execute(context.Background(), "RunProcedure", nil, nil) }, 1},
+		{func() error { return client.Read(context.Background(), "GetServer", nil, nil) }, 3},
+	} {
+		requests.Store(0)
+		if err := tt.call(); err == nil {
+			t.Fatal("call succeeded on a dropped connection")
+		}
+		if got := requests.Load(); got != tt.want {
+			t.Errorf("core saw %d requests, want %d", got, tt.want)
+		}
+	}
+}
+
+// TestClientRetriesBusyDeletes checks that deletes the core refused because
+// the target was busy are retried, while other writes are not.
+func TestClientRetriesBusyDeletes(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, `{"error":"Procedure busy"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "key", "secret", server.Client())
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, RetryableKinds: []ErrorKind{ErrorKindBusy}})
+
+	for _, tt := range []struct {
+		name    string
+		call    func() error
+		want    int32
+		wantErr bool
+	}{
+		{"DeleteProcedure", func() error { return client.DeleteProcedure(context.Background(), "acme_ProcedureApply") }, 2, false},
+		{"DeleteResourceSync", func() error { return client.DeleteResourceSync(context.Background(), "acme_ResourceSetup") }, 2, false},
+		{"DeleteServer", func() error { return client.DeleteServer(context.Background(), "server-acme") }, 2, false},
+		{"CreateServer", func() error { return client.Write(context.Background(), "CreateServer", nil, nil) }, 1, true},
+	} {
+		requests.Store(0)
+		if err := tt.call(); (err != nil) != tt.wantErr {
+			t.Errorf("%s error = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if got := requests.Load(); got != tt.want {
+			t.Errorf("%s: core saw %d requests, want %d", tt.name, got, tt.want)
+		}
+	}
+}
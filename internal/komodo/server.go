@@ -0,0 +1,120 @@
+package komodo
+
+import "context"
+
+// ServerConfig is the config block of a Komodo server. Fields are pointers so
+// the same type can be used for partial updates: nil fields are left
+// unchanged by UpdateServer.
+type ServerConfig struct {
+	// Address is the periphery URL core connects to. Empty for servers whose
+	// periphery connects out to core.
+	Address *string `json:"address,omitempty"`
+	Enabled *bool   `json:"enabled,omitempty"`
+	Region  *string `json:"region,omitempty"`
+	// Passkey overrides the core's default passkey for this periphery.
+	Passkey *string `json:"passkey,omitempty"`
+	// IgnoreMounts are mount points left out of the disk stats. It is a
+	// pointer so an update can clear it with an empty list.
+	IgnoreMounts *[]string `json:"ignore_mounts,omitempty"`
+
+	StatsMonitoring       *bool `json:"stats_monitoring,omitempty"`
+	SendUnreachableAlerts *bool `json:"send_unreachable_alerts,omitempty"`
+	SendCPUAlerts         *bool `json:"send_cpu_alerts,omitempty"`
+	SendMemAlerts         *bool `json:"send_mem_alerts,omitempty"`
+	SendDiskAlerts        *bool `json:"send_disk_alerts,omitempty"`
+
+	// Alert thresholds, in percent of CPU, memory and disk used.
+	CPUWarning   *float64 `json:"cpu_warning,omitempty"`
+	CPUCritical  *float64 `json:"cpu_critical,omitempty"`
+	MemWarning   *float64 `json:"mem_warning,omitempty"`
+	MemCritical  *float64 `json:"mem_critical,omitempty"`
+	DiskWarning  *float64 `json:"disk_warning,omitempty"`
+	DiskCritical *float64 `json:"disk_critical,omitempty"`
+}
+
+// Server is a Komodo server resource.
+type Server struct {
+	ID          ObjectID     `json:"_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Tags        []string     `json:"tags"`
+	Config      ServerConfig `json:"config"`
+}
+
+// ServerStatus is the connection state reported by GetServerState.
+type ServerStatus string
+
+const (
+	ServerStatusOk       ServerStatus = "Ok"
+	ServerStatusNotOk    ServerStatus = "NotOk"
+	ServerStatusDisabled ServerStatus = "Disabled"
+)
+
+// ServerState is the response of GetServerState.
+type ServerState struct {
+	Status ServerStatus `json:"status"`
+}
+
+type GetServerParams struct {
+	Server string `json:"server"`
+}
+
+type GetServerStateParams struct {
+	Server string `json:"server"`
+}
+
+type CreateServerParams struct {
+	Name   string       `json:"name"`
+	Config ServerConfig `json:"config"`
+}
+
+type UpdateServerParams struct {
+	ID     string       `json:"id"`
+	Config ServerConfig `json:"config"`
+}
+
+type DeleteServerParams struct {
+	ID string `json:"id"`
+}
+
+// GetServer looks a server up by name or id.
+func (c *Client) GetServer(ctx context.Context, server string) (*Server, error) {
+	var out Server
+	if err := c.Read(ctx, "GetServer", GetServerParams{Server: server}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetServerState returns the current connection state of a server.
+func (c *Client) GetServerState(ctx context.Context, server string) (*ServerState, error) {
+	var out ServerState
+	if err := c.Read(ctx, "GetServerState", GetServerStateParams{Server: server}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateServer creates a new server.
+func (c *Client) CreateServer(ctx context.Context, name string, config ServerConfig) (*Server, error) {
+	var out Server
+	if err := c.Write(ctx, "CreateServer", CreateServerParams{Name: name, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateServer applies a partial config update to the server with the given
+// name or id.
+func (c *Client) UpdateServer(ctx context.Context, id string, config ServerConfig) (*Server, error) {
+	var out Server
+	if err := c.Write(ctx, "UpdateServer", UpdateServerParams{ID: id, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteServer deletes the server with the given name or id.
+func (c *Client) DeleteServer(ctx context.Context, id string) error {
+	return c.Write(ctx, "DeleteServer", DeleteServerParams{ID: id}, nil, RetryOnKinds(ErrorKindBusy))
+}
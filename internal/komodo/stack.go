@@ -0,0 +1,123 @@
+package komodo
+
+import "context"
+
+// StackConfig is the config block of a Komodo stack. As with ServerConfig,
+// nil fields are omitted so the type doubles as a partial config for
+// updates.
+type StackConfig struct {
+	// ServerID is the id (or name) of the server the stack is deployed on.
+	ServerID *string `json:"server_id,omitempty"`
+	// FileContents is a compose file defined in the UI rather than in a
+	// repository or on the host.
+	FileContents *string `json:"file_contents,omitempty"`
+	Repo         *string `json:"repo,omitempty"`
+	Branch       *string `json:"branch,omitempty"`
+	GitProvider  *string `json:"git_provider,omitempty"`
+	GitAccount   *string `json:"git_account,omitempty"`
+	// FilePaths are the compose files, relative to RunDirectory. Empty means
+	// compose.yaml.
+	FilePaths *[]string `json:"file_paths,omitempty"`
+	// FilesOnHost reads the compose files from RunDirectory on the server
+	// instead of a repository or FileContents.
+	FilesOnHost  *bool   `json:"files_on_host,omitempty"`
+	RunDirectory *string `json:"run_directory,omitempty"`
+	// Environment is written to the stack's .env file, one KEY=value per
+	// line.
+	Environment *string `json:"environment,omitempty"`
+	// Reclone deletes and clones the repository again on each deploy
+	// instead of pulling.
+	Reclone *bool `json:"reclone,omitempty"`
+}
+
+// Stack is a Komodo stack: a docker compose project on one server.
+type Stack struct {
+	ID          ObjectID    `json:"_id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Tags        []string    `json:"tags"`
+	Config      StackConfig `json:"config"`
+}
+
+type GetStackParams struct {
+	Stack string `json:"stack"`
+}
+
+type CreateStackParams struct {
+	Name   string      `json:"name"`
+	Config StackConfig `json:"config"`
+}
+
+type UpdateStackParams struct {
+	ID     string      `json:"id"`
+	Config StackConfig `json:"config"`
+}
+
+type DeleteStackParams struct {
+	ID string `json:"id"`
+}
+
+type DeployStackParams struct {
+	Stack string `json:"stack"`
+	// Services limits the deploy to these services; empty deploys all.
+	Services []string `json:"services"`
+}
+
+type DestroyStackParams struct {
+	Stack         string   `json:"stack"`
+	Services      []string `json:"services"`
+	RemoveOrphans bool     `json:"remove_orphans"`
+}
+
+// GetStack looks a stack up by name or id.
+func (c *Client) GetStack(ctx context.Context, stack string) (*Stack, error) {
+	var out Stack
+	if err := c.Read(ctx, "GetStack", GetStackParams{Stack: stack}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateStack creates a new stack.
+func (c *Client) CreateStack(ctx context.Context, name string, config StackConfig) (*Stack, error) {
+	var out Stack
+	if err := c.Write(ctx, "CreateStack", CreateStackParams{Name: name, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateStack applies a partial config update to a stack.
+func (c *Client) UpdateStack(ctx context.Context, id string, config StackConfig) (*Stack, error) {
+	var out Stack
+	if err := c.Write(ctx, "UpdateStack", UpdateStackParams{ID: id, Config: config}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteStack deletes the stack with the given name or id. It does not take
+// down running containers; use DestroyStack first for that.
+func (c *Client) DeleteStack(ctx context.Context, id string) error {
+	return c.Write(ctx, "DeleteStack", DeleteStackParams{ID: id}, nil, RetryOnKinds(ErrorKindBusy))
+}
+
+// DeployStack queues a `docker compose up` of the stack and returns its
+// Update.
+func (c *Client) DeployStack(ctx context.Context, stack string) (*Update, error) {
+	var out Update
+	if err := c.Execute(ctx, "DeployStack", DeployStackParams{Stack: stack, Services: []string{}}, &out, RetryOnKinds(ErrorKindBusy)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DestroyStack queues a `docker compose down` of the stack and returns its
+// Update.
+func (c *Client) DestroyStack(ctx context.Context, stack string) (*Update, error) {
+	var out Update
+	if err := c.Execute(ctx, "DestroyStack", DestroyStackParams{Stack: stack, Services: []string{}}, &out, RetryOnKinds(ErrorKindBusy)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
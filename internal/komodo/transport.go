@@ -0,0 +1,121 @@
+package komodo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultTimeout bounds a single Komodo API request when TransportConfig sets
+// no timeout.
+const DefaultTimeout = 60 * time.Second
+
+// TransportConfig describes how to reach a Komodo core that sits behind an
+// internal CA, a client-certificate or header authenticating reverse proxy,
+// or an HTTP proxy.
+type TransportConfig struct {
+	// CACertFile is a PEM bundle of CAs trusted in addition to the system
+	// roots.
+	CACertFile string
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key presented
+	// for mutual TLS. Both or neither must be set.
+	ClientCertFile string
+	ClientKeyFile  string
+	// InsecureSkipVerify disables server certificate verification. Only
+	// meant for lab setups.
+	InsecureSkipVerify bool
+	// ProxyURL routes requests through an HTTP(S) proxy. When empty the
+	// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables apply.
+	ProxyURL string
+	// Headers are added to every request, e.g. for an authenticating reverse
+	// proxy. They never replace the headers the client sets itself.
+	Headers map[string]string
+	// Timeout bounds each request. Zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// NewHTTPClient returns an *http.Client whose transport applies cfg. The
+// same client should be shared by every call to a core so connections are
+// reused.
+func NewHTTPClient(cfg TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CACertFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		if proxy.Scheme == "" || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: scheme and host are required", cfg.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	var rt http.RoundTripper = transport
+	if len(cfg.Headers) > 0 {
+		headers := make(http.Header, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			headers.Set(k, v)
+		}
+		rt = &headerTransport{headers: headers, base: rt}
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Transport: rt, Timeout: timeout}, nil
+}
+
+// headerTransport adds static headers to each request that does not already
+// carry them.
+type headerTransport struct {
+	headers http.Header
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		if req.Header.Get(k) == "" {
+			req.Header[k] = v
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,138 @@
+package komodo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ObjectID is a Mongo object id. Komodo serialises ids either as a plain
+// string or as {"$oid": "<hex>"}; both forms are accepted.
+type ObjectID string
+
+func (id *ObjectID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = ObjectID(s)
+		return nil
+	}
+	var oid struct {
+		OID string `json:"$oid"`
+	}
+	if err := json.Unmarshal(data, &oid); err != nil {
+		return err
+	}
+	*id = ObjectID(oid.OID)
+	return nil
+}
+
+func (id ObjectID) String() string {
+	return string(id)
+}
+
+// ResourceTarget identifies the resource an Update applies to.
+type ResourceTarget struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// UpdateStatus is the lifecycle state of an Update.
+type UpdateStatus string
+
+const (
+	UpdateStatusQueued     UpdateStatus = "Queued"
+	UpdateStatusInProgress UpdateStatus = "InProgress"
+	UpdateStatusComplete   UpdateStatus = "Complete"
+)
+
+// Log is a single stage log attached to an Update.
+type Log struct {
+	Stage   string `json:"stage"`
+	Command string `json:"command"`
+	Stdout  string `json:"stdout"`
+	Stderr  string `json:"stderr"`
+	Success bool   `json:"success"`
+	StartTs int64  `json:"start_ts"`
+	EndTs   int64  `json:"end_ts"`
+}
+
+// Update is Komodo's record of an operation. Every execute request returns
+// the Update it created.
+type Update struct {
+	ID        ObjectID       `json:"_id"`
+	Operation string         `json:"operation"`
+	Operator  string         `json:"operator"`
+	Target    ResourceTarget `json:"target"`
+	Status    UpdateStatus   `json:"status"`
+	Success   bool           `json:"success"`
+	Logs      []Log          `json:"logs"`
+	StartTs   int64          `json:"start_ts"`
+	EndTs     *int64         `json:"end_ts,omitempty"`
+}
+
+// Err returns an *UpdateError if the Update has completed without success,
+// and nil otherwise.
+func (u *Update) Err() error {
+	if u.Status != UpdateStatusComplete || u.Success {
+		return nil
+	}
+	var failed []Log
+	for _, log := range u.Logs {
+		if !log.Success {
+			failed = append(failed, log)
+		}
+	}
+	return &UpdateError{Operation: u.Operation, Target: u.Target, Logs: failed}
+}
+
+// UpdateError describes an execution that Komodo reported as failed.
+type UpdateError struct {
+	Operation string
+	Target    ResourceTarget
+	// Logs holds the logs of the stages that failed.
+	Logs []Log
+}
+
+// maxLogOutput caps how much of each failed stage's output ends up in the
+// error message.
+const maxLogOutput = 2000
+
+func (e *UpdateError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s failed", e.Operation)
+	if e.Target.ID != "" {
+		fmt.Fprintf(&b, " for %s %s", e.Target.Type, e.Target.ID)
+	}
+	for _, log := range e.Logs {
+		fmt.Fprintf(&b, "\n\nstage %q failed", log.Stage)
+		if log.Command != "" {
+			fmt.Fprintf(&b, " running %q", log.Command)
+		}
+		output := strings.TrimSpace(log.Stderr)
+		if output == "" {
+			output = strings.TrimSpace(log.Stdout)
+		}
+		if len(output) > maxLogOutput {
+			output = "..." + output[len(output)-maxLogOutput:]
+		}
+		if output != "" {
+			fmt.Fprintf(&b, ":\n%s", Redact(output))
+		}
+	}
+	return b.String()
+}
+
+// GetUpdateParams are the params of the GetUpdate read request.
+type GetUpdateParams struct {
+	ID string `json:"id"`
+}
+
+// GetUpdate fetches an Update by id.
+func (c *Client) GetUpdate(ctx context.Context, id string) (*Update, error) {
+	var update Update
+	if err := c.Read(ctx, "GetUpdate", GetUpdateParams{ID: id}, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
@@ -0,0 +1,7 @@
+package komodo
+
+// Ptr returns a pointer to v. It is a convenience for filling in the pointer
+// fields of partial config structs.
+func Ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+// Phases of creating a client deployment, in order. Each is recorded in the
+// create checkpoint once it has finished.
+const (
+	// phaseRepository creates the sync repository (git mode only).
+	phaseRepository = "repository"
+	// phaseServer waits for the server to register, enables it and waits for
+	// it to come online.
+	phaseServer = "server"
+	// phaseSyncs creates and runs the ContextWare and ResourceSetup syncs.
+	phaseSyncs = "syncs"
+	// phaseProcedure runs the apply procedure. Once it has finished the
+	// deployment is complete and the checkpoint is dropped.
+	phaseProcedure = "procedure"
+)
+
+// createCheckpointKey is the private state key holding the checkpoint of a
+// deployment whose Create failed with rollback_on_failure = false.
+const createCheckpointKey = "create_checkpoint"
+
+// createCheckpoint records how far Create got, so that the next apply can
+// pick up from the failed phase instead of starting over.
+type createCheckpoint struct {
+	Completed []string `json:"completed"`
+	// ContentsSHA256 is the hash of the file_contents pushed to the sync
+	// repository or inline sync, so a resume can tell whether they changed.
+	ContentsSHA256 string `json:"contents_sha256,omitempty"`
+}
+
+// done reports whether phase has finished. A nil checkpoint stands for a
+// deployment created completely, so every phase is done.
+func (c *createCheckpoint) done(phase string) bool {
+	return c == nil || slices.Contains(c.Completed, phase)
+}
+
+func (c *createCheckpoint) complete(phase string) {
+	if !c.done(phase) {
+		c.Completed = append(c.Completed, phase)
+	}
+}
+
+// reset forgets phase, so that it runs again on resume.
+func (c *createCheckpoint) reset(phase string) {
+	c.Completed = slices.DeleteFunc(c.Completed, func(p string) bool { return p == phase })
+}
+
+// contentsSHA256 returns the hex SHA-256 of file contents.
+func contentsSHA256(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+// privateStateGetter and privateStateSetter are implemented by the Private
+// field of the framework's resource requests and responses.
+type privateStateGetter interface {
+	GetKey(ctx context.Context, key string) ([]byte, diag.Diagnostics)
+}
+
+type privateStateSetter interface {
+	SetKey(ctx context.Context, key string, value []byte) diag.Diagnostics
+}
+
+// getCreateCheckpoint returns the checkpoint stored in private, or nil if
+// the deployment was created completely.
+func getCreateCheckpoint(ctx context.Context, private privateStateGetter) (*createCheckpoint, diag.Diagnostics) {
+	data, diags := private.GetKey(ctx, createCheckpointKey)
+	if diags.HasError() || len(data) == 0 {
+		return nil, diags
+	}
+	var checkpoint createCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		diags.AddError("Invalid Private State", "Error decoding the create checkpoint: "+err.Error())
+		return nil, diags
+	}
+	return &checkpoint, diags
+}
+
+// setCreateCheckpoint stores checkpoint in private. A nil checkpoint removes
+// it.
+func setCreateCheckpoint(ctx context.Context, private privateStateSetter, checkpoint *createCheckpoint) diag.Diagnostics {
+	if checkpoint == nil {
+		return private.SetKey(ctx, createCheckpointKey, nil)
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		var diags diag.Diagnostics
+		diags.AddError("Invalid Private State", "Error encoding the create checkpoint: "+err.Error())
+		return diags
+	}
+	return private.SetKey(ctx, createCheckpointKey, data)
+}
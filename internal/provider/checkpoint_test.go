@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+// fakePrivateState stands in for the framework's private state data.
+type fakePrivateState map[string][]byte
+
+func (p fakePrivateState) GetKey(ctx context.Context, key string) ([]byte, diag.Diagnostics) {
+	return p[key], nil
+}
+
+func (p fakePrivateState) SetKey(ctx context.Context, key string, value []byte) diag.Diagnostics {
+	if len(value) == 0 {
+		delete(p, key)
+		return nil
+	}
+	p[key] = value
+	return nil
+}
+
+func TestCreateCheckpointRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	private := fakePrivateState{}
+
+	checkpoint, diags := getCreateCheckpoint(ctx, private)
+	if diags.HasError() || checkpoint != nil {
+		t.Fatalf("empty private state = %+v, %v; want no checkpoint", checkpoint, diags)
+	}
+
+	want := &createCheckpoint{ContentsSHA256: contentsSHA256("[[stack]]\n")}
+	want.complete(phaseRepository)
+	want.complete(phaseServer)
+	if diags := setCreateCheckpoint(ctx, private, want); diags.HasError() {
+		t.Fatalf("setCreateCheckpoint: %v", diags)
+	}
+	got, diags := getCreateCheckpoint(ctx, private)
+	if diags.HasError() {
+		t.Fatalf("getCreateCheckpoint: %v", diags)
+	}
+	if got == nil || !slices.Equal(got.Completed, want.Completed) || got.ContentsSHA256 != want.ContentsSHA256 {
+		t.Fatalf("round trip = %+v, want %+v", got, want)
+	}
+
+	if diags := setCreateCheckpoint(ctx, private, nil); diags.HasError() {
+		t.Fatalf("clearing checkpoint: %v", diags)
+	}
+	if got, _ := getCreateCheckpoint(ctx, private); got != nil {
+		t.Errorf("cleared checkpoint = %+v, want nil", got)
+	}
+}
+
+func TestCreateCheckpointInvalid(t *testing.T) {
+	private := fakePrivateState{createCheckpointKey: []byte("{not json")}
+	if _, diags := getCreateCheckpoint(context.Background(), private); !diags.HasError() {
+		t.Error("decoding an invalid checkpoint succeeded")
+	}
+}
+
+func TestCreateCheckpointPhases(t *testing.T) {
+	var checkpoint createCheckpoint
+	checkpoint.complete(phaseServer)
+	checkpoint.complete(phaseSyncs)
+	checkpoint.complete(phaseServer)
+	if !slices.Equal(checkpoint.Completed, []string{phaseServer, phaseSyncs}) {
+		t.Errorf("Completed = %v, want each phase once", checkpoint.Completed)
+	}
+
+	checkpoint.reset(phaseSyncs)
+	if checkpoint.done(phaseSyncs) || !checkpoint.done(phaseServer) {
+		t.Errorf("after reset Completed = %v, want only %s", checkpoint.Completed, phaseServer)
+	}
+}
+
+func TestRestorePEMHeaders(t *testing.T) {
+	if got := restorePEMHeaders(""); got != "" {
+		t.Errorf("restorePEMHeaders(\"\") = %q, want empty", got)
+	}
+
+	r := &komodoResource{}
+	privateKey, _, err := r.generateSSHKeyPair()
+	if err != nil {
+		t.Fatalf("generating key pair: %s", err)
+	}
+	if got := restorePEMHeaders(stripPEMHeaders(privateKey)); got != privateKey {
+		t.Errorf("restorePEMHeaders(stripPEMHeaders(key)) = %q, want %q", got, privateKey)
+	}
+}
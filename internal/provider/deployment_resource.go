@@ -0,0 +1,537 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/mapvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+var _ tfresource.Resource = &deploymentResource{}
+var _ tfresource.ResourceWithImportState = &deploymentResource{}
+
+// defaultDeploymentTimeout bounds create, update and delete of a deployment,
+// mostly the image pull of a deploy.
+const defaultDeploymentTimeout = 15 * time.Minute
+
+// deploymentResource manages a Komodo deployment: a single container, for
+// clients that do not need a compose stack.
+type deploymentResource struct {
+	client      *komodo.Client
+	serverLocks *serverLocks
+	logSecrets  []string
+}
+
+type DeploymentModel struct {
+	Id              tftypes.String `tfsdk:"id"`
+	Name            tftypes.String `tfsdk:"name"`
+	ServerID        tftypes.String `tfsdk:"server_id"`
+	Image           tftypes.String `tfsdk:"image"`
+	BuildID         tftypes.String `tfsdk:"build_id"`
+	Ports           tftypes.List   `tfsdk:"ports"`
+	Volumes         tftypes.List   `tfsdk:"volumes"`
+	Environment     tftypes.Map    `tfsdk:"environment"`
+	Labels          tftypes.Map    `tfsdk:"labels"`
+	Restart         tftypes.String `tfsdk:"restart"`
+	Network         tftypes.String `tfsdk:"network"`
+	RedeployOnBuild tftypes.Bool   `tfsdk:"redeploy_on_build"`
+	DeployOnChange  tftypes.Bool   `tfsdk:"deploy_on_change"`
+	DestroyOnDelete tftypes.Bool   `tfsdk:"destroy_on_delete"`
+	Timeouts        timeouts.Value `tfsdk:"timeouts"`
+}
+
+func NewDeploymentResource() tfresource.Resource {
+	return &deploymentResource{}
+}
+
+func (r *deploymentResource) Metadata(ctx context.Context, req tfresource.MetadataRequest, resp *tfresource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_deployment"
+}
+
+func (r *deploymentResource) Schema(ctx context.Context, req tfresource.SchemaRequest, resp *tfresource.SchemaResponse) {
+	resp.Schema = tfschema.Schema{
+		MarkdownDescription: "A Komodo deployment: a single container on one server",
+		Attributes: map[string]tfschema.Attribute{
+			"id": tfschema.StringAttribute{
+				MarkdownDescription: "The Komodo id of the deployment",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": tfschema.StringAttribute{
+				MarkdownDescription: "The name of the deployment, also used for its container. Changing it replaces the deployment",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"server_id": tfschema.StringAttribute{
+				MarkdownDescription: "Id or name of the server to run on, e.g. `komodo-provider_server.edge.id`",
+				Optional:            true,
+			},
+			"image": tfschema.StringAttribute{
+				MarkdownDescription: "The image to run, e.g. `ghcr.io/acme/app:1.4.2`. Exactly one of `image` and `build_id` must be set",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.ExactlyOneOf(tfpath.MatchRoot("build_id")),
+				},
+			},
+			"build_id": tfschema.StringAttribute{
+				MarkdownDescription: "Id of a Komodo build whose latest image to run, instead of `image`",
+				Optional:            true,
+			},
+			"ports": tfschema.ListAttribute{
+				MarkdownDescription: "Published ports, as `host:container`",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+			},
+			"volumes": tfschema.ListAttribute{
+				MarkdownDescription: "Mounted volumes, as `host_path:container_path`",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+			},
+			"environment": tfschema.MapAttribute{
+				MarkdownDescription: "Environment variables of the container. Values must be single lines",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+				Sensitive:           true,
+				Validators:          assignmentValidators,
+			},
+			"labels": tfschema.MapAttribute{
+				MarkdownDescription: "Docker labels of the container. Values must be single lines",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+				Validators:          assignmentValidators,
+			},
+			"restart": tfschema.StringAttribute{
+				MarkdownDescription: "Restart policy: `no`, `on-failure`, `always` or `unless-stopped`. Defaults to Komodo's default, `unless-stopped`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+				Validators: []validator.String{
+					stringvalidator.OneOf("no", "on-failure", "always", "unless-stopped"),
+				},
+			},
+			"network": tfschema.StringAttribute{
+				MarkdownDescription: "Docker network to attach the container to. Defaults to Komodo's default, `host`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"redeploy_on_build": tfschema.BoolAttribute{
+				MarkdownDescription: "Redeploy whenever the Komodo build in `build_id` finishes",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"deploy_on_change": tfschema.BoolAttribute{
+				MarkdownDescription: "Deploy the container after the deployment is created and whenever its configuration changes, and wait for the deploy to finish",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"destroy_on_delete": tfschema.BoolAttribute{
+				MarkdownDescription: "Run `Destroy` and wait for the container to be removed before deleting the deployment, so a failure to remove it fails the destroy",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+		},
+		Blocks: map[string]tfschema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *deploymentResource) Configure(ctx context.Context, req tfresource.ConfigureRequest, resp *tfresource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	provider, ok := req.ProviderData.(*KomodoProvider)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *KomodoProvider, got: %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = provider.client
+	r.serverLocks = provider.serverLocks
+	r.logSecrets = provider.logSecrets()
+}
+
+func (r *deploymentResource) Create(ctx context.Context, req tfresource.CreateRequest, resp *tfresource.CreateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data DeploymentModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultDeploymentTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	config, diags := deploymentConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "deployment", name)
+	tflog.SubsystemInfo(ctx, logSubsystem, "Creating deployment")
+	deployment, err := r.client.CreateDeployment(ctx, name, config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("creating deployment %q", name), err)
+		return
+	}
+
+	// An image that fails to pull or start does not remove the deployment,
+	// so record it before deploying.
+	resp.Diagnostics.Append(r.setDeploymentModel(ctx, &data, deployment)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.DeployOnChange.ValueBool() {
+		r.deploy(ctx, deployment, createTimeout, &resp.Diagnostics)
+	}
+}
+
+func (r *deploymentResource) Read(ctx context.Context, req tfresource.ReadRequest, resp *tfresource.ReadResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data DeploymentModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deployment, err := r.client.GetDeployment(ctx, data.Id.ValueString())
+	if err != nil {
+		if komodo.IsNotFound(err) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("reading deployment %q", data.Id.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setDeploymentModel(ctx, &data, deployment)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *deploymentResource) Update(ctx context.Context, req tfresource.UpdateRequest, resp *tfresource.UpdateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data, prior DeploymentModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultDeploymentTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	config, diags := deploymentConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	priorConfig, diags := deploymentConfig(ctx, prior)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	changed := !reflect.DeepEqual(config, priorConfig)
+
+	clearRemoved(data.ServerID, prior.ServerID, &config.ServerID, "")
+	clearRemoved(data.Ports, prior.Ports, &config.Ports, "")
+	clearRemoved(data.Volumes, prior.Volumes, &config.Volumes, "")
+	clearRemoved(data.Environment, prior.Environment, &config.Environment, "")
+	clearRemoved(data.Labels, prior.Labels, &config.Labels, "")
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "deployment", name)
+	deployment, err := r.client.UpdateDeployment(ctx, data.Id.ValueString(), config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating deployment %q", name), err)
+		return
+	}
+
+	// As for stacks, the new config is only recorded once it is deployed,
+	// so that a failed deploy stays in the plan.
+	if changed && data.DeployOnChange.ValueBool() && !r.deploy(ctx, deployment, updateTimeout, &resp.Diagnostics) {
+		r.restore(ctx, data, prior, priorConfig, &resp.Diagnostics)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &prior)...)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setDeploymentModel(ctx, &data, deployment)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// restore puts the config of prior back on the deployment after the update
+// to data failed to deploy.
+func (r *deploymentResource) restore(ctx context.Context, data, prior DeploymentModel, config komodo.DeploymentConfig, diags *diag.Diagnostics) {
+	// ctx may have run out during the deploy.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	clearRemoved(prior.ServerID, data.ServerID, &config.ServerID, "")
+	clearRemoved(prior.Ports, data.Ports, &config.Ports, "")
+	clearRemoved(prior.Volumes, data.Volumes, &config.Volumes, "")
+	clearRemoved(prior.Environment, data.Environment, &config.Environment, "")
+	clearRemoved(prior.Labels, data.Labels, &config.Labels, "")
+
+	tflog.SubsystemWarn(ctx, logSubsystem, "Deploy failed, restoring the prior deployment config")
+	if _, err := r.client.UpdateDeployment(ctx, prior.Id.ValueString(), config); err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("restoring deployment %q after the failed deploy", prior.Name.ValueString()), err)
+	}
+}
+
+func (r *deploymentResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data DeploymentModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultDeploymentTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "deployment", name)
+
+	if data.DestroyOnDelete.ValueBool() && !r.destroy(ctx, data, deleteTimeout, &resp.Diagnostics) {
+		return
+	}
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deleting deployment")
+	if err := r.client.DeleteDeployment(ctx, data.Id.ValueString()); err != nil && !komodo.IsNotFound(err) {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("deleting deployment %q", name), err)
+	}
+}
+
+// ImportState adopts an existing deployment by id or name.
+func (r *deploymentResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
+	tfresource.ImportStatePassthroughID(ctx, tfpath.Root("id"), req, resp)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, tfpath.Root("deploy_on_change"), false)...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, tfpath.Root("destroy_on_delete"), false)...)
+}
+
+// deploy runs Deploy and waits for it to finish. It reports whether the
+// deploy succeeded.
+func (r *deploymentResource) deploy(ctx context.Context, deployment *komodo.Deployment, timeout time.Duration, diags *diag.Diagnostics) bool {
+	unlock, err := r.serverLocks.lockServerOf(ctx, r.client, deref(deployment.Config.ServerID))
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("waiting for other work on the server of deployment %q", deployment.Name), err)
+		return false
+	}
+	defer unlock()
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deploying deployment")
+	update, err := r.client.DeployDeployment(ctx, deployment.ID.String())
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("deploying deployment %q", deployment.Name), err)
+		return false
+	}
+	if err := waitForUpdate(ctx, r.client, update, timeout); err != nil {
+		addAPIError(diags, "Deployment Error", fmt.Sprintf("deploying deployment %q", deployment.Name), err)
+		return false
+	}
+	return true
+}
+
+// destroy runs Destroy and waits for it to finish. It reports whether the
+// deployment can be deleted next, which it cannot when the destroy failed
+// or the deployment is already gone.
+func (r *deploymentResource) destroy(ctx context.Context, data DeploymentModel, timeout time.Duration, diags *diag.Diagnostics) bool {
+	name := data.Name.ValueString()
+	unlock, err := r.serverLocks.lockServerOf(ctx, r.client, data.ServerID.ValueString())
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("waiting for other work on the server of deployment %q", name), err)
+		return false
+	}
+	defer unlock()
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Destroying deployment")
+	update, err := r.client.DestroyDeployment(ctx, data.Id.ValueString())
+	if err != nil {
+		if !komodo.IsNotFound(err) {
+			addAPIError(diags, "API Error", fmt.Sprintf("destroying deployment %q", name), err)
+		}
+		return false
+	}
+	if err := waitForUpdate(ctx, r.client, update, timeout); err != nil {
+		addAPIError(diags, "Deployment Error", fmt.Sprintf("destroying deployment %q", name), err)
+		return false
+	}
+	return true
+}
+
+// deploymentConfig builds the Komodo config for the attributes set in data.
+// Komodo takes ports, volumes, environment and labels as one entry per line.
+func deploymentConfig(ctx context.Context, data DeploymentModel) (komodo.DeploymentConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	lines := func(v tftypes.List) *string {
+		entries, d := stringsPtr(ctx, v)
+		diags.Append(d...)
+		if entries == nil {
+			return nil
+		}
+		return komodo.Ptr(strings.Join(*entries, "\n"))
+	}
+	assignments := func(v tftypes.Map) *string {
+		if v.IsNull() || v.IsUnknown() {
+			return nil
+		}
+		values := map[string]string{}
+		diags.Append(v.ElementsAs(ctx, &values, false)...)
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]string, 0, len(keys))
+		for _, key := range keys {
+			entries = append(entries, key+"="+values[key])
+		}
+		return komodo.Ptr(strings.Join(entries, "\n"))
+	}
+
+	config := komodo.DeploymentConfig{
+		ServerID:        stringPtr(data.ServerID),
+		Ports:           lines(data.Ports),
+		Volumes:         lines(data.Volumes),
+		Environment:     assignments(data.Environment),
+		Labels:          assignments(data.Labels),
+		Restart:         stringPtr(data.Restart),
+		Network:         stringPtr(data.Network),
+		RedeployOnBuild: boolPtr(data.RedeployOnBuild),
+	}
+	if image := stringPtr(data.Image); image != nil {
+		config.Image = komodo.ImageDeployment(*image)
+	}
+	if buildID := stringPtr(data.BuildID); buildID != nil {
+		config.Image = komodo.BuildDeployment(*buildID)
+	}
+	return config, diags
+}
+
+// setDeploymentModel copies deployment into data.
+func (r *deploymentResource) setDeploymentModel(ctx context.Context, data *DeploymentModel, deployment *komodo.Deployment) diag.Diagnostics {
+	var diags, d diag.Diagnostics
+	config := deployment.Config
+	data.Id = tftypes.StringValue(deployment.ID.String())
+	data.Name = tftypes.StringValue(deployment.Name)
+	data.ServerID = serverReference(ctx, r.client, data.ServerID, deref(config.ServerID))
+	if config.Image != nil {
+		switch config.Image.Type {
+		case komodo.DeploymentImageTypeImage:
+			data.Image = tftypes.StringValue(config.Image.Params.Image)
+			data.BuildID = tftypes.StringNull()
+		case komodo.DeploymentImageTypeBuild:
+			data.Image = tftypes.StringNull()
+			data.BuildID = tftypes.StringValue(config.Image.Params.BuildID)
+		default:
+			diags.AddError("Unsupported Deployment Image",
+				fmt.Sprintf("Deployment %q runs an image of type %q, which this provider cannot manage.", deployment.Name, config.Image.Type))
+		}
+	}
+	data.Restart = tftypes.StringValue(deref(config.Restart))
+	data.Network = tftypes.StringValue(deref(config.Network))
+	data.RedeployOnBuild = tftypes.BoolValue(deref(config.RedeployOnBuild))
+
+	data.Ports, d = optionalStrings(ctx, data.Ports, splitLines(deref(config.Ports)))
+	diags.Append(d...)
+	data.Volumes, d = optionalStrings(ctx, data.Volumes, splitLines(deref(config.Volumes)))
+	diags.Append(d...)
+	data.Environment, d = optionalAssignments(ctx, data.Environment, deref(config.Environment))
+	diags.Append(d...)
+	data.Labels, d = optionalAssignments(ctx, data.Labels, deref(config.Labels))
+	diags.Append(d...)
+	return diags
+}
+
+// splitLines returns the non-blank lines of s, trimmed, leaving out
+// comments.
+func splitLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// assignmentValidators check the maps Komodo stores as KEY=value lines: a key
+// cannot hold "=" and a value cannot span lines, and neither can have
+// surrounding whitespace, which does not survive the round trip.
+var assignmentValidators = []validator.Map{
+	mapvalidator.KeysAre(stringvalidator.RegexMatches(regexp.MustCompile(`^[^=\s#][^=\s]*$`),
+		"must be non-empty and must not start with \"#\" or contain \"=\" or whitespace")),
+	mapvalidator.ValueStringsAre(stringvalidator.RegexMatches(regexp.MustCompile(`^(\S|\S[^\r\n]*\S)?$`),
+		"must be a single line without leading or trailing whitespace")),
+}
+
+// optionalAssignments parses KEY=value lines into a map, keeping prior null
+// when there are none.
+func optionalAssignments(ctx context.Context, prior tftypes.Map, s string) (tftypes.Map, diag.Diagnostics) {
+	values := map[string]string{}
+	for _, line := range splitLines(s) {
+		key, value, _ := strings.Cut(line, "=")
+		values[strings.TrimSpace(key)] = value
+	}
+	if len(values) == 0 && prior.IsNull() {
+		return prior, nil
+	}
+	return tftypes.MapValueFrom(ctx, tftypes.StringType, values)
+}
@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestAssignmentValidators(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr bool
+	}{
+		{"plain", map[string]string{"DATABASE_URL": "postgres://db/app?sslmode=disable"}, false},
+		{"empty value", map[string]string{"DEBUG": ""}, false},
+		{"inner spaces", map[string]string{"GREETING": "hello world"}, false},
+		{"label key", map[string]string{"traefik.http.routers.app.rule": "Host(`app.example.com`)"}, false},
+		{"newline", map[string]string{"CERT": "line1\nline2"}, true},
+		{"carriage return", map[string]string{"CERT": "line1\r"}, true},
+		{"trailing space", map[string]string{"NAME": "app "}, true},
+		{"equals in key", map[string]string{"A=B": "c"}, true},
+		{"comment key", map[string]string{"#KEY": "c"}, true},
+		{"empty key", map[string]string{"": "c"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, diags := tftypes.MapValueFrom(context.Background(), tftypes.StringType, tt.values)
+			if diags.HasError() {
+				t.Fatalf("building map: %v", diags)
+			}
+			req := validator.MapRequest{Path: tfpath.Root("environment"), ConfigValue: value}
+			var resp validator.MapResponse
+			for _, v := range assignmentValidators {
+				v.ValidateMap(context.Background(), req, &resp)
+			}
+			if got := resp.Diagnostics.HasError(); got != tt.wantErr {
+				t.Errorf("validation error = %t, want %t: %v", got, tt.wantErr, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestAssignmentsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	values := map[string]string{"DATABASE_URL": "postgres://u:p@db/app", "EMPTY": "", "GREETING": "hello = world"}
+	environment, diags := tftypes.MapValueFrom(ctx, tftypes.StringType, values)
+	if diags.HasError() {
+		t.Fatalf("building map: %v", diags)
+	}
+
+	config, diags := deploymentConfig(ctx, DeploymentModel{
+		Image:       tftypes.StringValue("nginx:1.27"),
+		Environment: environment,
+		Labels:      tftypes.MapNull(tftypes.StringType),
+	})
+	if diags.HasError() {
+		t.Fatalf("deploymentConfig: %v", diags)
+	}
+	got, diags := optionalAssignments(ctx, tftypes.MapNull(tftypes.StringType), deref(config.Environment))
+	if diags.HasError() {
+		t.Fatalf("optionalAssignments: %v", diags)
+	}
+	if !got.Equal(environment) {
+		t.Errorf("environment read back as %s, want %s", got, environment)
+	}
+}
+
+func TestDeploymentImageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	r := &deploymentResource{}
+	tests := []struct {
+		name        string
+		image       *komodo.DeploymentImage
+		wantImage   tftypes.String
+		wantBuildID tftypes.String
+		wantErr     bool
+	}{
+		{"image", komodo.ImageDeployment("nginx:1.27"), tftypes.StringValue("nginx:1.27"), tftypes.StringNull(), false},
+		{"build", komodo.BuildDeployment("6650f1"), tftypes.StringNull(), tftypes.StringValue("6650f1"), false},
+		{"unknown type", &komodo.DeploymentImage{Type: "Registry"}, tftypes.StringNull(), tftypes.StringNull(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := DeploymentModel{
+				Image:       tftypes.StringNull(),
+				BuildID:     tftypes.StringNull(),
+				ServerID:    tftypes.StringNull(),
+				Ports:       tftypes.ListNull(tftypes.StringType),
+				Volumes:     tftypes.ListNull(tftypes.StringType),
+				Environment: tftypes.MapNull(tftypes.StringType),
+				Labels:      tftypes.MapNull(tftypes.StringType),
+			}
+			diags := r.setDeploymentModel(ctx, &data, &komodo.Deployment{ID: "d1", Name: "app", Config: komodo.DeploymentConfig{Image: tt.image}})
+			if got := diags.HasError(); got != tt.wantErr {
+				t.Fatalf("setDeploymentModel error = %t, want %t: %v", got, tt.wantErr, diags)
+			}
+			if !data.Image.Equal(tt.wantImage) || !data.BuildID.Equal(tt.wantBuildID) {
+				t.Errorf("image, build_id = %s, %s; want %s, %s", data.Image, data.BuildID, tt.wantImage, tt.wantBuildID)
+			}
+		})
+	}
+}
+
+func TestDeploymentUpdateDeployOnChange(t *testing.T) {
+	ctx := context.Background()
+	core, client := newFakeCore(t, map[string]any{
+		"server_id":         "srv1",
+		"image":             map[string]any{"type": "Image", "params": map[string]any{"image": "nginx:1.26"}},
+		"restart":           "unless-stopped",
+		"network":           "host",
+		"redeploy_on_build": false,
+	})
+	r := &deploymentResource{client: client, serverLocks: newServerLocks()}
+
+	prior := DeploymentModel{
+		Id:              tftypes.StringValue("s1"),
+		Name:            tftypes.StringValue("app"),
+		ServerID:        tftypes.StringValue("edge"),
+		Image:           tftypes.StringValue("nginx:1.26"),
+		Ports:           tftypes.ListNull(tftypes.StringType),
+		Volumes:         tftypes.ListNull(tftypes.StringType),
+		Environment:     tftypes.MapNull(tftypes.StringType),
+		Labels:          tftypes.MapNull(tftypes.StringType),
+		Restart:         tftypes.StringValue("unless-stopped"),
+		Network:         tftypes.StringValue("host"),
+		RedeployOnBuild: tftypes.BoolValue(false),
+		DeployOnChange:  tftypes.BoolValue(true),
+		DestroyOnDelete: tftypes.BoolValue(false),
+		Timeouts:        nullTimeouts(),
+	}
+	labels, diags := tftypes.MapValueFrom(ctx, tftypes.StringType, map[string]string{"team": "web"})
+	if diags.HasError() {
+		t.Fatalf("building labels: %v", diags)
+	}
+	planned := prior
+	planned.Image = tftypes.StringValue("nginx:1.27")
+	planned.Labels = labels
+
+	// After a failed deploy, the refreshed state still differs from the
+	// plan, so the next plan shows the change again.
+	core.failDeploys = true
+	state, diags := testUpdate(t, ctx, r, prior, planned)
+	if !diags.HasError() {
+		t.Fatal("Update with a failing deploy succeeded")
+	}
+	if got := core.sent(); !slices.Contains(got, "Deploy") || got[len(got)-1] != "UpdateDeployment" {
+		t.Errorf("requests = %v, want a deploy followed by restoring the config", got)
+	}
+	state = testRead(t, ctx, r, state)
+	if !state.Image.Equal(prior.Image) || !state.Labels.IsNull() {
+		t.Errorf("image, labels = %s, %s after the failed deploy; want the prior %s, null", state.Image, state.Labels, prior.Image)
+	}
+
+	core.failDeploys = false
+	state, diags = testUpdate(t, ctx, r, state, planned)
+	if diags.HasError() {
+		t.Fatalf("Update: %v", diags)
+	}
+	if got := core.sent(); !slices.Contains(got, "Deploy") {
+		t.Errorf("requests = %v, want the change deployed again", got)
+	}
+	if !state.Image.Equal(planned.Image) || !state.Labels.Equal(planned.Labels) {
+		t.Errorf("image, labels = %s, %s; want the planned ones", state.Image, state.Labels)
+	}
+	if state = testRead(t, ctx, r, state); !state.Image.Equal(planned.Image) {
+		t.Errorf("image = %s after a refresh, want %s", state.Image, planned.Image)
+	}
+}
+
+func TestDeploymentDestroyWaitsForServer(t *testing.T) {
+	core, client := newFakeCore(t, map[string]any{"server_id": "srv1"})
+	r := &deploymentResource{client: client, serverLocks: newServerLocks()}
+
+	// The deployment names its server by name; the lock is held by id.
+	unlock, err := r.serverLocks.lock(context.Background(), "srv1")
+	if err != nil {
+		t.Fatalf("locking server: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	data := DeploymentModel{Id: tftypes.StringValue("s1"), Name: tftypes.StringValue("app"), ServerID: tftypes.StringValue("edge")}
+	var diags diag.Diagnostics
+	if r.destroy(ctx, data, time.Minute, &diags) {
+		t.Fatal("destroy succeeded while the server was locked")
+	}
+	if got := core.sent(); slices.Contains(got, "Destroy") {
+		t.Errorf("requests = %v, want no destroy while the server is locked", got)
+	}
+
+	unlock()
+	diags = nil
+	if !r.destroy(context.Background(), data, time.Minute, &diags) {
+		t.Fatalf("destroy after the server was released: %v", diags)
+	}
+}
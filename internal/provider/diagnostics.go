@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+// addAPIError adds an error diagnostic for a failed Komodo call. action says
+// what was being done to which resource, e.g. `running procedure "x"`. For
+// Komodo API errors the detail lists the failing operation and the cause
+// chain; everything is redacted so echoed resources.toml content does not
+// leak secrets.
+func addAPIError(diags *diag.Diagnostics, summary, action string, err error) {
+	diags.AddError(summary, apiErrorDetail(action, err))
+}
+
+func apiErrorDetail(action string, err error) string {
+	var apiErr *komodo.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Sprintf("Error %s: %s", action, komodo.Redact(err.Error()))
+	}
+
+	causes := apiErr.Causes()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Error %s.\n\n", action)
+	fmt.Fprintf(&b, "Operation: %s (HTTP %s)\n", apiErr.Operation, apiErr.Status)
+	fmt.Fprintf(&b, "Cause: %s", causes[0])
+	if len(causes) > 1 {
+		b.WriteString("\nTrace:")
+		for _, cause := range causes[1:] {
+			fmt.Fprintf(&b, "\n  - %s", cause)
+		}
+	}
+	return b.String()
+}
@@ -1,56 +1,102 @@
 package provider
 
 import (
-	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
-	"encoding/json"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
-	"io"
-	mathrand "math/rand"
-	"net/http"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/google/go-github/v53/github"
-	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
-	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"example.com/me/komodo-provider/internal/githost"
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/oauth2"
 )
 
 var _ tfresource.Resource = &komodoResource{}
 var _ tfresource.ResourceWithImportState = &komodoResource{}
+var _ tfresource.ResourceWithValidateConfig = &komodoResource{}
+
+const (
+	// syncModeGit keeps resources.toml in a <name>_syncresources git host
+	// repository, bootstrapped through the <name>_ContextWare sync.
+	syncModeGit = "git"
+	// syncModeInline stores file_contents directly in the <name>_ResourceSetup
+	// sync, for environments that cannot reach a git host.
+	syncModeInline = "inline"
+)
+
+const (
+	// Creating a deployment waits up to 15 minutes each for the server to
+	// register and to come online, plus the sync and procedure runs.
+	defaultCreateTimeout = 45 * time.Minute
+	defaultUpdateTimeout = 20 * time.Minute
+	defaultDeleteTimeout = 20 * time.Minute
+
+	// cleanupTimeout bounds the rollback that runs when Create fails. It is
+	// detached from the Create context so that it still runs after Ctrl-C or
+	// a create timeout.
+	cleanupTimeout = 5 * time.Minute
+
+	// syncRunTimeout and procedureRunTimeout bound how long we follow the
+	// Update of a RunSync / RunProcedure execution. Procedures deploy stacks
+	// and may pull large images, so they get considerably longer.
+	syncRunTimeout      = 5 * time.Minute
+	procedureRunTimeout = 30 * time.Minute
+)
 
 type komodoResource struct {
-	client        *http.Client
+	client        *komodo.Client
 	endpoint      string
 	apiKey        string
 	apiSecret     string
-	githubToken   string
+	gitHost       githost.Host
+	serverLocks   *serverLocks
+	logSecrets    []string
 	githubOrgname string // Changed from githubUsername
+	gitAccount    string
 }
 
 type KomodoModel struct {
-	Id               tftypes.String `tfsdk:"id"`
-	Name             tftypes.String `tfsdk:"name"`
-	FileContents     tftypes.String `tfsdk:"file_contents"`
-	ServerIP         tftypes.String `tfsdk:"server_ip"`
-	GenerateSSHKeys  tftypes.Bool   `tfsdk:"generate_ssh_keys"`
-	SSHPrivateKey    tftypes.String `tfsdk:"ssh_private_key"`
-	SSHPublicKey     tftypes.String `tfsdk:"ssh_public_key"`
+	Id                   tftypes.String `tfsdk:"id"`
+	Name                 tftypes.String `tfsdk:"name"`
+	FileContents         tftypes.String `tfsdk:"file_contents"`
+	ServerIP             tftypes.String `tfsdk:"server_ip"`
+	GenerateSSHKeys      tftypes.Bool   `tfsdk:"generate_ssh_keys"`
+	SSHPrivateKey        tftypes.String `tfsdk:"ssh_private_key"`
+	SSHPublicKey         tftypes.String `tfsdk:"ssh_public_key"`
+	GithubOrgname        tftypes.String `tfsdk:"github_orgname"`
+	GitAccount           tftypes.String `tfsdk:"git_account"`
+	SyncMode             tftypes.String `tfsdk:"sync_mode"`
+	ServerID             tftypes.String `tfsdk:"server_id"`
+	RollbackOnFailure    tftypes.Bool   `tfsdk:"rollback_on_failure"`
+	CreateComplete       tftypes.Bool   `tfsdk:"create_complete"`
+	DeletionProtection   tftypes.Bool   `tfsdk:"deletion_protection"`
+	ArchiveRepoOnDestroy tftypes.Bool   `tfsdk:"archive_repo_on_destroy"`
+	Timeouts             timeouts.Value `tfsdk:"timeouts"`
 }
 
 func NewKomodoResource() tfresource.Resource {
 	return &komodoResource{}
 }
 
-
 func (r *komodoResource) Metadata(ctx context.Context, req tfresource.MetadataRequest, resp *tfresource.MetadataResponse) {
 	resp.TypeName = req.ProviderTypeName + "_user" // matches in main.tf: resource "komodo-provider_user" "john_doe" {
 }
@@ -60,15 +106,22 @@ func (r *komodoResource) Schema(ctx context.Context, req tfresource.SchemaReques
 		MarkdownDescription: "User resource interacts with user web service",
 		Attributes: map[string]tfschema.Attribute{
 			"id": tfschema.StringAttribute{
-				MarkdownDescription: "The user ID",
-				Required:            true,
+				MarkdownDescription: "The user ID. Defaults to `name`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"name": tfschema.StringAttribute{
-				MarkdownDescription: "The name of the user",
+				MarkdownDescription: "The name of the user. The server, syncs, procedures and sync repository are all named after it, so changing it replaces the deployment",
 				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 			"file_contents": tfschema.StringAttribute{
-				MarkdownDescription: "Contents to write to resources.toml in the GitHub repository",
+				MarkdownDescription: "Contents to write to resources.toml in the sync repository",
 				Optional:            true,
 			},
 			"server_ip": tfschema.StringAttribute{
@@ -76,19 +129,120 @@ func (r *komodoResource) Schema(ctx context.Context, req tfresource.SchemaReques
 				Optional:            true,
 			},
 			"generate_ssh_keys": tfschema.BoolAttribute{
-				MarkdownDescription: "Whether to generate SSH keys and upload them as deploy keys to the GitHub repository",
+				MarkdownDescription: "Whether to generate SSH keys and upload them as deploy keys to the sync repository.",
 				Optional:            true,
 			},
 			"ssh_private_key": tfschema.StringAttribute{
 				MarkdownDescription: "The generated SSH private key (only available when generate_ssh_keys is true)",
 				Computed:            true,
 				Sensitive:           true,
+				PlanModifiers: []planmodifier.String{
+					useStateUnlessGenerateSSHKeysChanges(),
+				},
 			},
 			"ssh_public_key": tfschema.StringAttribute{
 				MarkdownDescription: "The generated SSH public key (only available when generate_ssh_keys is true)",
 				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					useStateUnlessGenerateSSHKeysChanges(),
+				},
+			},
+			"github_orgname": tfschema.StringAttribute{
+				MarkdownDescription: "Organization (GitHub/Gitea) or group (GitLab) that owns the sync repository. Defaults to the provider's `github_orgname`. Changing it replaces the deployment",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"git_account": tfschema.StringAttribute{
+				MarkdownDescription: "Komodo git provider account used to clone the sync repository. Defaults to the provider's `git_account`, then to the repository owner. Changing it rewrites the `_ContextWare` sync and re-runs the syncs",
+				Optional:            true,
+			},
+			"sync_mode": tfschema.StringAttribute{
+				MarkdownDescription: "Where resources.toml lives: `git` (default) pushes it to a `<name>_syncresources` repository on the provider's git host, `inline` stores `file_contents` directly in the Komodo resource sync and needs no git host access. Changing it replaces the deployment",
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString(syncModeGit),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					stringvalidator.OneOf(syncModeGit, syncModeInline),
+				},
+			},
+			"server_id": tfschema.StringAttribute{
+				MarkdownDescription: "Id or name of a Komodo server managed elsewhere, e.g. by a `komodo-provider_server` resource. When set, the deployment runs on it instead of waiting for `server-<name>` to register, and leaves it in place on destroy. Changing it replaces the deployment",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"rollback_on_failure": tfschema.BoolAttribute{
+				MarkdownDescription: "Whether a failed create deletes what it already created (default). Set to `false` to keep the partial deployment for debugging; after `terraform untaint` the next apply resumes from the failed phase",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(true),
+			},
+			"create_complete": tfschema.BoolAttribute{
+				MarkdownDescription: "Whether the create finished every phase. `false` after a failed create with `rollback_on_failure = false`; it is always planned as `true`, so the next apply resumes the deployment",
+				Computed:            true,
+				Default:             booldefault.StaticBool(true),
+			},
+			"deletion_protection": tfschema.BoolAttribute{
+				MarkdownDescription: "Whether Terraform is prevented from destroying the deployment. While `true`, destroy (and any replacement) fails without touching the server, syncs, procedures or repository",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"archive_repo_on_destroy": tfschema.BoolAttribute{
+				MarkdownDescription: "Whether destroy archives the sync repository instead of deleting it, keeping resources.toml and its history",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
 			},
 		},
+		Blocks: map[string]tfschema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *komodoResource) ValidateConfig(ctx context.Context, req tfresource.ValidateConfigRequest, resp *tfresource.ValidateConfigResponse) {
+	var data KomodoModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The keys are handed to Komodo through resources.toml's environment
+	// section. Without one they are still generated and uploaded as deploy
+	// keys, but Komodo never sees them.
+	if data.GenerateSSHKeys.ValueBool() && !data.FileContents.IsNull() && !data.FileContents.IsUnknown() && !canEmbedSSHKeys(data.FileContents.ValueString()) {
+		resp.Diagnostics.AddAttributeWarning(
+			tfpath.Root("generate_ssh_keys"),
+			"SSH Keys Not Added to file_contents",
+			"file_contents has no environment = \"\"\" ... \"\"\" section, so the generated SSH keys are uploaded as deploy keys but not added to resources.toml.",
+		)
+	}
+
+	// Deploy keys only make sense for the sync repository.
+	if data.SyncMode.ValueString() == syncModeInline && data.GenerateSSHKeys.ValueBool() {
+		resp.Diagnostics.AddAttributeError(
+			tfpath.Root("generate_ssh_keys"),
+			"Invalid Attribute Combination",
+			"generate_ssh_keys cannot be used with sync_mode = \"inline\": inline syncs have no repository to add deploy keys to.",
+		)
+	}
+	if data.SyncMode.ValueString() == syncModeInline && data.ArchiveRepoOnDestroy.ValueBool() {
+		resp.Diagnostics.AddAttributeError(
+			tfpath.Root("archive_repo_on_destroy"),
+			"Invalid Attribute Combination",
+			"archive_repo_on_destroy cannot be used with sync_mode = \"inline\": inline syncs have no repository to archive.",
+		)
 	}
 }
 
@@ -108,36 +262,110 @@ func (r *komodoResource) Configure(ctx context.Context, req tfresource.Configure
 	r.endpoint = provider.endpoint
 	r.apiKey = provider.apiKey
 	r.apiSecret = provider.apiSecret
-	r.githubToken = provider.githubToken
+	r.gitHost = provider.gitHost
+	r.serverLocks = provider.serverLocks
+	r.logSecrets = provider.logSecrets()
 	r.githubOrgname = provider.githubOrgname // Get the GitHub org name
+	r.gitAccount = provider.gitAccount
 }
 
 func (r *komodoResource) Create(ctx context.Context, req tfresource.CreateRequest, resp *tfresource.CreateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
 	var state KomodoModel
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// A slice of functions to execute for cleanup if something goes wrong.
-	var cleanupTasks []func()
+	createTimeout, diags := state.Timeouts.Create(ctx, defaultCreateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "name", state.Name.ValueString())
+	tflog.SubsystemInfo(ctx, logSubsystem, "Creating client deployment", map[string]any{
+		"sync_mode": state.SyncMode.ValueString(),
+		"timeout":   createTimeout.String(),
+	})
+
+	// id defaults to the name, as for imported deployments.
+	if state.Id.IsUnknown() {
+		state.Id = state.Name
+	}
+
+	// The key attributes are computed, so they must be known once applied
+	// even when no keys are generated.
+	state.SSHPrivateKey = tftypes.StringValue("")
+	state.SSHPublicKey = tftypes.StringValue("")
+
+	// Rollback tasks for everything created so far, run in reverse order if
+	// Create fails.
+	var cleanupTasks []func(ctx context.Context)
+	checkpoint := &createCheckpoint{}
+	r.applyDeployment(ctx, &state, checkpoint, &resp.Diagnostics, func(task func(ctx context.Context)) {
+		cleanupTasks = append(cleanupTasks, task)
+	})
+	if !resp.Diagnostics.HasError() {
+		tflog.SubsystemInfo(ctx, logSubsystem, "Created client deployment")
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	// With rollback disabled, keep everything and save the partial state
+	// along with the checkpoint. Terraform marks it tainted; once untainted,
+	// the next apply resumes from the failed phase through Update.
+	if !state.RollbackOnFailure.ValueBool() {
+		tflog.SubsystemWarn(ctx, logSubsystem, "Create failed, keeping partially created resources", map[string]any{
+			"completed_phases": checkpoint.Completed,
+		})
+		state.CreateComplete = tftypes.BoolValue(false)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		resp.Diagnostics.Append(setCreateCheckpoint(ctx, resp.Private, checkpoint)...)
+		resp.Diagnostics.AddWarning(
+			"Partial Deployment Kept",
+			fmt.Sprintf("rollback_on_failure is false, so the resources created before the failure were kept (completed phases: %s). "+
+				"Run `terraform untaint` on this resource and apply again to resume from the failed phase, "+
+				"or apply as is to destroy the partial deployment and start over.", strings.Join(checkpoint.Completed, ", ")),
+		)
+		return
+	}
 
-	// Defer the execution of cleanup tasks in case of an error.
 	// On Create() failure terraform-plugin-framework does NOT put the resource into
 	// state, so terraform's later destroy can't reach the partial cloud state via
-	// Delete(). Running cleanupTasks here is the only way the GitHub repo (and any
+	// Delete(). Running cleanupTasks here is the only way the sync repo (and any
 	// other side-effects we register below) gets torn down — without this the repo
 	// is orphaned forever.
-	defer func() {
-		if resp.Diagnostics.HasError() {
-			// Run cleanup tasks in reverse order.
-			for i := len(cleanupTasks) - 1; i >= 0; i-- {
-				cleanupTasks[i]()
-			}
-		}
-	}()
+	//
+	// ctx may already be cancelled at this point (Ctrl-C or the create timeout),
+	// so the cleanup tasks get their own context detached from it.
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cleanupCancel()
+
+	tflog.SubsystemWarn(cleanupCtx, logSubsystem, "Create failed, cleaning up partially created resources", map[string]any{
+		"cleanup_tasks": len(cleanupTasks),
+	})
+	// Run cleanup tasks in reverse order.
+	for i := len(cleanupTasks) - 1; i >= 0; i-- {
+		tflog.SubsystemDebug(cleanupCtx, logSubsystem, "Running cleanup task", map[string]any{"task": i + 1})
+		cleanupTasks[i](cleanupCtx)
+	}
+}
+
+// applyDeployment runs the phases of creating a client deployment that
+// checkpoint has not recorded as done, marking each one as it finishes.
+// Create runs all of them; Update runs what is left of a Create that failed
+// with rollback_on_failure = false. cleanup, if not nil, is given a rollback
+// task for each resource created.
+func (r *komodoResource) applyDeployment(ctx context.Context, state *KomodoModel, checkpoint *createCheckpoint, diags *diag.Diagnostics, cleanup func(task func(ctx context.Context))) {
+	if cleanup == nil {
+		cleanup = func(func(ctx context.Context)) {}
+	}
 
-	// First, create GitHub repository with file if contents provided
+	name := state.Name.ValueString()
 	fileContents := ""
 	if !state.FileContents.IsNull() {
 		fileContents = state.FileContents.ValueString()
@@ -148,355 +376,413 @@ func (r *komodoResource) Create(ctx context.Context, req tfresource.CreateReques
 		generateSSHKeys = state.GenerateSSHKeys.ValueBool()
 	}
 
-	privateKey, publicKey, err := r.createGitHubRepository(ctx, state.Name.ValueString(), fileContents, generateSSHKeys)
-	if err != nil {
-		resp.Diagnostics.AddError("GitHub Error", fmt.Sprintf("Error creating GitHub repository: %s", err))
-		return
-	}
+	inline := state.SyncMode.ValueString() == syncModeInline
 
-	// Set SSH keys in state if they were generated
-	if generateSSHKeys && privateKey != "" && publicKey != "" {
-		state.SSHPrivateKey = tftypes.StringValue(privateKey)
-		state.SSHPublicKey = tftypes.StringValue(publicKey)
-	}
-	cleanupTasks = append(cleanupTasks, func() {
-		if err := r.deleteGitHubRepository(ctx, state.Name.ValueString()); err != nil {
-			resp.Diagnostics.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete GitHub repository during cleanup: %s", err))
+	// 1. Create the sync repository with file if contents provided. Inline
+	// syncs carry the contents themselves, so they have no repository.
+	if !inline && !checkpoint.done(phaseRepository) {
+		tflog.SubsystemDebug(ctx, logSubsystem, "Creating sync repository", map[string]any{
+			"orgname":           r.orgname(*state),
+			"generate_ssh_keys": generateSSHKeys,
+		})
+		privateKey, publicKey, err := r.createSyncRepository(ctx, r.orgname(*state), name, fileContents, generateSSHKeys)
+		if err != nil {
+			diags.AddError("Git Error", fmt.Sprintf("Error creating sync repository: %s", err))
+			return
 		}
-	})
-
-	// Server will self-register via outbound periphery using onboarding key
-	serverName := fmt.Sprintf("server-%s", strings.ToLower(state.Name.ValueString()))
-
-	// Wait for the server to become available, checking every 10 seconds for up to 15 minutes.
-	// 5 minutes wasn't enough on slow shared-CPU instances (GCP e2-medium) doing apt + docker +
-	// nvm + node + npm ci + 1.3 GB sandbox-base pull before komodo periphery comes online.
-	err = r.waitForServerAvailability(serverName, 90, 10*time.Second)
-	if err != nil {
-		resp.Diagnostics.AddError("Server Error", fmt.Sprintf("Error waiting for server to become available: %s", err))
-		return
-	}
 
-	// Enable the server
-	updateServerPayload := fmt.Sprintf(`{
-		"type": "UpdateServer",
-		"params": {
-			"id": "%s",
-			"config": {
-				"enabled": true
-			}
+		// Set SSH keys in state if they were generated
+		if generateSSHKeys && privateKey != "" && publicKey != "" {
+			state.SSHPrivateKey = tftypes.StringValue(privateKey)
+			state.SSHPublicKey = tftypes.StringValue(publicKey)
 		}
-	}`, serverName)
-
-	err = r.makeAPICall(updateServerPayload, r.endpoint+"write")
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error enabling server: %s", err))
-		return
+		orgname := r.orgname(*state)
+		cleanup(func(ctx context.Context) {
+			if err := r.deleteSyncRepository(ctx, orgname, name); err != nil {
+				diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete sync repository during cleanup: %s", err))
+			}
+		})
+		checkpoint.ContentsSHA256 = contentsSHA256(fileContents)
+		checkpoint.complete(phaseRepository)
 	}
 
-	// Wait for the server to reach OK state, checking every 10 seconds for up to 15 minutes
-	// (same reasoning as waitForServerAvailability above).
-	err = r.waitForServerStateEnabled(serverName, 90, 10*time.Second)
-	if err != nil {
-		resp.Diagnostics.AddError("Server Error", fmt.Sprintf("Error waiting for server to reach OK state: %s", err))
-		return
-	}
+	// Server will self-register via outbound periphery using onboarding key,
+	// unless server_id points at one managed elsewhere.
+	serverName := serverName(*state)
 
-	// Now make the additional API calls
-	// 2. Create Resource Sync for ContextWare
-	createContextWarePayload := fmt.Sprintf(`{
-		"type": "CreateResourceSync",
-		"params": {
-			"name": "%s_ContextWare",
-			"config": {
-				"file_contents": "[[resource_sync]]\nname = \"%s_ResourceSetup\"\n[resource_sync.config]\nrepo = \"ManidaeCloud/%s_syncresources\"\ngit_account = \"oidebrett\"\nresource_path = [\"resources.toml\"]\ninclude_user_groups = true"
-			}
+	// 2. Bring the server online.
+	if !checkpoint.done(phaseServer) {
+		// Wait for the server to become available, checking every 10 seconds for up to 15 minutes.
+		// 5 minutes wasn't enough on slow shared-CPU instances (GCP e2-medium) doing apt + docker +
+		// nvm + node + npm ci + 1.3 GB sandbox-base pull before komodo periphery comes online.
+		err := waitForServerAvailability(ctx, r.client, serverName, 15*time.Minute, 10*time.Second)
+		if err != nil {
+			addAPIError(diags, "Server Error", fmt.Sprintf("waiting for server %q to become available", serverName), err)
+			return
 		}
-	}`, state.Name.ValueString(), state.Name.ValueString(), strings.ToLower(state.Name.ValueString()))
 
-	err = r.makeAPICall(createContextWarePayload, r.endpoint+"write")
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error creating ContextWare resource sync: %s", err))
-		return
-	}
-	cleanupTasks = append(cleanupTasks, func() {
-		deleteContextWareSyncPayload := fmt.Sprintf(`{
-			"type": "DeleteResourceSync",
-			"params": {
-				"id": "%s_ContextWare"
+		// Enable the server. A server from server_id is configured by its
+		// own resource.
+		if state.ServerID.IsNull() {
+			_, err = r.client.UpdateServer(ctx, serverName, komodo.ServerConfig{Enabled: komodo.Ptr(true)})
+			if err != nil {
+				addAPIError(diags, "API Error", fmt.Sprintf("enabling server %q", serverName), err)
+				return
 			}
-		}`, state.Name.ValueString())
-		if err := r.makeAPICall(deleteContextWareSyncPayload, r.endpoint+"write"); err != nil {
-			resp.Diagnostics.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete ContextWare sync during cleanup: %s", err))
 		}
-	})
 
-	// 3. Run the ContextWare sync first
-	runContextWarePayload := fmt.Sprintf(`{
-		"type": "RunSync",
-		"params": {
-			"sync": "%s_ContextWare"
+		// Wait for the server to reach OK state, checking every 10 seconds for up to 15 minutes
+		// (same reasoning as waitForServerAvailability above).
+		err = waitForServerStateEnabled(ctx, r.client, serverName, 15*time.Minute, 10*time.Second)
+		if err != nil {
+			addAPIError(diags, "Server Error", fmt.Sprintf("waiting for server %q to reach OK state", serverName), err)
+			return
 		}
-	}`, state.Name.ValueString())
-
-	err = r.makeAPICall(runContextWarePayload, r.endpoint+"execute")
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error running ContextWare sync: %s", err))
-		return
+		checkpoint.complete(phaseServer)
 	}
-	cleanupTasks = append(cleanupTasks, func() {
-		deleteResourceSetupSyncPayload := fmt.Sprintf(`{
-			"type": "DeleteResourceSync",
-			"params": {
-				"id": "%s_ResourceSetup"
+
+	// 3. Create and run the syncs, which create the procedures.
+	if !checkpoint.done(phaseSyncs) {
+		if inline {
+			// Create the ResourceSetup sync directly from file_contents.
+			err := r.upsertInlineResourceSetupSync(ctx, name, fileContents)
+			if err != nil {
+				addAPIError(diags, "API Error", fmt.Sprintf("creating resource sync %q", name+"_ResourceSetup"), err)
+				return
+			}
+			checkpoint.ContentsSHA256 = contentsSHA256(fileContents)
+			cleanup(func(ctx context.Context) {
+				if err := r.client.DeleteResourceSync(ctx, name+"_ResourceSetup"); err != nil {
+					diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete ResourceSetup sync during cleanup: %s", err))
+				}
+			})
+		} else {
+			// The ResourceSetup sync has to point at the repository we actually
+			// created, which is under the org or the token's own account.
+			owner, err := r.repoOwner(ctx, r.orgname(*state))
+			if err != nil {
+				diags.AddError("Git Error", fmt.Sprintf("Error determining repository owner: %s", err))
+				return
 			}
-		}`, state.Name.ValueString())
-		if err := r.makeAPICall(deleteResourceSetupSyncPayload, r.endpoint+"write"); err != nil {
-			resp.Diagnostics.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete ResourceSetup sync during cleanup: %s", err))
-		}
-	})
 
-	// Wait for the ContextWare sync to create the inner ResourceSetup resource.
-	// The execute endpoint is async — RunSync returns when queued, not when
-	// the sync's effects (creating the inner sync) are committed.
-	if err := r.waitForResourceSyncExists(state.Name.ValueString()+"_ResourceSetup", 60, 1*time.Second); err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("ResourceSetup sync did not appear after ContextWare sync ran: %s", err))
-		return
-	}
+			// Create the ContextWare sync and run it first
+			err = r.upsertContextWareSync(ctx, name, owner, r.resolveGitAccount(*state, owner))
+			if err != nil {
+				addAPIError(diags, "API Error", fmt.Sprintf("creating resource sync %q", name+"_ContextWare"), err)
+				return
+			}
+			cleanup(func(ctx context.Context) {
+				if err := r.client.DeleteResourceSync(ctx, name+"_ContextWare"); err != nil {
+					diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete ContextWare sync during cleanup: %s", err))
+				}
+			})
 
-	// 4. Now run the ResourceSetup sync
-	runResourceSetupPayload := fmt.Sprintf(`{
-		"type": "RunSync",
-		"params": {
-			"sync": "%s_ResourceSetup"
-		}
-	}`, state.Name.ValueString())
+			update, err := r.client.RunSync(ctx, name+"_ContextWare")
+			if err != nil {
+				addAPIError(diags, "API Error", fmt.Sprintf("running resource sync %q", name+"_ContextWare"), err)
+				return
+			}
+			if err := waitForUpdate(ctx, r.client, update, syncRunTimeout); err != nil {
+				addAPIError(diags, "Sync Error", fmt.Sprintf("running resource sync %q", name+"_ContextWare"), err)
+				return
+			}
+			cleanup(func(ctx context.Context) {
+				if err := r.client.DeleteResourceSync(ctx, name+"_ResourceSetup"); err != nil {
+					diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete ResourceSetup sync during cleanup: %s", err))
+				}
+			})
 
-	err = r.makeAPICall(runResourceSetupPayload, r.endpoint+"execute")
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error running ResourceSetup sync: %s", err))
-		return
-	}
-	cleanupTasks = append(cleanupTasks, func() {
-		deleteProcedureApplyPayload := fmt.Sprintf(`{
-			"type": "DeleteProcedure",
-			"params": {
-				"id": "%s_ProcedureApply"
+			// Wait for the ContextWare sync to create the inner ResourceSetup resource.
+			// The execute endpoint is async — RunSync returns when queued, not when
+			// the sync's effects (creating the inner sync) are committed.
+			if err := r.waitForResourceSyncExists(ctx, name+"_ResourceSetup", 1*time.Minute, 1*time.Second); err != nil {
+				addAPIError(diags, "API Error", fmt.Sprintf("waiting for the ContextWare sync to create resource sync %q", name+"_ResourceSetup"), err)
+				return
 			}
-		}`, state.Name.ValueString())
-		if err := r.makeAPICall(deleteProcedureApplyPayload, r.endpoint+"write"); err != nil {
-			resp.Diagnostics.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete apply procedure during cleanup: %s", err))
 		}
 
-		deleteProcedureDestroyPayload := fmt.Sprintf(`{
-			"type": "DeleteProcedure",
-			"params": {
-				"id": "%s_ProcedureDestroy"
+		// Now run the ResourceSetup sync
+		update, err := r.client.RunSync(ctx, name+"_ResourceSetup")
+		if err != nil {
+			addAPIError(diags, "API Error", fmt.Sprintf("running resource sync %q", name+"_ResourceSetup"), err)
+			return
+		}
+		cleanup(func(ctx context.Context) {
+			if err := r.client.DeleteProcedure(ctx, name+"_ProcedureApply"); err != nil {
+				diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete apply procedure during cleanup: %s", err))
+			}
+			if err := r.client.DeleteProcedure(ctx, name+"_ProcedureDestroy"); err != nil {
+				diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete destroy procedure during cleanup: %s", err))
 			}
-		}`, state.Name.ValueString())
-		if err := r.makeAPICall(deleteProcedureDestroyPayload, r.endpoint+"write"); err != nil {
-			resp.Diagnostics.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete destroy procedure during cleanup: %s", err))
+			if err := r.client.DeleteProcedure(ctx, name+"_ProcedureRestart"); err != nil {
+				diags.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete restart procedure during cleanup: %s", err))
+			}
+		})
+		if err := waitForUpdate(ctx, r.client, update, syncRunTimeout); err != nil {
+			addAPIError(diags, "Sync Error", fmt.Sprintf("running resource sync %q", name+"_ResourceSetup"), err)
+			return
 		}
 
-		deleteProcedureRestartPayload := fmt.Sprintf(`{
-			"type": "DeleteProcedure",
-			"params": {
-				"id": "%s_ProcedureRestart"
-			}
-		}`, state.Name.ValueString())
-		if err := r.makeAPICall(deleteProcedureRestartPayload, r.endpoint+"write"); err != nil {
-			resp.Diagnostics.AddWarning("Cleanup Warning", fmt.Sprintf("Failed to delete restart procedure during cleanup: %s", err))
+		// Wait for the ResourceSetup sync to apply its TOML — the procedure
+		// appearing is the precondition we actually need for RunProcedure below.
+		if err := r.waitForProcedureExists(ctx, name+"_ProcedureApply", 2*time.Minute, 1*time.Second); err != nil {
+			addAPIError(diags, "API Error", fmt.Sprintf("waiting for the ResourceSetup sync to create procedure %q", name+"_ProcedureApply"), err)
+			return
 		}
-	})
+		checkpoint.complete(phaseSyncs)
+	}
 
-	// Wait for the ResourceSetup sync to apply its TOML — the procedure
-	// appearing is the precondition we actually need for RunProcedure below.
-	if err := r.waitForProcedureExists(state.Name.ValueString()+"_ProcedureApply", 120, 1*time.Second); err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("ProcedureApply did not appear after ResourceSetup sync ran: %s", err))
+	// 4. Run Procedure and wait for it to finish, so a failing deployment
+	// fails the apply. Only one procedure runs on a server at a time.
+	unlock, err := r.serverLocks.lockServer(ctx, r.client, serverName)
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("waiting for other procedures on server %q", serverName), err)
 		return
 	}
-
-	// 5. Run Procedure
-	runProcedurePayload := fmt.Sprintf(`{
-		"type": "RunProcedure",
-		"params": {
-			"procedure": "%s_ProcedureApply"
-		}
-	}`, state.Name.ValueString())
-
-	err = r.makeAPICall(runProcedurePayload, r.endpoint+"execute")
+	defer unlock()
+	update, err := r.client.RunProcedure(ctx, name+"_ProcedureApply")
 	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error running procedure: %s", err))
+		addAPIError(diags, "API Error", fmt.Sprintf("running procedure %q", name+"_ProcedureApply"), err)
 		return
 	}
-
-	resp.State.Set(ctx, &state)
+	if err := waitForUpdate(ctx, r.client, update, procedureRunTimeout); err != nil {
+		addAPIError(diags, "Procedure Error", fmt.Sprintf("running procedure %q", name+"_ProcedureApply"), err)
+		return
+	}
+	checkpoint.complete(phaseProcedure)
 }
 
 func (r *komodoResource) Read(ctx context.Context, req tfresource.ReadRequest, resp *tfresource.ReadResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
 	var state KomodoModel
 	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	
-	// Skip the user read API call
-	// Just set the state directly
-	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
-}
 
-func (r *komodoResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
-	var data KomodoModel
-	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	checkpoint, diags := getCreateCheckpoint(ctx, req.Private)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	exists, diags := r.refresh(ctx, &state, checkpoint)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	
-	// Initialize random number generator
-	mathrand.Seed(time.Now().UnixNano())
-	
-	// First, run the destroy procedure
-	runDestroyPayload := fmt.Sprintf(`{
-		"type": "RunProcedure",
-		"params": {
-			"procedure": "%s_ProcedureDestroy"
+	if !exists {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// refresh updates state from Komodo and the sync repository, and reports
+// whether the deployment still exists. checkpoint is the create checkpoint
+// of a deployment whose Create stopped part way, or nil. Only what its
+// completed phases created can have been deleted outside Terraform; the rest
+// was never there and is left to the Update that resumes the Create.
+func (r *komodoResource) refresh(ctx context.Context, state *KomodoModel, checkpoint *createCheckpoint) (bool, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	name := state.Name.ValueString()
+	serverName := serverName(*state)
+	inline := state.SyncMode.ValueString() == syncModeInline
+
+	// The Komodo server and the sync repository anchor the whole deployment:
+	// nothing Create builds on top of them works without both, so if either
+	// has been deleted outside Terraform drop the resource from state and let
+	// the next plan recreate it.
+	if _, err := r.client.GetServer(ctx, serverName); err != nil {
+		if !komodo.IsNotFound(err) {
+			addAPIError(&diags, "API Error", fmt.Sprintf("reading server %q", serverName), err)
+			return false, diags
+		}
+		if checkpoint.done(phaseServer) {
+			return false, diags
+		}
+	}
+
+	// In inline mode the ResourceSetup sync holds the contents and plays the
+	// part of the repository. It is created with the syncs.
+	var remoteContents string
+	found := false
+	anchorPhase := phaseRepository
+	if inline {
+		anchorPhase = phaseSyncs
+		sync, err := r.client.GetResourceSync(ctx, name+"_ResourceSetup")
+		if err != nil && !komodo.IsNotFound(err) {
+			addAPIError(&diags, "API Error", fmt.Sprintf("reading resource sync %q", name+"_ResourceSetup"), err)
+			return false, diags
 		}
-	}`, data.Name.ValueString())
-	
-	err := r.makeAPICall(runDestroyPayload, r.endpoint+"execute")
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error running destroy procedure: %s", err))
-		// Continue with deletion even if API call fails
-	}
-	
-	// Wait for the ProcedureDestroy to complete (up to 5 seconds)
-	time.Sleep(5 * time.Second)
-
-	// Function to retry API calls with backoff
-	retryAPICall := func(payload, url string, maxRetries int) error {
-		var lastErr error
-		for i := 0; i < maxRetries; i++ {
-			err := r.makeAPICall(payload, url)
-			if err == nil {
-				return nil
-			}
-			
-			lastErr = err
-			// If we get a "Procedure busy" error, wait and retry
-			if strings.Contains(err.Error(), "Procedure busy") {
-				// Longer exponential backoff with more randomness
-				sleepTime := time.Duration(3*(i+1)+mathrand.Intn(3)) * time.Second
-				time.Sleep(sleepTime)
-				continue
+		if err == nil {
+			found = true
+			remoteContents = deref(sync.Config.FileContents)
+		}
+	} else {
+		contents, ok, err := r.getRepositoryFile(ctx, r.orgname(*state), name)
+		if err != nil {
+			diags.AddError("Git Error", fmt.Sprintf("Error reading resources.toml from repository: %s", err))
+			return false, diags
+		}
+
+		// resources.toml carries the generated SSH keys in addition to the
+		// configured contents, so strip them before comparing.
+		found = ok
+		remoteContents = stripSSHKeysFromFileContents(contents)
+	}
+	if !found && checkpoint.done(anchorPhase) {
+		return false, diags
+	}
+	if found && state.FileContents.ValueString() != remoteContents && !(state.FileContents.IsNull() && remoteContents == "") {
+		state.FileContents = tftypes.StringValue(remoteContents)
+	}
+
+	// The syncs and procedures are derived from resources.toml. If any of them
+	// has gone missing, clear file_contents so the next plan pushes the file
+	// again and Update re-runs the syncs that recreate them.
+	if checkpoint.done(phaseSyncs) {
+		missing := false
+		syncNames := []string{name + "_ContextWare", name + "_ResourceSetup"}
+		if inline {
+			syncNames = []string{name + "_ResourceSetup"}
+		}
+		for _, syncName := range syncNames {
+			if _, err := r.client.GetResourceSync(ctx, syncName); err != nil {
+				if !komodo.IsNotFound(err) {
+					addAPIError(&diags, "API Error", fmt.Sprintf("reading resource sync %q", syncName), err)
+					return false, diags
+				}
+				missing = true
 			}
-			
-			// For other errors, don't retry
-			return err
 		}
-		return lastErr
-	}
-	
-	// Delete the procedures with retry
-	deleteProcedureApplyPayload := fmt.Sprintf(`{
-		"type": "DeleteProcedure",
-		"params": {
-			"id": "%s_ProcedureApply"
+		for _, procedureName := range []string{name + "_ProcedureApply", name + "_ProcedureDestroy"} {
+			if _, err := r.client.GetProcedure(ctx, procedureName); err != nil {
+				if !komodo.IsNotFound(err) {
+					addAPIError(&diags, "API Error", fmt.Sprintf("reading procedure %q", procedureName), err)
+					return false, diags
+				}
+				missing = true
+			}
 		}
-	}`, data.Name.ValueString())
-	
-	err = retryAPICall(deleteProcedureApplyPayload, r.endpoint+"write", 5)
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error deleting apply procedure after retries: %s", err))
-		// Continue with deletion even if API call fails
-	}
-	
-	// Wait a bit between procedure deletions
-	time.Sleep(2 * time.Second)
-	
-	deleteProcedureDestroyPayload := fmt.Sprintf(`{
-		"type": "DeleteProcedure",
-		"params": {
-			"id": "%s_ProcedureDestroy"
+		if missing {
+			state.FileContents = tftypes.StringNull()
 		}
-	}`, data.Name.ValueString())
+	}
 
-	err = retryAPICall(deleteProcedureDestroyPayload, r.endpoint+"write", 5)
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error deleting destroy procedure after retries: %s", err))
-		// Continue with deletion even if API call fails
+	// A deployment whose Create stopped part way is incomplete even if
+	// nothing is missing yet, e.g. when the apply procedure failed.
+	// create_complete is always planned as true, so this forces the Update
+	// that resumes it whether or not file_contents is set.
+	state.CreateComplete = tftypes.BoolValue(checkpoint == nil)
+	return true, diags
+}
+
+func (r *komodoResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data KomodoModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	// Wait a bit between procedure deletions
-	time.Sleep(2 * time.Second)
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultDeleteTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
 
-	deleteProcedureRestartPayload := fmt.Sprintf(`{
-		"type": "DeleteProcedure",
-		"params": {
-			"id": "%s_ProcedureRestart"
-		}
-	}`, data.Name.ValueString())
+	name := data.Name.ValueString()
+	if data.DeletionProtection.ValueBool() {
+		resp.Diagnostics.AddError(
+			"Deletion Protection Enabled",
+			fmt.Sprintf("Client deployment %q has deletion_protection set, so it was not destroyed. "+
+				"Set deletion_protection = false and apply before destroying or replacing it.", name),
+		)
+		return
+	}
 
-	err = retryAPICall(deleteProcedureRestartPayload, r.endpoint+"write", 5)
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "name", name)
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deleting client deployment", map[string]any{"timeout": deleteTimeout.String()})
+
+	// First, run the destroy procedure and wait for its Update to complete.
+	// Deleting the procedures, syncs or server while it is still tearing
+	// stacks down races it. Other resources' procedures on the same server
+	// wait until the teardown is done.
+	serverName := serverName(data)
+	unlock, err := r.serverLocks.lockServer(ctx, r.client, serverName)
 	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error deleting restart procedure after retries: %s", err))
-		// Continue with deletion even if API call fails
-	}
-
-	// Wait a bit before deleting resource syncs
-	time.Sleep(2 * time.Second)
-	
-	// Delete the resource syncs with retry
-	deleteResourceSetupSyncPayload := fmt.Sprintf(`{
-		"type": "DeleteResourceSync",
-		"params": {
-			"id": "%s_ResourceSetup"
-		}
-	}`, data.Name.ValueString())
-	
-	err = retryAPICall(deleteResourceSetupSyncPayload, r.endpoint+"write", 5)
+		resp.Diagnostics.AddError("Delete Interrupted", fmt.Sprintf("Error waiting for other procedures on %s: %s", serverName, err))
+		return
+	}
+	defer unlock()
+	update, err := r.client.RunProcedure(ctx, name+"_ProcedureDestroy")
 	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error deleting ResourceSetup sync after retries: %s", err))
-		// Continue with deletion even if API call fails
-	}
-	
-	// Wait a bit between resource sync deletions
-	time.Sleep(2 * time.Second)
-	
-	deleteContextWareSyncPayload := fmt.Sprintf(`{
-		"type": "DeleteResourceSync",
-		"params": {
-			"id": "%s_ContextWare"
+		// A missing destroy procedure leaves nothing to run; anything else is
+		// reported but deletion continues.
+		if !komodo.IsNotFound(err) {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("running procedure %q", name+"_ProcedureDestroy"), err)
 		}
-	}`, data.Name.ValueString())
-	
-	err = retryAPICall(deleteContextWareSyncPayload, r.endpoint+"write", 5)
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error deleting ContextWare sync after retries: %s", err))
-		// Continue with deletion even if API call fails
-	}
-	
-	// Delete the server
-	serverName := fmt.Sprintf("server-%s", strings.ToLower(data.Name.ValueString()))
-	deleteServerPayload := fmt.Sprintf(`{
-		"type": "DeleteServer",
-		"params": {
-			"id": "%s"
+	} else if err := waitForUpdate(ctx, r.client, update, procedureRunTimeout); err != nil {
+		addAPIError(&resp.Diagnostics, "Procedure Error", fmt.Sprintf("running procedure %q", name+"_ProcedureDestroy"), err)
+	}
+	if ctx.Err() != nil {
+		resp.Diagnostics.AddError("Delete Interrupted", fmt.Sprintf("Delete did not finish: %s", ctx.Err()))
+		return
+	}
+
+	// Tear the rest down in reverse dependency order: the procedures created
+	// by the ResourceSetup sync, then the ResourceSetup sync itself, then the
+	// ContextWare sync that defines it, and finally the server. Anything that
+	// is already gone counts as deleted; the client retries while a target is
+	// still busy.
+	steps := []struct {
+		description string
+		call        func() error
+	}{
+		{"apply procedure", func() error { return r.client.DeleteProcedure(ctx, name+"_ProcedureApply") }},
+		{"restart procedure", func() error { return r.client.DeleteProcedure(ctx, name+"_ProcedureRestart") }},
+		{"destroy procedure", func() error { return r.client.DeleteProcedure(ctx, name+"_ProcedureDestroy") }},
+		{"ResourceSetup sync", func() error { return r.client.DeleteResourceSync(ctx, name+"_ResourceSetup") }},
+		{"ContextWare sync", func() error { return r.client.DeleteResourceSync(ctx, name+"_ContextWare") }},
+		{"server", func() error { return r.client.DeleteServer(ctx, serverName) }},
+	}
+	// A server from server_id is left to the resource that manages it.
+	if !data.ServerID.IsNull() {
+		steps = steps[:len(steps)-1]
+	}
+	for _, step := range steps {
+		tflog.SubsystemDebug(ctx, logSubsystem, "Deleting "+step.description)
+		err := step.call()
+		if err != nil && !komodo.IsNotFound(err) {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("deleting %s", step.description), err)
+			// Continue with deletion even if API call fails
+		}
+		if ctx.Err() != nil {
+			resp.Diagnostics.AddError("Delete Interrupted", fmt.Sprintf("Delete did not finish: %s", ctx.Err()))
+			return
 		}
-	}`, serverName)
-	
-	err = retryAPICall(deleteServerPayload, r.endpoint+"write", 3)
-	if err != nil {
-		resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error deleting server after retries: %s", err))
-		// Continue with deletion even if API call fails
 	}
-	
-	// Delete the GitHub repository
-	err = r.deleteGitHubRepository(ctx, data.Name.ValueString())
-	if err != nil {
-		resp.Diagnostics.AddError("GitHub Error", fmt.Sprintf("Error deleting GitHub repository: %s", err))
-		// Continue with the API call even if GitHub deletion fails
+
+	// Delete, or archive, the sync repository. Inline syncs never had one.
+	if data.SyncMode.ValueString() != syncModeInline && data.ArchiveRepoOnDestroy.ValueBool() {
+		tflog.SubsystemDebug(ctx, logSubsystem, "Archiving sync repository", map[string]any{"orgname": r.orgname(data)})
+		if err := r.archiveSyncRepository(ctx, r.orgname(data), name); err != nil {
+			resp.Diagnostics.AddError("Git Error", fmt.Sprintf("Error archiving sync repository: %s", err))
+		}
+	} else if data.SyncMode.ValueString() != syncModeInline {
+		tflog.SubsystemDebug(ctx, logSubsystem, "Deleting sync repository", map[string]any{"orgname": r.orgname(data)})
+		err = r.deleteSyncRepository(ctx, r.orgname(data), data.Name.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("Git Error", fmt.Sprintf("Error deleting sync repository: %s", err))
+			// Continue with the API call even if repository deletion fails
+		}
 	}
-	
+
 	// Skip the user deletion API call
 	// Just clear the state
 	data.Id = tftypes.StringValue("")
@@ -505,582 +791,529 @@ func (r *komodoResource) Delete(ctx context.Context, req tfresource.DeleteReques
 }
 
 func (r *komodoResource) Update(ctx context.Context, req tfresource.UpdateRequest, resp *tfresource.UpdateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
 	var state KomodoModel
 	var oldState KomodoModel
-	
+
 	// Get the current state
 	resp.Diagnostics.Append(req.State.Get(ctx, &oldState)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	
+
 	// Get the planned new state
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	
+
+	updateTimeout, diags := state.Timeouts.Update(ctx, defaultUpdateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "name", state.Name.ValueString())
+	tflog.SubsystemInfo(ctx, logSubsystem, "Updating client deployment", map[string]any{
+		"file_contents_changed": !state.FileContents.Equal(oldState.FileContents),
+		"git_account_changed":   !state.GitAccount.Equal(oldState.GitAccount),
+		"timeout":               updateTimeout.String(),
+	})
+
+	// Finish a Create that failed with rollback_on_failure = false. Read
+	// set create_complete to false to get here.
+	checkpoint, diags := getCreateCheckpoint(ctx, req.Private)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if checkpoint != nil {
+		r.resumeDeployment(ctx, &state, oldState, checkpoint, resp)
+		return
+	}
+
 	// Skip the user update API call that was here before
 	// We're keeping the endpoint for other API calls
-	
-	// Update GitHub repository file if needed
-	if !state.FileContents.IsNull() && !state.FileContents.Equal(oldState.FileContents) {
-		// Determine the owner (org or user)
-		owner := ""
-		if r.githubOrgname != "" {
-			owner = r.githubOrgname
-		} else {
-			// Get the authenticated user
-			ts := oauth2.StaticTokenSource(
-				&oauth2.Token{AccessToken: r.githubToken},
-			)
-			tc := oauth2.NewClient(ctx, ts)
-			client := github.NewClient(tc)
-			
-			user, _, err := client.Users.Get(ctx, "")
-			if err != nil {
-				resp.Diagnostics.AddError("GitHub Error", fmt.Sprintf("Failed to get authenticated user: %v", err))
-				return
-			}
-			owner = *user.Login
-		}
-		
-		generateSSHKeys := false
-		if !state.GenerateSSHKeys.IsNull() {
-			generateSSHKeys = state.GenerateSSHKeys.ValueBool()
-		}
 
-		privateKey, publicKey, err := r.updateFileInRepository(ctx, sanitizeRepoName(state.Name.ValueString()), owner, state.FileContents.ValueString(), generateSSHKeys)
+	// Update the sync repository file (or inline sync) if needed. Turning
+	// generate_ssh_keys on or off rewrites the file with or without keys.
+	fileChanged := !state.FileContents.Equal(oldState.FileContents) ||
+		state.GenerateSSHKeys.ValueBool() != oldState.GenerateSSHKeys.ValueBool()
+
+	// In git mode the ContextWare sync names the repository owner and the git
+	// account, so a new git_account (or a new owner derived from the
+	// provider) has to be written to it and synced into ResourceSetup.
+	var owner string
+	contextWareChanged := false
+	if !state.FileContents.IsNull() && state.SyncMode.ValueString() != syncModeInline {
+		var err error
+		owner, err = r.repoOwner(ctx, r.orgname(state))
 		if err != nil {
-			resp.Diagnostics.AddError("GitHub Error", fmt.Sprintf("Error updating file in repository: %s", err))
+			resp.Diagnostics.AddError("Git Error", fmt.Sprintf("Failed to get authenticated user: %v", err))
 			return
 		}
+		contextWareChanged, err = r.contextWareSyncChanged(ctx, state.Name.ValueString(), owner, r.resolveGitAccount(state, owner))
+		if err != nil {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("reading resource sync %q", state.Name.ValueString()+"_ContextWare"), err)
+			return
+		}
+	}
 
-		// Set SSH keys in state based on whether they were generated
-		if generateSSHKeys && privateKey != "" && publicKey != "" {
-			state.SSHPrivateKey = tftypes.StringValue(privateKey)
-			state.SSHPublicKey = tftypes.StringValue(publicKey)
-		} else {
-			// Set empty values when SSH keys are not generated
+	if !state.FileContents.IsNull() && (fileChanged || contextWareChanged) {
+		if state.SyncMode.ValueString() == syncModeInline {
+			// Inline syncs hold the contents themselves, so push them
+			// straight into the ResourceSetup sync.
+			err := r.upsertInlineResourceSetupSync(ctx, state.Name.ValueString(), state.FileContents.ValueString())
+			if err != nil {
+				addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating resource sync %q", state.Name.ValueString()+"_ResourceSetup"), err)
+				return
+			}
 			state.SSHPrivateKey = tftypes.StringValue("")
 			state.SSHPublicKey = tftypes.StringValue("")
-		}
-		
-		// Run the API calls again to update the resources
-		// 1. Create/Update Resource Sync
-		createSyncPayload := fmt.Sprintf(`{
-			"type": "CreateResourceSync",
-			"params": {
-				"name": "%s_ContextWare",
-				"config": {
-					"file_contents": "[[resource_sync]]\nname = \"%s_ResourceSetup\"\n[resource_sync.config]\nrepo = \"ManidaeCloud/%s_syncresources\"\ngit_account = \"oidebrett\"\nresource_path = [\"resources.toml\"]\ninclude_user_groups = true"
+		} else {
+			if fileChanged {
+				generateSSHKeys := false
+				if !state.GenerateSSHKeys.IsNull() {
+					generateSSHKeys = state.GenerateSSHKeys.ValueBool()
+				}
+
+				tflog.SubsystemDebug(ctx, logSubsystem, "Updating resources.toml in sync repository", map[string]any{"owner": owner})
+				privateKey, publicKey, err := r.updateFileInRepository(ctx, sanitizeRepoName(state.Name.ValueString()), owner, state.FileContents.ValueString(), generateSSHKeys, oldState.SSHPrivateKey.ValueString(), oldState.SSHPublicKey.ValueString())
+				if err != nil {
+					resp.Diagnostics.AddError("Git Error", fmt.Sprintf("Error updating file in repository: %s", err))
+					return
+				}
+
+				// Set SSH keys in state based on whether they were generated
+				if generateSSHKeys && privateKey != "" && publicKey != "" {
+					state.SSHPrivateKey = tftypes.StringValue(privateKey)
+					state.SSHPublicKey = tftypes.StringValue(publicKey)
+				} else {
+					// Set empty values when SSH keys are not generated
+					state.SSHPrivateKey = tftypes.StringValue("")
+					state.SSHPublicKey = tftypes.StringValue("")
 				}
 			}
-		}`, state.Name.ValueString(), state.Name.ValueString(), strings.ToLower(state.Name.ValueString()))
-		
-		err = r.makeAPICall(createSyncPayload, r.endpoint+"write")
-		if err != nil {
-			resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error updating resource sync: %s", err))
-			return
-		}
 
-		// Wait for the inner ResourceSetup sync to exist before running it
-		// (handles the case where Create's outer sync hasn't fully committed).
-		if err := r.waitForResourceSyncExists(state.Name.ValueString()+"_ResourceSetup", 60, 1*time.Second); err != nil {
-			resp.Diagnostics.AddError("API Error", fmt.Sprintf("ResourceSetup sync did not appear: %s", err))
-			return
-		}
+			// Run the API calls again to update the resources
+			// 1. Create/Update the ContextWare Resource Sync. It may have been
+			// deleted outside Terraform, in which case Read cleared file_contents
+			// to get us here.
+			err := r.upsertContextWareSync(ctx, state.Name.ValueString(), owner, r.resolveGitAccount(state, owner))
+			if err != nil {
+				addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating resource sync %q", state.Name.ValueString()+"_ContextWare"), err)
+				return
+			}
 
-		// 2. Run Sync
-		runSyncPayload := fmt.Sprintf(`{
-			"type": "RunSync",
-			"params": {
-				"sync": "%s_ResourceSetup"
+			// A changed ContextWare sync only reaches ResourceSetup when it runs.
+			if contextWareChanged {
+				update, err := r.client.RunSync(ctx, state.Name.ValueString()+"_ContextWare")
+				if err != nil {
+					addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("running resource sync %q", state.Name.ValueString()+"_ContextWare"), err)
+					return
+				}
+				if err := waitForUpdate(ctx, r.client, update, syncRunTimeout); err != nil {
+					addAPIError(&resp.Diagnostics, "Sync Error", fmt.Sprintf("running resource sync %q", state.Name.ValueString()+"_ContextWare"), err)
+					return
+				}
 			}
-		}`, state.Name.ValueString())
 
-		err = r.makeAPICall(runSyncPayload, r.endpoint+"execute")
+			// Wait for the inner ResourceSetup sync to exist before running it
+			// (handles the case where Create's outer sync hasn't fully committed).
+			if err := r.waitForResourceSyncExists(ctx, state.Name.ValueString()+"_ResourceSetup", 1*time.Minute, 1*time.Second); err != nil {
+				addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("waiting for resource sync %q", state.Name.ValueString()+"_ResourceSetup"), err)
+				return
+			}
+		}
+
+		// 2. Run Sync
+		update, err := r.client.RunSync(ctx, state.Name.ValueString()+"_ResourceSetup")
 		if err != nil {
-			resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error running sync: %s", err))
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("running resource sync %q", state.Name.ValueString()+"_ResourceSetup"), err)
+			return
+		}
+		if err := waitForUpdate(ctx, r.client, update, syncRunTimeout); err != nil {
+			addAPIError(&resp.Diagnostics, "Sync Error", fmt.Sprintf("running resource sync %q", state.Name.ValueString()+"_ResourceSetup"), err)
 			return
 		}
 
 		// Wait for the sync to commit the procedure before running it.
-		if err := r.waitForProcedureExists(state.Name.ValueString()+"_ProcedureApply", 120, 1*time.Second); err != nil {
-			resp.Diagnostics.AddError("API Error", fmt.Sprintf("ProcedureApply did not appear after sync ran: %s", err))
+		if err := r.waitForProcedureExists(ctx, state.Name.ValueString()+"_ProcedureApply", 2*time.Minute, 1*time.Second); err != nil {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("waiting for the sync to create procedure %q", state.Name.ValueString()+"_ProcedureApply"), err)
 			return
 		}
 
-		// 3. Run Procedure
-		runProcedurePayload := fmt.Sprintf(`{
-			"type": "RunProcedure",
-			"params": {
-				"procedure": "%s_ProcedureApply"
-			}
-		}`, state.Name.ValueString())
-
-		err = r.makeAPICall(runProcedurePayload, r.endpoint+"execute")
+		// 3. Run Procedure, one at a time per server
+		serverName := serverName(state)
+		unlock, err := r.serverLocks.lockServer(ctx, r.client, serverName)
 		if err != nil {
-			resp.Diagnostics.AddError("API Error", fmt.Sprintf("Error running procedure: %s", err))
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("waiting for other procedures on server %q", serverName), err)
+			return
+		}
+		defer unlock()
+		update, err = r.client.RunProcedure(ctx, state.Name.ValueString()+"_ProcedureApply")
+		if err != nil {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("running procedure %q", state.Name.ValueString()+"_ProcedureApply"), err)
+			return
+		}
+		if err := waitForUpdate(ctx, r.client, update, procedureRunTimeout); err != nil {
+			addAPIError(&resp.Diagnostics, "Procedure Error", fmt.Sprintf("running procedure %q", state.Name.ValueString()+"_ProcedureApply"), err)
 			return
 		}
 	}
-	
-	resp.State.Set(ctx, &state)
-}
 
-func (r *komodoResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
-	tfresource.ImportStatePassthroughID(ctx, tfpath.Root("id"), req, resp)
+	// The keys live in resources.toml, so without a file they stay as they
+	// were.
+	if state.SSHPrivateKey.IsUnknown() || state.SSHPublicKey.IsUnknown() {
+		state.SSHPrivateKey = oldState.SSHPrivateKey
+		state.SSHPublicKey = oldState.SSHPublicKey
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
 
-// Add this new method to create GitHub repository
-func (r *komodoResource) createGitHubRepository(ctx context.Context, repoName string, fileContents string, generateSSHKeys bool) (string, string, error) {
-	// Sanitize the repository name and append "_syncresources"
-	sanitizedName := sanitizeRepoName(repoName) + "_syncresources"
+// resumeDeployment finishes a Create that failed with rollback_on_failure =
+// false, starting from the phase that failed. If file_contents changed in the
+// meantime the new contents are pushed first and the syncs run again.
+func (r *komodoResource) resumeDeployment(ctx context.Context, state *KomodoModel, oldState KomodoModel, checkpoint *createCheckpoint, resp *tfresource.UpdateResponse) {
+	tflog.SubsystemInfo(ctx, logSubsystem, "Resuming client deployment", map[string]any{
+		"completed_phases": checkpoint.Completed,
+	})
 
-	// Check if token is available
-	if r.githubToken == "" {
-		return "", "", fmt.Errorf("GitHub token is not set. Please provide it via configuration or GITHUB_TOKEN environment variable")
-	}
+	state.SSHPrivateKey = oldState.SSHPrivateKey
+	state.SSHPublicKey = oldState.SSHPublicKey
 
-	// Use the token from the provider configuration
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: r.githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	// Create repository - set Private to true
-	repo := &github.Repository{
-		Name:        github.String(sanitizedName),
-		Description: github.String("Created by custom Terraform provider"),
-		Private:     github.Bool(true), // Changed to true to make the repository private
-		AutoInit:    github.Bool(true), // Initialize with README so we have a main branch
+	fileContents := ""
+	if !state.FileContents.IsNull() {
+		fileContents = state.FileContents.ValueString()
 	}
-
-	// If org name is provided, create in that organization
-	// Otherwise, create in the authenticated user's account
-	owner := ""
-	if r.githubOrgname != "" {
-		owner = r.githubOrgname
+	if checkpoint.ContentsSHA256 != "" && checkpoint.ContentsSHA256 != contentsSHA256(fileContents) {
+		if state.SyncMode.ValueString() != syncModeInline && checkpoint.done(phaseRepository) {
+			owner, err := r.repoOwner(ctx, r.orgname(*state))
+			if err != nil {
+				resp.Diagnostics.AddError("Git Error", fmt.Sprintf("Failed to get authenticated user: %v", err))
+				return
+			}
+			generateSSHKeys := !state.GenerateSSHKeys.IsNull() && state.GenerateSSHKeys.ValueBool()
+			privateKey, publicKey, err := r.updateFileInRepository(ctx, sanitizeRepoName(state.Name.ValueString()), owner, fileContents, generateSSHKeys, oldState.SSHPrivateKey.ValueString(), oldState.SSHPublicKey.ValueString())
+			if err != nil {
+				resp.Diagnostics.AddError("Git Error", fmt.Sprintf("Error updating file in repository: %s", err))
+				return
+			}
+			if privateKey != "" && publicKey != "" {
+				state.SSHPrivateKey = tftypes.StringValue(privateKey)
+				state.SSHPublicKey = tftypes.StringValue(publicKey)
+			} else if !generateSSHKeys {
+				state.SSHPrivateKey = tftypes.StringValue("")
+				state.SSHPublicKey = tftypes.StringValue("")
+			}
+			checkpoint.ContentsSHA256 = contentsSHA256(fileContents)
+		}
+		checkpoint.reset(phaseSyncs)
 	}
 
-	_, _, err := client.Repositories.Create(ctx, owner, repo)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create GitHub repository: %v", err)
+	r.applyDeployment(ctx, state, checkpoint, &resp.Diagnostics, nil)
+	if resp.Diagnostics.HasError() {
+		// Keep the progress made by this attempt for the next one.
+		state.CreateComplete = tftypes.BoolValue(false)
+		resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+		resp.Diagnostics.Append(setCreateCheckpoint(ctx, resp.Private, checkpoint)...)
+		return
 	}
 
-	// Wait a moment for the repository to be fully initialized
-	time.Sleep(2 * time.Second)
-
-	// Get the default branch name
-	repoOwner := owner
-	if repoOwner == "" {
-		user, _, err := client.Users.Get(ctx, "")
-		if err != nil {
-			return "", "", fmt.Errorf("failed to get authenticated user: %v", err)
-		}
-		repoOwner = *user.Login
-	}
+	tflog.SubsystemInfo(ctx, logSubsystem, "Resumed client deployment")
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+	resp.Diagnostics.Append(setCreateCheckpoint(ctx, resp.Private, nil)...)
+}
 
-	var privateKey, publicKey string
+// ImportState adopts an existing client deployment. The import ID is either
+// the client name or "<github_orgname>/<name>" when the sync repository lives
+// outside the provider's github_orgname. The model is rebuilt from the
+// <name>_syncresources repository, the server-<name> server and the
+// ContextWare/ResourceSetup syncs.
+func (r *komodoResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
 
-	// Generate SSH key pair if requested
-	if generateSSHKeys {
-		privateKey, publicKey, err = r.generateSSHKeyPair()
-		if err != nil {
-			return "", "", fmt.Errorf("failed to generate SSH key pair: %v", err)
-		}
+	name := req.ID
+	orgname := ""
+	if i := strings.LastIndex(req.ID, "/"); i >= 0 {
+		orgname, name = req.ID[:i], req.ID[i+1:]
+	}
+	if name == "" {
+		resp.Diagnostics.AddError(
+			"Unexpected Import Identifier",
+			fmt.Sprintf("Expected import identifier with format: <name> or <github_orgname>/<name>. Got: %q", req.ID),
+		)
+		return
+	}
 
-		// Upload the public key as a deploy key
-		deployKeyTitle := fmt.Sprintf("terraform-deploy-key-%d", time.Now().Unix())
-		err = r.uploadDeployKey(ctx, repoOwner, sanitizedName, publicKey, deployKeyTitle, false)
-		if err != nil {
-			return "", "", fmt.Errorf("failed to upload deploy key: %v", err)
-		}
+	state := KomodoModel{
+		Id:                   tftypes.StringValue(name),
+		Name:                 tftypes.StringValue(name),
+		ServerIP:             tftypes.StringNull(),
+		GithubOrgname:        tftypes.StringNull(),
+		GitAccount:           tftypes.StringNull(),
+		ServerID:             tftypes.StringNull(),
+		RollbackOnFailure:    tftypes.BoolValue(true),
+		CreateComplete:       tftypes.BoolValue(true),
+		DeletionProtection:   tftypes.BoolValue(false),
+		ArchiveRepoOnDestroy: tftypes.BoolValue(false),
+		Timeouts: timeouts.Value{Object: tftypes.ObjectNull(map[string]attr.Type{
+			"create": tftypes.StringType,
+			"update": tftypes.StringType,
+			"delete": tftypes.StringType,
+		})},
+	}
+	if orgname != "" {
+		state.GithubOrgname = tftypes.StringValue(orgname)
 	}
 
-	// If file contents are provided, create the file
-	if fileContents != "" {
-		updatedFileContents := fileContents
+	serverName := serverName(state)
+	if _, err := r.client.GetServer(ctx, serverName); err != nil {
+		addAPIError(&resp.Diagnostics, "Import Error", fmt.Sprintf("reading server %q", serverName), err)
+		return
+	}
+	resourceSetup, err := r.client.GetResourceSync(ctx, name+"_ResourceSetup")
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "Import Error", fmt.Sprintf("reading resource sync %q", name+"_ResourceSetup"), err)
+		return
+	}
 
-		// Add SSH keys to the file contents if they were generated
-		if generateSSHKeys && privateKey != "" && publicKey != "" {
-			updatedFileContents = r.addSSHKeysToFileContents(fileContents, privateKey, publicKey)
+	// Without a ContextWare bootstrap sync, a ResourceSetup sync that is not
+	// backed by a repository is an inline deployment.
+	_, err = r.client.GetResourceSync(ctx, name+"_ContextWare")
+	if komodo.IsNotFound(err) && (resourceSetup.Config.Repo == nil || *resourceSetup.Config.Repo == "") {
+		state.SyncMode = tftypes.StringValue(syncModeInline)
+		state.GenerateSSHKeys = tftypes.BoolNull()
+		state.SSHPrivateKey = tftypes.StringValue("")
+		state.SSHPublicKey = tftypes.StringValue("")
+		state.FileContents = tftypes.StringNull()
+		if resourceSetup.Config.FileContents != nil && *resourceSetup.Config.FileContents != "" {
+			state.FileContents = tftypes.StringValue(*resourceSetup.Config.FileContents)
 		}
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "Import Error", fmt.Sprintf("reading resource sync %q", name+"_ContextWare"), err)
+		return
+	}
+	state.SyncMode = tftypes.StringValue(syncModeGit)
 
-		// Get the repository to determine the default branch
-		repoInfo, _, err := client.Repositories.Get(ctx, repoOwner, sanitizedName)
-		if err != nil {
-			return "", "", fmt.Errorf("failed to get repository info: %v", err)
-		}
+	contents, found, err := r.getRepositoryFile(ctx, r.orgname(state), name)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "Import Error", "reading resources.toml from repository", err)
+		return
+	}
+	if !found {
+		resp.Diagnostics.AddError("Import Error", fmt.Sprintf("Repository %s_syncresources does not exist", sanitizeRepoName(name)))
+		return
+	}
 
-		defaultBranch := "main"
-		if repoInfo.DefaultBranch != nil {
-			defaultBranch = *repoInfo.DefaultBranch
-		}
+	state.FileContents = tftypes.StringNull()
+	if stripped := stripSSHKeysFromFileContents(contents); stripped != "" {
+		state.FileContents = tftypes.StringValue(stripped)
+	}
 
-		// Create the file - changed from contents.txt to resources.toml
-		fileContent := []byte(updatedFileContents)
-		commitMessage := "Add resources.toml via Terraform"
-		if generateSSHKeys && privateKey != "" && publicKey != "" {
-			commitMessage = "Add resources.toml with SSH keys via Terraform"
-		}
+	state.GenerateSSHKeys, state.SSHPrivateKey, state.SSHPublicKey = importedSSHKeys(contents)
 
-		opts := &github.RepositoryContentFileOptions{
-			Message:   github.String(commitMessage),
-			Content:   fileContent,
-			Branch:    github.String(defaultBranch),
-			Committer: &github.CommitAuthor{
-				Name:  github.String("Terraform Provider"),
-				Email: github.String("terraform@example.com"),
-			},
-		}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
 
-		_, _, err = client.Repositories.CreateFile(ctx, repoOwner, sanitizedName, "resources.toml", opts)
-		if err != nil {
-			return "", "", fmt.Errorf("failed to create file in repository: %v", err)
-		}
+// importedSSHKeys returns generate_ssh_keys, ssh_private_key and
+// ssh_public_key for a deployment whose resources.toml is contents.
+// generate_ssh_keys is optional without a default, so a deployment without
+// keys is imported with it unset rather than false, matching a configuration
+// that leaves it out.
+func importedSSHKeys(contents string) (generate tftypes.Bool, privateKey, publicKey tftypes.String) {
+	private, public := extractSSHKeysFromFileContents(contents)
+	if private == "" || public == "" {
+		return tftypes.BoolNull(), tftypes.StringValue(""), tftypes.StringValue("")
 	}
+	return tftypes.BoolValue(true), tftypes.StringValue(restorePEMHeaders(private)), tftypes.StringValue(public)
+}
 
-	return privateKey, publicKey, nil
+// serverName returns the Komodo server a deployment runs on: server_id when
+// set, otherwise server-<lower(name)>, the name its periphery registers
+// under.
+func serverName(data KomodoModel) string {
+	if !data.ServerID.IsNull() && !data.ServerID.IsUnknown() && data.ServerID.ValueString() != "" {
+		return data.ServerID.ValueString()
+	}
+	return fmt.Sprintf("server-%s", strings.ToLower(data.Name.ValueString()))
 }
 
-// Delete GitHub repository
-func (r *komodoResource) deleteGitHubRepository(ctx context.Context, repoName string) error {
-	// Sanitize the repository name and append _syncresources
-	sanitizedName := sanitizeRepoName(repoName) + "_syncresources"
-	
-	// Use the token from the provider configuration
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: r.githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-	
-	// Determine the owner (org or user)
-	owner := ""
-	if r.githubOrgname != "" {
-		owner = r.githubOrgname
-	} else {
-		// Get the authenticated user
-		user, _, err := client.Users.Get(ctx, "")
-		if err != nil {
-			return fmt.Errorf("failed to get authenticated user: %v", err)
-		}
-		owner = *user.Login
+// resolveGitAccount returns the Komodo git account the ResourceSetup sync
+// clones with: the resource's git_account, then the provider's, then the
+// repository owner.
+func (r *komodoResource) resolveGitAccount(data KomodoModel, owner string) string {
+	if !data.GitAccount.IsNull() && !data.GitAccount.IsUnknown() && data.GitAccount.ValueString() != "" {
+		return data.GitAccount.ValueString()
 	}
-	
-	// Delete the repository
-	_, err := client.Repositories.Delete(ctx, owner, sanitizedName)
-	if err != nil {
-		return fmt.Errorf("failed to delete GitHub repository: %v", err)
+	if r.gitAccount != "" {
+		return r.gitAccount
 	}
-	
-	return nil
+	return owner
 }
 
-// Helper function to sanitize repository names
-func sanitizeRepoName(name string) string {
-	// Replace spaces with hyphens
-	name = strings.ReplaceAll(name, " ", "-")
-	
-	// Remove special characters
-	reg := regexp.MustCompile(`[^a-zA-Z0-9\-_.]`)
-	name = reg.ReplaceAllString(name, "")
-	
-	// Convert to lowercase
-	name = strings.ToLower(name)
-	
-	return name
+// orgname returns the git host organization for the sync repository of data,
+// falling back to the provider's github_orgname. An empty result means the
+// authenticated user's account.
+func (r *komodoResource) orgname(data KomodoModel) string {
+	if !data.GithubOrgname.IsNull() && !data.GithubOrgname.IsUnknown() && data.GithubOrgname.ValueString() != "" {
+		return data.GithubOrgname.ValueString()
+	}
+	return r.githubOrgname
 }
 
-// Add this new method to update the file in the repository
-func (r *komodoResource) updateFileInRepository(ctx context.Context, repoName, owner, fileContents string, generateSSHKeys bool) (string, string, error) {
-	// Append _syncresources to the repo name
-	repoName = repoName + "_syncresources"
-
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: r.githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	// Get the repository to determine the default branch
-	repoInfo, _, err := client.Repositories.Get(ctx, owner, repoName)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to get repository info: %v", err)
+// upsertInlineResourceSetupSync creates the <name>_ResourceSetup sync with
+// fileContents as its UI-defined contents, or updates it if it already
+// exists. Used instead of the ContextWare bootstrap in inline sync mode.
+func (r *komodoResource) upsertInlineResourceSetupSync(ctx context.Context, name, fileContents string) error {
+	if err := r.client.RequireCoreVersion(komodo.MinFileContentsVersion, `sync_mode = "inline"`); err != nil {
+		return err
 	}
-
-	defaultBranch := "main"
-	if repoInfo.DefaultBranch != nil {
-		defaultBranch = *repoInfo.DefaultBranch
+	syncName := name + "_ResourceSetup"
+	config := komodo.ResourceSyncConfig{
+		FileContents:      komodo.Ptr(fileContents),
+		IncludeUserGroups: komodo.Ptr(true),
 	}
 
-	// Get the current file to get its SHA and extract existing SSH keys
-	fileContent, _, _, err := client.Repositories.GetContents(
-		ctx,
-		owner,
-		repoName,
-		"resources.toml", // Changed from contents.txt to resources.toml
-		&github.RepositoryContentGetOptions{Ref: defaultBranch},
-	)
-
-	updatedFileContents := fileContents
-
-	// Handle SSH keys based on the generateSSHKeys flag
-	if generateSSHKeys {
-		// If the file exists, try to preserve existing SSH keys
-		if err == nil && fileContent != nil {
-			existingContent, err := fileContent.GetContent()
-			if err == nil {
-				// Extract SSH keys from existing content (handle both quoted and unquoted)
-				privateKeyPattern := `SSH_PRIVATE_KEY="?([^"\n]+)"?`
-				publicKeyPattern := `SSH_PUBLIC_KEY="?([^"\n]+)"?`
-
-				privateKeyRe := regexp.MustCompile(privateKeyPattern)
-				publicKeyRe := regexp.MustCompile(publicKeyPattern)
-
-				privateKeyMatch := privateKeyRe.FindStringSubmatch(existingContent)
-				publicKeyMatch := publicKeyRe.FindStringSubmatch(existingContent)
-
-				if len(privateKeyMatch) > 1 && len(publicKeyMatch) > 1 {
-					// Use existing SSH keys
-					privateKey := strings.ReplaceAll(privateKeyMatch[1], "\\n", "\n")
-					publicKey := publicKeyMatch[1]
-					updatedFileContents = r.addSSHKeysToFileContents(fileContents, privateKey, publicKey)
-				} else {
-					// Generate new SSH keys if none exist
-					privateKey, publicKey, err := r.generateSSHKeyPair()
-					if err != nil {
-						return "", "", fmt.Errorf("failed to generate SSH key pair: %v", err)
-					}
-
-					// Upload the new deploy key
-					deployKeyTitle := fmt.Sprintf("terraform-deploy-key-%d", time.Now().Unix())
-					err = r.uploadDeployKey(ctx, owner, repoName, publicKey, deployKeyTitle, false)
-					if err != nil {
-						return "", "", fmt.Errorf("failed to upload deploy key: %v", err)
-					}
-
-					updatedFileContents = r.addSSHKeysToFileContents(fileContents, privateKey, publicKey)
-				}
-			}
-		} else {
-			// File doesn't exist yet, generate new SSH keys
-			privateKey, publicKey, err := r.generateSSHKeyPair()
-			if err != nil {
-				return "", "", fmt.Errorf("failed to generate SSH key pair: %v", err)
-			}
-
-			// Upload the new deploy key
-			deployKeyTitle := fmt.Sprintf("terraform-deploy-key-%d", time.Now().Unix())
-			err = r.uploadDeployKey(ctx, owner, repoName, publicKey, deployKeyTitle, false)
-			if err != nil {
-				return "", "", fmt.Errorf("failed to upload deploy key: %v", err)
-			}
-
-			updatedFileContents = r.addSSHKeysToFileContents(fileContents, privateKey, publicKey)
-		}
+	_, err := r.client.GetResourceSync(ctx, syncName)
+	if komodo.IsNotFound(err) {
+		_, err = r.client.CreateResourceSync(ctx, syncName, config)
+		return err
 	}
+	if err != nil {
+		return err
+	}
+	_, err = r.client.UpdateResourceSync(ctx, syncName, config)
+	return err
+}
 
-	// Create update options
-	opts := &github.RepositoryContentFileOptions{
-		Message:   github.String("Update resources.toml via Terraform"),
-		Content:   []byte(updatedFileContents),
-		Branch:    github.String(defaultBranch),
-		Committer: &github.CommitAuthor{
-			Name:  github.String("Terraform Provider"),
-			Email: github.String("terraform@example.com"),
-		},
+// upsertContextWareSync creates the <name>_ContextWare sync, or updates its
+// config if it already exists.
+func (r *komodoResource) upsertContextWareSync(ctx context.Context, name, repoOwner, gitAccount string) error {
+	if err := r.requireGitHost(); err != nil {
+		return err
 	}
+	gitProvider, gitHTTPS := r.gitHost.KomodoGitProvider()
 
-	// If the file exists, include its SHA
-	if err == nil && fileContent != nil {
-		opts.SHA = fileContent.SHA
+	syncName := name + "_ContextWare"
+	config := komodo.ResourceSyncConfig{
+		FileContents: komodo.Ptr(contextWareFileContents(name, gitProvider, gitHTTPS, repoOwner, gitAccount)),
 	}
 
-	_, _, err = client.Repositories.CreateFile(ctx, owner, repoName, "resources.toml", opts)
+	_, err := r.client.GetResourceSync(ctx, syncName)
+	if komodo.IsNotFound(err) {
+		_, err = r.client.CreateResourceSync(ctx, syncName, config)
+		return err
+	}
 	if err != nil {
-		return "", "", fmt.Errorf("failed to update file in repository: %v", err)
+		return err
 	}
+	_, err = r.client.UpdateResourceSync(ctx, syncName, config)
+	return err
+}
 
-	// Extract SSH keys from the updated content to return them
-	var privateKey, publicKey string
-	if generateSSHKeys {
-		privateKeyPattern := `SSH_PRIVATE_KEY="?([^"\n]+)"?`
-		publicKeyPattern := `SSH_PUBLIC_KEY="?([^"\n]+)"?`
-
-		privateKeyRe := regexp.MustCompile(privateKeyPattern)
-		publicKeyRe := regexp.MustCompile(publicKeyPattern)
-
-		privateKeyMatch := privateKeyRe.FindStringSubmatch(updatedFileContents)
-		publicKeyMatch := publicKeyRe.FindStringSubmatch(updatedFileContents)
+// contextWareSyncChanged reports whether the <name>_ContextWare sync is
+// missing or holds other contents than upsertContextWareSync would write.
+func (r *komodoResource) contextWareSyncChanged(ctx context.Context, name, repoOwner, gitAccount string) (bool, error) {
+	if err := r.requireGitHost(); err != nil {
+		return false, err
+	}
+	gitProvider, gitHTTPS := r.gitHost.KomodoGitProvider()
 
-		if len(privateKeyMatch) > 1 {
-			privateKey = strings.ReplaceAll(privateKeyMatch[1], "\\n", "\n")
-		}
-		if len(publicKeyMatch) > 1 {
-			publicKey = publicKeyMatch[1]
-		}
+	sync, err := r.client.GetResourceSync(ctx, name+"_ContextWare")
+	if komodo.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	return deref(sync.Config.FileContents) != contextWareFileContents(name, gitProvider, gitHTTPS, repoOwner, gitAccount), nil
+}
 
-	return privateKey, publicKey, nil
+// contextWareFileContents builds the TOML for the outer <name>_ContextWare
+// sync, which in turn defines the <name>_ResourceSetup sync pointing at the
+// client's resources repository <repoOwner>/<name>_syncresources on the
+// gitProvider host.
+func contextWareFileContents(name, gitProvider string, gitHTTPS bool, repoOwner, gitAccount string) string {
+	return fmt.Sprintf(`[[resource_sync]]
+name = %s
+[resource_sync.config]
+git_provider = %s
+git_https = %t
+repo = %s
+git_account = %s
+resource_path = [%s]
+include_user_groups = true
+`,
+		tomlString(name+"_ResourceSetup"),
+		tomlString(gitProvider),
+		gitHTTPS,
+		tomlString(repoOwner+"/"+sanitizeRepoName(name)+"_syncresources"),
+		tomlString(gitAccount),
+		tomlString(syncRepositoryFile),
+	)
 }
 
-// Helper method to make API calls
-func (r *komodoResource) makeAPICall(payload string, url string) error {
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(payload)))
-	if err != nil {
-		return fmt.Errorf("error creating request: %s", err)
-	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Api-Key", r.apiKey)
-	req.Header.Set("X-Api-Secret", r.apiSecret)
-	
-	resp, err := r.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending request: %s", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("received non-OK HTTP status: %s, body: %s", resp.Status, string(bodyBytes))
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
 	}
-	
-	return nil
+	b.WriteByte('"')
+	return b.String()
 }
 
 // waitForResourceSyncExists polls GetResourceSync until the resource is
 // retrievable. Komodo's execute endpoint is async, so a successful RunSync on
 // an outer sync that creates an inner sync returns before the inner exists.
-func (r *komodoResource) waitForResourceSyncExists(syncName string, maxAttempts int, sleepDuration time.Duration) error {
-	payload := fmt.Sprintf(`{"type":"GetResourceSync","params":{"sync":"%s"}}`, syncName)
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if err := r.makeAPICall(payload, r.endpoint+"read"); err == nil {
-			return nil
-		}
-		time.Sleep(sleepDuration)
+func (r *komodoResource) waitForResourceSyncExists(ctx context.Context, syncName string, timeout, interval time.Duration) error {
+	err := pollUntil(ctx, timeout, interval, func(ctx context.Context) bool {
+		_, err := r.client.GetResourceSync(ctx, syncName)
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("resource sync %s did not appear: %w", syncName, err)
 	}
-	return fmt.Errorf("resource sync %s did not appear after %d attempts", syncName, maxAttempts)
+	return nil
 }
 
 // waitForProcedureExists polls GetProcedure until it returns 200. Used to
 // confirm a sync has actually applied its TOML before RunProcedure is called.
-func (r *komodoResource) waitForProcedureExists(procedureName string, maxAttempts int, sleepDuration time.Duration) error {
-	payload := fmt.Sprintf(`{"type":"GetProcedure","params":{"procedure":"%s"}}`, procedureName)
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if err := r.makeAPICall(payload, r.endpoint+"read"); err == nil {
-			return nil
-		}
-		time.Sleep(sleepDuration)
-	}
-	return fmt.Errorf("procedure %s did not appear after %d attempts", procedureName, maxAttempts)
-}
-
-// Add this helper function to check if a server is available
-func (r *komodoResource) waitForServerAvailability(serverName string, maxAttempts int, sleepDuration time.Duration) error {
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		// Create the GetServer payload
-		getServerPayload := fmt.Sprintf(`{
-			"type": "GetServer",
-			"params": {
-				"server": "%s"
-			}
-		}`, serverName)
-		
-		// Make the API call
-		client := &http.Client{Timeout: 60 * time.Second}
-		req, err := http.NewRequest("POST", r.endpoint+"read", bytes.NewBuffer([]byte(getServerPayload)))
-		if err != nil {
-			return fmt.Errorf("error creating request: %s", err)
-		}
-		
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Api-Key", r.apiKey)
-		req.Header.Set("X-Api-Secret", r.apiSecret)
-		
-		resp, err := client.Do(req)
-		if err != nil {
-			// If there's an error, wait and try again
-			time.Sleep(sleepDuration)
-			continue
-		}
-		
-		defer resp.Body.Close()
-		
-		// If we get a 200 OK, the server exists
-		if resp.StatusCode == http.StatusOK {
-			// Server exists in Komodo - periphery has connected and self-registered
-			// In outbound mode, periphery connects to Core so no address is stored
-			return nil
-		}
-		
-		// Wait before the next attempt
-		time.Sleep(sleepDuration)
-	}
-	
-	return fmt.Errorf("server %s did not become available after %d attempts", serverName, maxAttempts)
-}
-
-// Add this helper function to check if a server is in OK state
-func (r *komodoResource) waitForServerStateEnabled(serverName string, maxAttempts int, sleepDuration time.Duration) error {
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		// Create the GetServerState payload
-		getServerStatePayload := fmt.Sprintf(`{
-			"type": "GetServerState",
-			"params": {
-				"server": "%s"
-			}
-		}`, serverName)
-		
-		// Make the API call
-		client := &http.Client{Timeout: 60 * time.Second}
-		req, err := http.NewRequest("POST", r.endpoint+"read", bytes.NewBuffer([]byte(getServerStatePayload)))
-		if err != nil {
-			return fmt.Errorf("error creating request: %s", err)
-		}
-		
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Api-Key", r.apiKey)
-		req.Header.Set("X-Api-Secret", r.apiSecret)
-		
-		resp, err := client.Do(req)
-		if err != nil {
-			// If there's an error, wait and try again
-			time.Sleep(sleepDuration)
-			continue
-		}
-		
-		defer resp.Body.Close()
-		
-		// If we get a 200 OK, check the server state
-		if resp.StatusCode == http.StatusOK {
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return fmt.Errorf("error reading response body: %s", err)
-			}
-			
-			// Parse the response to check the server state
-			var result map[string]interface{}
-			err = json.Unmarshal(bodyBytes, &result)
-			if err != nil {
-				return fmt.Errorf("error parsing response: %s", err)
-			}
-			
-			// Check if the server state is "Ok"
-			if status, ok := result["status"].(string); ok && status == "Ok" {
-				return nil
-			}
-		}
-		
-		// Wait before the next attempt
-		time.Sleep(sleepDuration)
+func (r *komodoResource) waitForProcedureExists(ctx context.Context, procedureName string, timeout, interval time.Duration) error {
+	err := pollUntil(ctx, timeout, interval, func(ctx context.Context) bool {
+		_, err := r.client.GetProcedure(ctx, procedureName)
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("procedure %s did not appear: %w", procedureName, err)
 	}
-	
-	return fmt.Errorf("server %s did not reach OK state after %d attempts", serverName, maxAttempts)
+	return nil
 }
 
 // generateSSHKeyPair generates an ed25519 SSH key pair and returns (privateKey, publicKey, error)
@@ -1113,50 +1346,76 @@ func (r *komodoResource) generateSSHKeyPair() (string, string, error) {
 	return privateKeyString, strings.TrimSpace(publicKeyString), nil
 }
 
-// uploadDeployKey uploads the public key as a deploy key to the GitHub repository
-func (r *komodoResource) uploadDeployKey(ctx context.Context, owner, repoName, publicKey, title string, readOnly bool) error {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: r.githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+// stripPEMHeaders strips the PEM headers from the key so that we can store as one line in the .env file
+func stripPEMHeaders(key string) string {
+	var lines []string
+	for _, line := range strings.Split(key, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" ||
+			strings.HasPrefix(line, "-----BEGIN") ||
+			strings.HasPrefix(line, "-----END") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "")
+}
+
+// sshKeysSectionPattern matches the SSH key lines added by
+// addSSHKeysToFileContents.
+var sshKeysSectionPattern = regexp.MustCompile(`\nSSH_PRIVATE_KEY="[^"\n]*"\nSSH_PUBLIC_KEY="[^"\n]*"\n`)
+
+// stripSSHKeysFromFileContents reverses addSSHKeysToFileContents so the
+// repository copy of resources.toml can be compared with file_contents.
+func stripSSHKeysFromFileContents(fileContents string) string {
+	return sshKeysSectionPattern.ReplaceAllString(fileContents, "")
+}
 
-	// Create deploy key
-	deployKey := &github.Key{
-		Title:    github.String(title),
-		Key:      github.String(publicKey),
-		ReadOnly: github.Bool(readOnly),
+// extractSSHKeysFromFileContents returns the SSH keys embedded in
+// resources.toml by addSSHKeysToFileContents, or empty strings if there are
+// none.
+func extractSSHKeysFromFileContents(fileContents string) (string, string) {
+	privateKeyRe := regexp.MustCompile(`SSH_PRIVATE_KEY="?([^"\n]+)"?`)
+	publicKeyRe := regexp.MustCompile(`SSH_PUBLIC_KEY="?([^"\n]+)"?`)
+
+	var privateKey, publicKey string
+	if m := privateKeyRe.FindStringSubmatch(fileContents); len(m) > 1 {
+		privateKey = m[1]
+	}
+	if m := publicKeyRe.FindStringSubmatch(fileContents); len(m) > 1 {
+		publicKey = m[1]
 	}
+	return privateKey, publicKey
+}
 
-	_, _, err := client.Repositories.CreateKey(ctx, owner, repoName, deployKey)
+// restorePEMHeaders reverses stripPEMHeaders, turning the single-line key
+// stored in the .env section back into the OpenSSH PEM block produced by
+// generateSSHKeyPair.
+func restorePEMHeaders(key string) string {
+	if key == "" {
+		return ""
+	}
+	der, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
-		return fmt.Errorf("failed to upload deploy key: %v", err)
+		return key
 	}
-
-	return nil
+	return string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: der}))
 }
 
-// stripPEMHeaders strips the PEM headers from the key so that we can store as one line in the .env file
-func stripPEMHeaders(key string) string {
-    var lines []string
-    for _, line := range strings.Split(key, "\n") {
-        line = strings.TrimSpace(line)
-        if line == "" ||
-            strings.HasPrefix(line, "-----BEGIN") ||
-            strings.HasPrefix(line, "-----END") {
-            continue
-        }
-        lines = append(lines, line)
-    }
-    return strings.Join(lines, "")
+// environmentSection matches the environment section of resources.toml that
+// generated SSH keys are added to. (?s) makes . match newlines.
+var environmentSection = regexp.MustCompile(`(?s)environment = """(.*?)"""`)
+
+// canEmbedSSHKeys reports whether fileContents has an environment section to
+// hold generated SSH keys.
+func canEmbedSSHKeys(fileContents string) bool {
+	return environmentSection.MatchString(fileContents)
 }
 
 // addSSHKeysToFileContents adds SSH keys to the environment section of the file contents
 func (r *komodoResource) addSSHKeysToFileContents(fileContents, privateKey, publicKey string) string {
 	// Find the environment section and add SSH keys before the closing """
-	// Use (?s) flag to make . match newlines (DOTALL mode)
-	envPattern := `(?s)environment = """(.*?)"""`
-	re := regexp.MustCompile(envPattern)
+	re := environmentSection
 
 	return re.ReplaceAllStringFunc(fileContents, func(match string) string {
 		// Extract the current environment content
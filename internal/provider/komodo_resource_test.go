@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestAddSSHKeysToFileContents(t *testing.T) {
+	r := &komodoResource{}
+	privateKey, publicKey, err := r.generateSSHKeyPair()
+	if err != nil {
+		t.Fatalf("generating key pair: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		contents  string
+		wantEmbed bool
+	}{
+		{
+			name: "environment section",
+			contents: `[[stack]]
+name = "app"
+[stack.config]
+environment = """
+PORT=8080
+"""
+`,
+			wantEmbed: true,
+		},
+		{
+			name: "no environment section",
+			contents: `[[stack]]
+name = "app"
+[stack.config]
+file_contents = "services: {}"
+`,
+			wantEmbed: false,
+		},
+		{
+			name:      "empty file",
+			contents:  "",
+			wantEmbed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canEmbedSSHKeys(tt.contents); got != tt.wantEmbed {
+				t.Errorf("canEmbedSSHKeys = %t, want %t", got, tt.wantEmbed)
+			}
+
+			updated := r.addSSHKeysToFileContents(tt.contents, privateKey, publicKey)
+			gotPrivate, gotPublic := extractSSHKeysFromFileContents(updated)
+			if !tt.wantEmbed {
+				if updated != tt.contents {
+					t.Errorf("contents without an environment section changed:\n%s", updated)
+				}
+				if gotPrivate != "" || gotPublic != "" {
+					t.Errorf("extracted keys %q, %q from a file without them", gotPrivate, gotPublic)
+				}
+				return
+			}
+			if restorePEMHeaders(gotPrivate) != privateKey {
+				t.Errorf("private key did not survive embedding:\n%s", restorePEMHeaders(gotPrivate))
+			}
+			if gotPublic != strings.TrimSpace(publicKey) {
+				t.Errorf("public key = %q, want %q", gotPublic, strings.TrimSpace(publicKey))
+			}
+			if !strings.Contains(updated, "PORT=8080\n") {
+				t.Errorf("existing environment lost:\n%s", updated)
+			}
+		})
+	}
+}
+
+func TestTOMLString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", `"alice"`},
+		{"", `""`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\deploy`, `"C:\\deploy"`},
+		{"a\nb\tc\rd", `"a\nb\tc\rd"`},
+		{"bell\x07", `"bell\u0007"`},
+		{"del\x7f", `"del\u007F"`},
+		{"ünïcode", `"ünïcode"`},
+		{`x"\n[[stack]]`, `"x\"\\n[[stack]]"`},
+	}
+	for _, tt := range tests {
+		got := tomlString(tt.value)
+		if got != tt.want {
+			t.Errorf("tomlString(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+		// The escapes used are a subset of JSON's, so a JSON decoder reads
+		// the value back as a TOML parser would.
+		var decoded string
+		if err := json.Unmarshal([]byte(got), &decoded); err != nil || decoded != tt.value {
+			t.Errorf("tomlString(%q) decodes to %q (%v)", tt.value, decoded, err)
+		}
+	}
+}
+
+func TestContextWareFileContentsQuotesValues(t *testing.T) {
+	contents := contextWareFileContents(`evil"name`, "github.com", true, `org\x`, "bot\n[[stack]]")
+	for _, want := range []string{
+		`name = "evil\"name_ResourceSetup"`,
+		`git_account = "bot\n[[stack]]"`,
+	} {
+		if !strings.Contains(contents, want) {
+			t.Errorf("ContextWare contents missing %s:\n%s", want, contents)
+		}
+	}
+	if strings.Contains(contents, "\n[[stack]]\n") {
+		t.Errorf("git_account broke out of its string:\n%s", contents)
+	}
+}
+
+func TestImportedSSHKeys(t *testing.T) {
+	generate, privateKey, publicKey := importedSSHKeys("[[stack]]\nname = \"app\"\n")
+	if !generate.IsNull() {
+		t.Errorf("generate_ssh_keys = %s for a deployment without keys, want null", generate)
+	}
+	if privateKey.ValueString() != "" || publicKey.ValueString() != "" {
+		t.Errorf("keys = %q, %q for a deployment without keys", privateKey.ValueString(), publicKey.ValueString())
+	}
+
+	r := &komodoResource{}
+	private, public, err := r.generateSSHKeyPair()
+	if err != nil {
+		t.Fatalf("generating key pair: %s", err)
+	}
+	contents := r.addSSHKeysToFileContents("[[stack]]\n[stack.config]\nenvironment = \"\"\"\nPORT=8080\n\"\"\"\n", private, public)
+	generate, privateKey, publicKey = importedSSHKeys(contents)
+	if !generate.ValueBool() {
+		t.Errorf("generate_ssh_keys = %s for a deployment with keys, want true", generate)
+	}
+	if privateKey.ValueString() != private || publicKey.ValueString() != strings.TrimSpace(public) {
+		t.Errorf("imported keys do not match the embedded ones")
+	}
+}
+
+func TestRefreshPartialCreate(t *testing.T) {
+	// A core on which nothing of the deployment exists yet.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"did not find any resource matching acme"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+	r := &komodoResource{client: komodo.NewClient(server.URL, "key", "secret", server.Client())}
+
+	tests := []struct {
+		name       string
+		completed  []string
+		wantExists bool
+	}{
+		{"nothing created", nil, true},
+		{"server waited for", []string{phaseServer}, false},
+		{"syncs created", []string{phaseServer, phaseSyncs}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := KomodoModel{
+				Name:         tftypes.StringValue("acme"),
+				SyncMode:     tftypes.StringValue(syncModeInline),
+				FileContents: tftypes.StringValue("[[stack]]\n"),
+			}
+			exists, diags := r.refresh(context.Background(), &state, &createCheckpoint{Completed: tt.completed})
+			if diags.HasError() {
+				t.Fatalf("refresh: %v", diags)
+			}
+			if exists != tt.wantExists {
+				t.Fatalf("refresh = %t, want %t", exists, tt.wantExists)
+			}
+			if !exists {
+				return
+			}
+			if state.FileContents.ValueString() != "[[stack]]\n" {
+				t.Errorf("file_contents = %s, want it kept until the syncs exist", state.FileContents)
+			}
+			if state.CreateComplete.ValueBool() {
+				t.Error("create_complete = true for a partial create")
+			}
+		})
+	}
+
+	// Without a checkpoint the deployment was created completely, so a
+	// missing server means it was deleted.
+	state := KomodoModel{Name: tftypes.StringValue("acme"), SyncMode: tftypes.StringValue(syncModeInline)}
+	if exists, _ := r.refresh(context.Background(), &state, nil); exists {
+		t.Error("refresh of a complete deployment without its server = true, want false")
+	}
+}
@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Log subsystems. Their levels can be set on their own with
+// TF_LOG_PROVIDER_KOMODO_RESOURCE and TF_LOG_PROVIDER_KOMODO_HTTP; otherwise
+// they follow TF_LOG_PROVIDER / TF_LOG.
+const (
+	// logSubsystem carries the lifecycle of resources: repository creation,
+	// server waits, sync and procedure runs and cleanup.
+	logSubsystem = "resource"
+	// logSubsystemHTTP carries every HTTP request and response at TRACE.
+	logSubsystemHTTP = "http"
+)
+
+// maxLoggedBody caps how much of a request or response body is logged.
+const maxLoggedBody = 16 * 1024
+
+// secretFieldKeys are log field keys whose values are always masked.
+var secretFieldKeys = []string{"api_key", "api_secret", "github_token", "ssh_private_key"}
+
+// redactedHeaders are request headers logged as "***".
+var redactedHeaders = []string{"X-Api-Key", "X-Api-Secret", "Authorization", "Private-Token", "Cookie", "Proxy-Authorization"}
+
+// withLogging returns ctx with the provider's log subsystems set up and all
+// of secrets (API key, secret, git token) masked in the root logger and in
+// each subsystem, along with whatever komodo.Redact hides in error messages
+// (generated SSH keys, PEM private keys, secret environment values), so
+// TF_LOG output can be shared safely.
+func withLogging(ctx context.Context, secrets []string) context.Context {
+	ctx = tflog.NewSubsystem(ctx, logSubsystem, tflog.WithLevelFromEnv("TF_LOG_PROVIDER_KOMODO", logSubsystem))
+	ctx = tflog.NewSubsystem(ctx, logSubsystemHTTP, tflog.WithLevelFromEnv("TF_LOG_PROVIDER_KOMODO", logSubsystemHTTP))
+
+	var values []string
+	for _, secret := range secrets {
+		if secret != "" {
+			values = append(values, secret)
+		}
+	}
+
+	ctx = tflog.MaskFieldValuesWithFieldKeys(ctx, secretFieldKeys...)
+	ctx = tflog.MaskLogRegexes(ctx, komodo.RedactPatterns()...)
+	if len(values) > 0 {
+		ctx = tflog.MaskLogStrings(ctx, values...)
+	}
+	for _, subsystem := range []string{logSubsystem, logSubsystemHTTP} {
+		ctx = tflog.SubsystemMaskFieldValuesWithFieldKeys(ctx, subsystem, secretFieldKeys...)
+		ctx = tflog.SubsystemMaskLogRegexes(ctx, subsystem, komodo.RedactPatterns()...)
+		if len(values) > 0 {
+			ctx = tflog.SubsystemMaskLogStrings(ctx, subsystem, values...)
+		}
+	}
+	return ctx
+}
+
+// loggingTransport logs each request and response at TRACE in the http
+// subsystem. The logger, with its masks, comes from the request's context.
+type loggingTransport struct {
+	// service names the remote side in the log fields, e.g. "komodo".
+	service string
+	// logBodies enables body logging. Git hosts send file contents base64
+	// encoded, which the masks cannot see into, so their bodies are not
+	// logged.
+	logBodies bool
+	base      http.RoundTripper
+}
+
+func newLoggingTransport(service string, logBodies bool, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &loggingTransport{service: service, logBodies: logBodies, base: base}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	fields := map[string]any{
+		"service": t.service,
+		"method":  req.Method,
+		"url":     req.URL.Redacted(),
+		"headers": redactHeaders(req.Header),
+	}
+	if t.logBodies && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			fields["body"] = readLoggedBody(body)
+		}
+	}
+	tflog.SubsystemTrace(ctx, logSubsystemHTTP, "Sending HTTP request", fields)
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	duration := time.Since(start)
+	if err != nil {
+		tflog.SubsystemTrace(ctx, logSubsystemHTTP, "HTTP request failed", map[string]any{
+			"service":  t.service,
+			"method":   req.Method,
+			"url":      req.URL.Redacted(),
+			"duration": duration.String(),
+			"error":    err.Error(),
+		})
+		return nil, err
+	}
+
+	fields = map[string]any{
+		"service":  t.service,
+		"method":   req.Method,
+		"url":      req.URL.Redacted(),
+		"status":   resp.StatusCode,
+		"duration": duration.String(),
+	}
+	if t.logBodies {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			return nil, readErr
+		}
+		fields["body"] = truncateLoggedBody(body)
+	}
+	tflog.SubsystemTrace(ctx, logSubsystemHTTP, "Received HTTP response", fields)
+	return resp, nil
+}
+
+// redactHeaders returns the headers as a map, with credentials replaced.
+func redactHeaders(header http.Header) map[string]string {
+	out := make(map[string]string, len(header))
+	for name := range header {
+		out[name] = header.Get(name)
+	}
+	for _, name := range redactedHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out[http.CanonicalHeaderKey(name)] = "***"
+		}
+	}
+	return out
+}
+
+func readLoggedBody(body io.ReadCloser) string {
+	defer body.Close()
+	data, _ := io.ReadAll(io.LimitReader(body, maxLoggedBody+1))
+	return truncateLoggedBody(data)
+}
+
+func truncateLoggedBody(data []byte) string {
+	if len(data) > maxLoggedBody {
+		return string(data[:maxLoggedBody]) + "...(truncated)"
+	}
+	return string(data)
+}
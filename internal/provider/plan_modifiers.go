@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// useStateUnlessGenerateSSHKeysChanges returns a plan modifier for the
+// generated key attributes. Like stringplanmodifier.UseStateForUnknown it
+// keeps the value from state, so plans do not show the keys as unknown, but
+// only while generate_ssh_keys stays the same: turning it on generates new
+// keys and turning it off clears them.
+func useStateUnlessGenerateSSHKeysChanges() planmodifier.String {
+	return sshKeysPlanModifier{}
+}
+
+type sshKeysPlanModifier struct{}
+
+func (m sshKeysPlanModifier) Description(ctx context.Context) string {
+	return "Keeps the value from state unless generate_ssh_keys changes."
+}
+
+func (m sshKeysPlanModifier) MarkdownDescription(ctx context.Context) string {
+	return "Keeps the value from state unless `generate_ssh_keys` changes."
+}
+
+func (m sshKeysPlanModifier) PlanModifyString(ctx context.Context, req planmodifier.StringRequest, resp *planmodifier.StringResponse) {
+	// Nothing to keep on create, and nothing to do if the value is known.
+	if req.StateValue.IsNull() || !req.PlanValue.IsUnknown() {
+		return
+	}
+
+	var planned, prior tftypes.Bool
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, tfpath.Root("generate_ssh_keys"), &planned)...)
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, tfpath.Root("generate_ssh_keys"), &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if planned.IsUnknown() || planned.ValueBool() != prior.ValueBool() {
+		return
+	}
+
+	resp.PlanValue = req.StateValue
+}
@@ -0,0 +1,549 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/objectvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+var _ tfresource.Resource = &procedureResource{}
+var _ tfresource.ResourceWithImportState = &procedureResource{}
+
+// procedureResource manages a Komodo procedure whose stages are declared in
+// HCL rather than in a resources.toml.
+type procedureResource struct {
+	client     *komodo.Client
+	logSecrets []string
+}
+
+type ProcedureModel struct {
+	Id    tftypes.String        `tfsdk:"id"`
+	Name  tftypes.String        `tfsdk:"name"`
+	Stage []ProcedureStageModel `tfsdk:"stage"`
+}
+
+type ProcedureStageModel struct {
+	Name      tftypes.String            `tfsdk:"name"`
+	Enabled   tftypes.Bool              `tfsdk:"enabled"`
+	Execution []ProcedureExecutionModel `tfsdk:"execution"`
+}
+
+// ProcedureExecutionModel holds exactly one non-nil execution block.
+type ProcedureExecutionModel struct {
+	Enabled      tftypes.Bool                `tfsdk:"enabled"`
+	DeployStack  *StackExecutionModel        `tfsdk:"deploy_stack"`
+	DestroyStack *DestroyStackExecutionModel `tfsdk:"destroy_stack"`
+	RestartStack *StackExecutionModel        `tfsdk:"restart_stack"`
+	Sleep        *SleepExecutionModel        `tfsdk:"sleep"`
+	RunProcedure *RunProcedureExecutionModel `tfsdk:"run_procedure"`
+	RunSync      *RunSyncExecutionModel      `tfsdk:"run_sync"`
+}
+
+type StackExecutionModel struct {
+	Stack    tftypes.String `tfsdk:"stack"`
+	Services tftypes.List   `tfsdk:"services"`
+}
+
+type DestroyStackExecutionModel struct {
+	Stack         tftypes.String `tfsdk:"stack"`
+	Services      tftypes.List   `tfsdk:"services"`
+	RemoveOrphans tftypes.Bool   `tfsdk:"remove_orphans"`
+}
+
+type SleepExecutionModel struct {
+	DurationMs tftypes.Int64 `tfsdk:"duration_ms"`
+}
+
+type RunProcedureExecutionModel struct {
+	Procedure tftypes.String `tfsdk:"procedure"`
+}
+
+type RunSyncExecutionModel struct {
+	Sync tftypes.String `tfsdk:"sync"`
+}
+
+// executionTypes are the execution blocks the resource supports, by the
+// Komodo execution type they map to.
+var executionTypes = map[string]string{
+	"DeployStack":  "deploy_stack",
+	"DestroyStack": "destroy_stack",
+	"RestartStack": "restart_stack",
+	"Sleep":        "sleep",
+	"RunProcedure": "run_procedure",
+	"RunSync":      "run_sync",
+}
+
+func NewProcedureResource() tfresource.Resource {
+	return &procedureResource{}
+}
+
+func (r *procedureResource) Metadata(ctx context.Context, req tfresource.MetadataRequest, resp *tfresource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_procedure"
+}
+
+func (r *procedureResource) Schema(ctx context.Context, req tfresource.SchemaRequest, resp *tfresource.SchemaResponse) {
+	enabled := func(description string) tfschema.BoolAttribute {
+		return tfschema.BoolAttribute{
+			MarkdownDescription: description,
+			Optional:            true,
+			Computed:            true,
+			Default:             booldefault.StaticBool(true),
+		}
+	}
+	services := tfschema.ListAttribute{
+		MarkdownDescription: "Services to limit the execution to. Defaults to all services of the stack",
+		ElementType:         tftypes.StringType,
+		Optional:            true,
+	}
+	reference := func(description string) tfschema.StringAttribute {
+		return tfschema.StringAttribute{
+			MarkdownDescription: description,
+			Required:            true,
+		}
+	}
+
+	blocks := make([]string, 0, len(executionTypes))
+	for _, block := range executionTypes {
+		blocks = append(blocks, block)
+	}
+	sort.Strings(blocks)
+	executionBlocks := make([]tfpath.Expression, 0, len(blocks))
+	for _, block := range blocks {
+		executionBlocks = append(executionBlocks, tfpath.MatchRelative().AtName(block))
+	}
+
+	resp.Schema = tfschema.Schema{
+		MarkdownDescription: "A Komodo procedure: stages of executions run in order, the executions of a stage in parallel",
+		Attributes: map[string]tfschema.Attribute{
+			"id": tfschema.StringAttribute{
+				MarkdownDescription: "The Komodo id of the procedure",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": tfschema.StringAttribute{
+				MarkdownDescription: "The name of the procedure. Changing it replaces the procedure",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+		},
+		Blocks: map[string]tfschema.Block{
+			"stage": tfschema.ListNestedBlock{
+				MarkdownDescription: "A stage of the procedure. Stages run one after the other",
+				Validators: []validator.List{
+					listvalidator.IsRequired(),
+					listvalidator.SizeAtLeast(1),
+				},
+				NestedObject: tfschema.NestedBlockObject{
+					Attributes: map[string]tfschema.Attribute{
+						"name": tfschema.StringAttribute{
+							MarkdownDescription: "The name of the stage",
+							Required:            true,
+						},
+						"enabled": enabled("Whether the stage runs. Defaults to `true`"),
+					},
+					Blocks: map[string]tfschema.Block{
+						"execution": tfschema.ListNestedBlock{
+							MarkdownDescription: "An execution of the stage. Executions of a stage run in parallel. Each holds exactly one execution block",
+							Validators: []validator.List{
+								listvalidator.IsRequired(),
+								listvalidator.SizeAtLeast(1),
+							},
+							NestedObject: tfschema.NestedBlockObject{
+								Validators: []validator.Object{
+									objectvalidator.ExactlyOneOf(executionBlocks...),
+								},
+								Attributes: map[string]tfschema.Attribute{
+									"enabled": enabled("Whether the execution runs. Defaults to `true`"),
+								},
+								Blocks: map[string]tfschema.Block{
+									"deploy_stack": tfschema.SingleNestedBlock{
+										MarkdownDescription: "Deploy a stack (`docker compose up`)",
+										Attributes: map[string]tfschema.Attribute{
+											"stack":    reference("Id or name of the stack, e.g. `komodo-provider_stack.web.id`"),
+											"services": services,
+										},
+									},
+									"destroy_stack": tfschema.SingleNestedBlock{
+										MarkdownDescription: "Take a stack down (`docker compose down`)",
+										Attributes: map[string]tfschema.Attribute{
+											"stack":    reference("Id or name of the stack"),
+											"services": services,
+											"remove_orphans": tfschema.BoolAttribute{
+												MarkdownDescription: "Also remove containers not defined in the compose files. Defaults to `false`",
+												Optional:            true,
+											},
+										},
+									},
+									"restart_stack": tfschema.SingleNestedBlock{
+										MarkdownDescription: "Restart the containers of a stack",
+										Attributes: map[string]tfschema.Attribute{
+											"stack":    reference("Id or name of the stack"),
+											"services": services,
+										},
+									},
+									"sleep": tfschema.SingleNestedBlock{
+										MarkdownDescription: "Wait before the next stage",
+										Attributes: map[string]tfschema.Attribute{
+											"duration_ms": tfschema.Int64Attribute{
+												MarkdownDescription: "How long to wait, in milliseconds",
+												Required:            true,
+												Validators:          []validator.Int64{int64validator.AtLeast(0)},
+											},
+										},
+									},
+									"run_procedure": tfschema.SingleNestedBlock{
+										MarkdownDescription: "Run another procedure and wait for it to finish",
+										Attributes: map[string]tfschema.Attribute{
+											"procedure": reference("Id or name of the procedure, e.g. `komodo-provider_procedure.deploy.id`"),
+										},
+									},
+									"run_sync": tfschema.SingleNestedBlock{
+										MarkdownDescription: "Run a resource sync",
+										Attributes: map[string]tfschema.Attribute{
+											"sync": reference("Id or name of the resource sync"),
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *procedureResource) Configure(ctx context.Context, req tfresource.ConfigureRequest, resp *tfresource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	provider, ok := req.ProviderData.(*KomodoProvider)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *KomodoProvider, got: %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = provider.client
+	r.logSecrets = provider.logSecrets()
+}
+
+func (r *procedureResource) Create(ctx context.Context, req tfresource.CreateRequest, resp *tfresource.CreateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ProcedureModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	config, diags := procedureConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	tflog.SubsystemInfo(ctx, logSubsystem, "Creating procedure", map[string]any{"procedure": name})
+	procedure, err := r.client.CreateProcedure(ctx, name, config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("creating procedure %q", name), err)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setProcedureModel(ctx, &data, procedure)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *procedureResource) Read(ctx context.Context, req tfresource.ReadRequest, resp *tfresource.ReadResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ProcedureModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	procedure, err := r.client.GetProcedure(ctx, data.Id.ValueString())
+	if err != nil {
+		if komodo.IsNotFound(err) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("reading procedure %q", data.Id.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setProcedureModel(ctx, &data, procedure)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *procedureResource) Update(ctx context.Context, req tfresource.UpdateRequest, resp *tfresource.UpdateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ProcedureModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	config, diags := procedureConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	procedure, err := r.client.UpdateProcedure(ctx, data.Id.ValueString(), config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating procedure %q", data.Name.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setProcedureModel(ctx, &data, procedure)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *procedureResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ProcedureModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deleting procedure", map[string]any{"procedure": data.Name.ValueString()})
+	if err := r.client.DeleteProcedure(ctx, data.Id.ValueString()); err != nil && !komodo.IsNotFound(err) {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("deleting procedure %q", data.Name.ValueString()), err)
+	}
+}
+
+// ImportState adopts an existing procedure by id or name.
+func (r *procedureResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
+	tfresource.ImportStatePassthroughID(ctx, tfpath.Root("id"), req, resp)
+}
+
+// procedureConfig builds the Komodo config for the stages in data.
+func procedureConfig(ctx context.Context, data ProcedureModel) (komodo.ProcedureConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	stages := make([]komodo.ProcedureStage, 0, len(data.Stage))
+	for _, s := range data.Stage {
+		executions := make([]komodo.EnabledExecution, 0, len(s.Execution))
+		for _, e := range s.Execution {
+			execution, d := procedureExecution(ctx, e)
+			diags.Append(d...)
+			executions = append(executions, komodo.EnabledExecution{
+				Execution: execution,
+				Enabled:   e.Enabled.ValueBool(),
+			})
+		}
+		stages = append(stages, komodo.ProcedureStage{
+			Name:       s.Name.ValueString(),
+			Enabled:    s.Enabled.ValueBool(),
+			Executions: executions,
+		})
+	}
+	return komodo.ProcedureConfig{Stages: stages}, diags
+}
+
+// procedureExecution converts the execution block set in e.
+func procedureExecution(ctx context.Context, e ProcedureExecutionModel) (komodo.Execution, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	services := func(v tftypes.List) []string {
+		out, d := stringsPtr(ctx, v)
+		diags.Append(d...)
+		if out == nil {
+			return []string{}
+		}
+		return *out
+	}
+
+	switch {
+	case e.DeployStack != nil:
+		return komodo.Execution{Type: "DeployStack", Params: map[string]any{
+			"stack":    e.DeployStack.Stack.ValueString(),
+			"services": services(e.DeployStack.Services),
+		}}, diags
+	case e.DestroyStack != nil:
+		return komodo.Execution{Type: "DestroyStack", Params: map[string]any{
+			"stack":          e.DestroyStack.Stack.ValueString(),
+			"services":       services(e.DestroyStack.Services),
+			"remove_orphans": e.DestroyStack.RemoveOrphans.ValueBool(),
+		}}, diags
+	case e.RestartStack != nil:
+		return komodo.Execution{Type: "RestartStack", Params: map[string]any{
+			"stack":    e.RestartStack.Stack.ValueString(),
+			"services": services(e.RestartStack.Services),
+		}}, diags
+	case e.Sleep != nil:
+		return komodo.Execution{Type: "Sleep", Params: map[string]any{
+			"duration_ms": e.Sleep.DurationMs.ValueInt64(),
+		}}, diags
+	case e.RunProcedure != nil:
+		return komodo.Execution{Type: "RunProcedure", Params: map[string]any{
+			"procedure": e.RunProcedure.Procedure.ValueString(),
+		}}, diags
+	case e.RunSync != nil:
+		return komodo.Execution{Type: "RunSync", Params: map[string]any{
+			"sync": e.RunSync.Sync.ValueString(),
+		}}, diags
+	}
+	// Unreachable once the ExactlyOneOf validator has passed.
+	diags.AddError("Invalid Execution", "Each execution needs exactly one execution block.")
+	return komodo.Execution{}, diags
+}
+
+// setProcedureModel copies procedure into data. A procedure with an
+// execution of a type the resource has no block for is an error: leaving the
+// execution out would make the next apply delete it from Komodo.
+func (r *procedureResource) setProcedureModel(ctx context.Context, data *ProcedureModel, procedure *komodo.Procedure) diag.Diagnostics {
+	var diags diag.Diagnostics
+	data.Id = tftypes.StringValue(procedure.ID.String())
+	data.Name = tftypes.StringValue(procedure.Name)
+
+	stages := make([]ProcedureStageModel, 0, len(procedure.Config.Stages))
+	for i, s := range procedure.Config.Stages {
+		var priorStage ProcedureStageModel
+		if i < len(data.Stage) {
+			priorStage = data.Stage[i]
+		}
+		stage := ProcedureStageModel{
+			Name:      tftypes.StringValue(s.Name),
+			Enabled:   tftypes.BoolValue(s.Enabled),
+			Execution: make([]ProcedureExecutionModel, 0, len(s.Executions)),
+		}
+		for _, e := range s.Executions {
+			if _, ok := executionTypes[e.Execution.Type]; !ok {
+				diags.AddError("Unsupported Procedure Execution",
+					fmt.Sprintf("Stage %q of procedure %q has an execution of type %q, which this provider cannot manage.", s.Name, procedure.Name, e.Execution.Type))
+				continue
+			}
+			var prior ProcedureExecutionModel
+			if j := len(stage.Execution); j < len(priorStage.Execution) {
+				prior = priorStage.Execution[j]
+			}
+			execution, d := r.executionModel(ctx, prior, e)
+			diags.Append(d...)
+			stage.Execution = append(stage.Execution, execution)
+		}
+		stages = append(stages, stage)
+	}
+	data.Stage = stages
+	return diags
+}
+
+// executionModel converts e, which must be of a type in executionTypes.
+// References and service lists are kept as in prior where Komodo reports the
+// same thing differently.
+func (r *procedureResource) executionModel(ctx context.Context, prior ProcedureExecutionModel, e komodo.EnabledExecution) (ProcedureExecutionModel, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	params := e.Execution.Params
+	str := func(key string) string {
+		s, _ := params[key].(string)
+		return s
+	}
+	services := func(prior tftypes.List) tftypes.List {
+		var out []string
+		raw, _ := params["services"].([]any)
+		for _, s := range raw {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		if prior.IsUnknown() || prior.ElementType(ctx) == nil {
+			prior = tftypes.ListNull(tftypes.StringType)
+		}
+		list, d := optionalStrings(ctx, prior, out)
+		diags.Append(d...)
+		return list
+	}
+	stack := func(prior tftypes.String) tftypes.String {
+		return resourceReference(ctx, prior, str("stack"), func(ctx context.Context, stack string) (string, error) {
+			s, err := r.client.GetStack(ctx, stack)
+			if err != nil {
+				return "", err
+			}
+			return s.ID.String(), nil
+		})
+	}
+
+	out := ProcedureExecutionModel{Enabled: tftypes.BoolValue(e.Enabled)}
+	switch e.Execution.Type {
+	case "DeployStack":
+		var p StackExecutionModel
+		if prior.DeployStack != nil {
+			p = *prior.DeployStack
+		}
+		out.DeployStack = &StackExecutionModel{Stack: stack(p.Stack), Services: services(p.Services)}
+	case "DestroyStack":
+		var p DestroyStackExecutionModel
+		if prior.DestroyStack != nil {
+			p = *prior.DestroyStack
+		}
+		removeOrphans, _ := params["remove_orphans"].(bool)
+		out.DestroyStack = &DestroyStackExecutionModel{
+			Stack:         stack(p.Stack),
+			Services:      services(p.Services),
+			RemoveOrphans: tftypes.BoolValue(removeOrphans),
+		}
+		if !removeOrphans && p.RemoveOrphans.IsNull() {
+			out.DestroyStack.RemoveOrphans = tftypes.BoolNull()
+		}
+	case "RestartStack":
+		var p StackExecutionModel
+		if prior.RestartStack != nil {
+			p = *prior.RestartStack
+		}
+		out.RestartStack = &StackExecutionModel{Stack: stack(p.Stack), Services: services(p.Services)}
+	case "Sleep":
+		durationMs, _ := params["duration_ms"].(float64)
+		out.Sleep = &SleepExecutionModel{DurationMs: tftypes.Int64Value(int64(durationMs))}
+	case "RunProcedure":
+		var p RunProcedureExecutionModel
+		if prior.RunProcedure != nil {
+			p = *prior.RunProcedure
+		}
+		procedure := resourceReference(ctx, p.Procedure, str("procedure"), func(ctx context.Context, procedure string) (string, error) {
+			p, err := r.client.GetProcedure(ctx, procedure)
+			if err != nil {
+				return "", err
+			}
+			return p.ID.String(), nil
+		})
+		out.RunProcedure = &RunProcedureExecutionModel{Procedure: procedure}
+	case "RunSync":
+		var p RunSyncExecutionModel
+		if prior.RunSync != nil {
+			p = *prior.RunSync
+		}
+		sync := resourceReference(ctx, p.Sync, str("sync"), func(ctx context.Context, sync string) (string, error) {
+			s, err := r.client.GetResourceSync(ctx, sync)
+			if err != nil {
+				return "", err
+			}
+			return s.ID.String(), nil
+		})
+		out.RunSync = &RunSyncExecutionModel{Sync: sync}
+	}
+	return out, diags
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"example.com/me/komodo-provider/internal/komodo"
+)
+
+func TestSetProcedureModelUnsupportedExecution(t *testing.T) {
+	r := &procedureResource{}
+	procedure := &komodo.Procedure{
+		ID:   komodo.ObjectID("6650f1"),
+		Name: "rollout",
+		Config: komodo.ProcedureConfig{Stages: []komodo.ProcedureStage{{
+			Name:    "deploy",
+			Enabled: true,
+			Executions: []komodo.EnabledExecution{
+				{Execution: komodo.Execution{Type: "Sleep", Params: map[string]any{"duration_ms": float64(1000)}}, Enabled: true},
+				{Execution: komodo.Execution{Type: "PullRepo", Params: map[string]any{"repo": "acme"}}, Enabled: true},
+			},
+		}}},
+	}
+
+	var data ProcedureModel
+	diags := r.setProcedureModel(context.Background(), &data, procedure)
+	if !diags.HasError() {
+		t.Fatal("setProcedureModel with a PullRepo execution succeeded, want an error")
+	}
+	if got := diags.Errors()[0].Summary(); got != "Unsupported Procedure Execution" {
+		t.Errorf("error summary = %q, want %q", got, "Unsupported Procedure Execution")
+	}
+
+	procedure.Config.Stages[0].Executions = procedure.Config.Stages[0].Executions[:1]
+	data = ProcedureModel{}
+	if diags := r.setProcedureModel(context.Background(), &data, procedure); diags.HasError() {
+		t.Fatalf("setProcedureModel with supported executions: %v", diags)
+	}
+	if len(data.Stage) != 1 || len(data.Stage[0].Execution) != 1 || data.Stage[0].Execution[0].Sleep == nil {
+		t.Errorf("stages = %+v, want one stage with one sleep execution", data.Stage)
+	}
+}
@@ -2,25 +2,86 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
 	"strings"
 	"time"
+
+	"example.com/me/komodo-provider/internal/githost"
+	"example.com/me/komodo-provider/internal/komodo"
+	"example.com/me/komodo-provider/internal/ratelimit"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/float64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	tfdatasource "github.com/hashicorp/terraform-plugin-framework/datasource"
 	tffunction "github.com/hashicorp/terraform-plugin-framework/function"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
 	tfprovider "github.com/hashicorp/terraform-plugin-framework/provider"
 	tfschema "github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
 )
 
 type KomodoProviderModel struct {
-	Endpoint     tftypes.String `tfsdk:"endpoint"`
-	ApiKey       tftypes.String `tfsdk:"api_key"`
-	ApiSecret    tftypes.String `tfsdk:"api_secret"`
-	GithubToken  tftypes.String `tfsdk:"github_token"`
+	Endpoint      tftypes.String `tfsdk:"endpoint"`
+	ApiKey        tftypes.String `tfsdk:"api_key"`
+	ApiSecret     tftypes.String `tfsdk:"api_secret"`
+	GithubToken   tftypes.String `tfsdk:"github_token"`
 	GithubOrgname tftypes.String `tfsdk:"github_orgname"` // Changed from github_username
+	GitAccount    tftypes.String `tfsdk:"git_account"`
+	GitProvider   tftypes.String `tfsdk:"git_provider"`
+	GitBaseURL    tftypes.String `tfsdk:"git_base_url"`
+
+	GithubAppID             tftypes.Int64  `tfsdk:"github_app_id"`
+	GithubAppInstallationID tftypes.Int64  `tfsdk:"github_app_installation_id"`
+	GithubAppPrivateKeyFile tftypes.String `tfsdk:"github_app_private_key_file"`
+
+	Preflight tftypes.Bool `tfsdk:"preflight"`
+
+	CACertFile         tftypes.String `tfsdk:"ca_cert_file"`
+	ClientCertFile     tftypes.String `tfsdk:"client_cert_file"`
+	ClientKeyFile      tftypes.String `tfsdk:"client_key_file"`
+	InsecureSkipVerify tftypes.Bool   `tfsdk:"insecure_skip_verify"`
+	ProxyURL           tftypes.String `tfsdk:"proxy_url"`
+	Headers            tftypes.Map    `tfsdk:"headers"`
+	RequestTimeout     tftypes.String `tfsdk:"request_timeout"`
+
+	Retry     *RetryModel     `tfsdk:"retry"`
+	RateLimit *RateLimitModel `tfsdk:"rate_limit"`
+}
+
+// RateLimitModel configures the provider-wide request limits.
+type RateLimitModel struct {
+	KomodoRequestsPerSecond tftypes.Float64 `tfsdk:"komodo_requests_per_second"`
+	KomodoMaxInFlight       tftypes.Int64   `tfsdk:"komodo_max_in_flight"`
+	GitRequestsPerSecond    tftypes.Float64 `tfsdk:"git_requests_per_second"`
+	GitMaxInFlight          tftypes.Int64   `tfsdk:"git_max_in_flight"`
+}
+
+// Default request limits, shared by all resources of a provider instance.
+const (
+	defaultKomodoRequestsPerSecond = 20
+	defaultKomodoMaxInFlight       = 10
+	defaultGitRequestsPerSecond    = 5
+	defaultGitMaxInFlight          = 4
+)
+
+// RetryModel configures the retry policy shared by all Komodo calls.
+type RetryModel struct {
+	MaxAttempts          tftypes.Int64   `tfsdk:"max_attempts"`
+	BaseBackoff          tftypes.String  `tfsdk:"base_backoff"`
+	MaxBackoff           tftypes.String  `tfsdk:"max_backoff"`
+	Jitter               tftypes.Float64 `tfsdk:"jitter"`
+	RetryableStatusCodes tftypes.List    `tfsdk:"retryable_status_codes"`
+	WriteStatusCodes     tftypes.List    `tfsdk:"retryable_write_status_codes"`
+	RetryableErrorKinds  tftypes.List    `tfsdk:"retryable_error_kinds"`
 }
 
 type KomodoProvider struct {
@@ -29,7 +90,10 @@ type KomodoProvider struct {
 	apiSecret     string
 	githubToken   string
 	githubOrgname string // Changed from githubUsername
-	client        *http.Client
+	gitAccount    string
+	client        *komodo.Client
+	gitHost       githost.Host // nil when no git token is configured
+	serverLocks   *serverLocks
 }
 
 var _ tfprovider.Provider = &KomodoProvider{}
@@ -45,7 +109,6 @@ func (p *KomodoProvider) Metadata(ctx context.Context, req tfprovider.MetadataRe
 	resp.TypeName = "komodo-provider" // matches in your .tf file `resource "komodo-provider_user" "john_doe" {`
 }
 
-
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		// Define your provider schema, resources, etc.
@@ -53,32 +116,169 @@ func Provider() *schema.Provider {
 	}
 }
 
-
 func (p *KomodoProvider) Schema(ctx context.Context, req tfprovider.SchemaRequest, resp *tfprovider.SchemaResponse) {
 	resp.Schema = tfschema.Schema{
 		Attributes: map[string]tfschema.Attribute{
 			"endpoint": tfschema.StringAttribute{
-				Required:    true,
-				Description: "The endpoint URL of the user service",
+				Optional:    true, // May come from KOMODO_ENDPOINT
+				Description: "The http(s) URL of the Komodo core API. Can also be set with the `KOMODO_ENDPOINT` environment variable",
 			},
 			"api_key": tfschema.StringAttribute{
-				Required:    true,
+				Optional:    true, // May come from KOMODO_API_KEY
 				Sensitive:   true, // Mark as sensitive to hide in logs
-				Description: "API key for authentication",
+				Description: "API key for authentication. Can also be set with the `KOMODO_API_KEY` environment variable",
 			},
 			"api_secret": tfschema.StringAttribute{
-				Required:    true,
+				Optional:    true, // May come from KOMODO_API_SECRET
 				Sensitive:   true, // Mark as sensitive to hide in logs
-				Description: "API secret for authentication",
+				Description: "API secret for authentication. Can also be set with the `KOMODO_API_SECRET` environment variable",
 			},
 			"github_token": tfschema.StringAttribute{
-				Required:    true,
+				Optional:    true, // Not needed when every resource uses sync_mode = "inline"
 				Sensitive:   true, // Mark as sensitive to hide in logs
-				Description: "GitHub personal access token",
+				Description: "Access token for the configured `git_provider`. Can also be set with the `GITHUB_TOKEN` environment variable. Required unless all resources use `sync_mode = \"inline\"` or GitHub App authentication is configured",
+			},
+			"github_app_id": tfschema.Int64Attribute{
+				Optional:    true,
+				Description: "ID of the GitHub App to authenticate as instead of using `github_token`. Requires `github_app_installation_id` and `github_app_private_key_file`",
+			},
+			"github_app_installation_id": tfschema.Int64Attribute{
+				Optional:    true,
+				Description: "ID of the GitHub App installation on the account that owns the sync repositories",
+			},
+			"github_app_private_key_file": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Path to the PEM encoded private key of the GitHub App",
 			},
 			"github_orgname": tfschema.StringAttribute{
 				Optional:    true, // Make it optional
-				Description: "GitHub organization name for repository creation",
+				Description: "Organization (GitHub/Gitea) or group (GitLab) for repository creation. Can also be set with the `GITHUB_ORG` environment variable. Required with GitHub App authentication",
+			},
+			"git_account": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Komodo git provider account used by resource syncs to clone the sync repositories. Defaults to the repository owner",
+			},
+			"git_provider": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Git hosting service for the sync repositories: `github` (default, including GitHub Enterprise Server), `gitea` (also Forgejo) or `gitlab`",
+				Validators: []validator.String{
+					stringvalidator.OneOf(githost.ProviderGitHub, githost.ProviderGitea, githost.ProviderGitLab),
+				},
+			},
+			"git_base_url": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Root URL of a self-hosted git provider, e.g. `https://github.example.com/api/v3/` for GitHub Enterprise Server or `https://gitea.example.com` for Gitea. Required for `gitea`, defaults to `https://gitlab.com` for `gitlab`",
+			},
+			"ca_cert_file": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Path to a PEM bundle of CA certificates trusted for the Komodo endpoint, in addition to the system roots",
+			},
+			"client_cert_file": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Path to a PEM client certificate presented to the Komodo endpoint. Requires `client_key_file`",
+			},
+			"client_key_file": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Path to the PEM private key of `client_cert_file`",
+			},
+			"insecure_skip_verify": tfschema.BoolAttribute{
+				Optional:    true,
+				Description: "Skip verification of the Komodo endpoint's TLS certificate. Only use this in labs",
+			},
+			"proxy_url": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "HTTP(S) proxy for Komodo requests. Defaults to the `HTTPS_PROXY`/`HTTP_PROXY`/`NO_PROXY` environment variables",
+			},
+			"headers": tfschema.MapAttribute{
+				Optional:    true,
+				ElementType: tftypes.StringType,
+				Description: "Extra headers sent with every Komodo request, e.g. for an authenticating reverse proxy",
+			},
+			"request_timeout": tfschema.StringAttribute{
+				Optional:    true,
+				Description: "Timeout for a single Komodo request, as a Go duration such as `90s`. Defaults to `60s`",
+			},
+			"retry": tfschema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Retry policy applied to every Komodo request. Unset fields keep their defaults",
+				Attributes: map[string]tfschema.Attribute{
+					"max_attempts": tfschema.Int64Attribute{
+						Optional:    true,
+						Description: "Total number of tries per request, including the first. `1` disables retries. Defaults to `5`",
+						Validators: []validator.Int64{
+							int64validator.AtLeast(1),
+						},
+					},
+					"base_backoff": tfschema.StringAttribute{
+						Optional:    true,
+						Description: "Wait before the first retry, doubled on each further retry. Defaults to `2s`",
+					},
+					"max_backoff": tfschema.StringAttribute{
+						Optional:    true,
+						Description: "Upper bound for the wait between retries. Defaults to `30s`",
+					},
+					"jitter": tfschema.Float64Attribute{
+						Optional:    true,
+						Description: "Fraction (0 to 1) by which each wait is randomised. Defaults to `0.2`",
+						Validators: []validator.Float64{
+							float64validator.Between(0, 1),
+						},
+					},
+					"retryable_status_codes": tfschema.ListAttribute{
+						Optional:    true,
+						ElementType: tftypes.Int64Type,
+						Description: "HTTP status codes that reads are retried on. Defaults to `[429, 502, 503, 504]`",
+						Validators: []validator.List{
+							listvalidator.ValueInt64sAre(int64validator.Between(100, 599)),
+						},
+					},
+					"retryable_write_status_codes": tfschema.ListAttribute{
+						Optional:    true,
+						ElementType: tftypes.Int64Type,
+						Description: "HTTP status codes that writes and executions are retried on. Only list statuses that mean the core did not act on the request. Defaults to `[429, 503]`",
+						Validators: []validator.List{
+							listvalidator.ValueInt64sAre(int64validator.Between(100, 599)),
+						},
+					},
+					"retryable_error_kinds": tfschema.ListAttribute{
+						Optional:    true,
+						ElementType: tftypes.StringType,
+						Description: "Komodo error kinds that reads are retried on whatever their status code: `Busy` (the target is running another action) and `Unknown` (any unclassified error). Executions that the core rejects while busy are retried on `Busy` too. Defaults to `[\"Busy\"]`",
+						Validators: []validator.List{
+							listvalidator.ValueStringsAre(stringvalidator.OneOf(string(komodo.ErrorKindBusy), string(komodo.ErrorKindUnknown))),
+						},
+					},
+				},
+			},
+			"rate_limit": tfschema.SingleNestedAttribute{
+				Optional:    true,
+				Description: "Limits on the requests all resources together send to Komodo and to the git provider. `0` disables a limit",
+				Attributes: map[string]tfschema.Attribute{
+					"komodo_requests_per_second": tfschema.Float64Attribute{
+						Optional:    true,
+						Description: "Maximum Komodo requests started per second. Defaults to `20`",
+						Validators:  []validator.Float64{float64validator.AtLeast(0)},
+					},
+					"komodo_max_in_flight": tfschema.Int64Attribute{
+						Optional:    true,
+						Description: "Maximum concurrent Komodo requests. Defaults to `10`",
+						Validators:  []validator.Int64{int64validator.AtLeast(0)},
+					},
+					"git_requests_per_second": tfschema.Float64Attribute{
+						Optional:    true,
+						Description: "Maximum git provider requests started per second. Defaults to `5`",
+						Validators:  []validator.Float64{float64validator.AtLeast(0)},
+					},
+					"git_max_in_flight": tfschema.Int64Attribute{
+						Optional:    true,
+						Description: "Maximum concurrent git provider requests. Defaults to `4`",
+						Validators:  []validator.Int64{int64validator.AtLeast(0)},
+					},
+				},
+			},
+			"preflight": tfschema.BoolAttribute{
+				Optional:    true,
+				Description: "Check the Komodo credentials, the Komodo core version and the git credentials when the provider is configured, so bad settings fail before any resource is touched. Defaults to `false`",
 			},
 		},
 	}
@@ -90,32 +290,417 @@ func (p *KomodoProvider) Configure(ctx context.Context, req tfprovider.Configure
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	
+
+	// Values that depend on resources not yet created cannot configure the
+	// client; Terraform must know them before any API call is made.
+	for _, attr := range []struct {
+		name  string
+		value tftypes.String
+	}{
+		{"endpoint", data.Endpoint},
+		{"api_key", data.ApiKey},
+		{"api_secret", data.ApiSecret},
+		{"github_token", data.GithubToken},
+	} {
+		if name := attr.name; attr.value.IsUnknown() {
+			resp.Diagnostics.AddAttributeError(tfpath.Root(name), "Unknown Provider Configuration Value",
+				fmt.Sprintf("The provider cannot be configured because %s is not known until apply. Set it statically or use the corresponding environment variable.", name))
+		}
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	endpoint := stringOrEnv(data.Endpoint, "KOMODO_ENDPOINT")
+	apiKey := stringOrEnv(data.ApiKey, "KOMODO_API_KEY")
+	apiSecret := stringOrEnv(data.ApiSecret, "KOMODO_API_SECRET")
+
+	if endpoint == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("endpoint"), "Missing Komodo API Endpoint",
+			"Set endpoint in the provider configuration or the KOMODO_ENDPOINT environment variable.")
+	} else if err := validateEndpoint(endpoint); err != nil {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("endpoint"), "Invalid Komodo API Endpoint",
+			fmt.Sprintf("%q is not a valid Komodo API endpoint: %s", endpoint, err))
+	}
+	if apiKey == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("api_key"), "Missing Komodo API Key",
+			"Set api_key in the provider configuration or the KOMODO_API_KEY environment variable.")
+	}
+	if apiSecret == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("api_secret"), "Missing Komodo API Secret",
+			"Set api_secret in the provider configuration or the KOMODO_API_SECRET environment variable.")
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
 	// Ensure the endpoint ends with a trailing slash
-	endpoint := data.Endpoint.ValueString()
 	if !strings.HasSuffix(endpoint, "/") {
 		endpoint = endpoint + "/"
 	}
-	
+
 	p.endpoint = endpoint
-	p.apiKey = data.ApiKey.ValueString()
-	p.apiSecret = data.ApiSecret.ValueString()
-	p.githubToken = data.GithubToken.ValueString() // Store the GitHub token
-	p.githubOrgname = data.GithubOrgname.ValueString() // Store the GitHub org name
+	p.apiKey = apiKey
+	p.apiSecret = apiSecret
+	p.githubToken = data.GithubToken.ValueString()                  // Store the GitHub token
+	p.githubOrgname = stringOrEnv(data.GithubOrgname, "GITHUB_ORG") // Store the GitHub org name
+	p.gitAccount = data.GitAccount.ValueString()
+	httpClient := p.komodoHTTPClient(ctx, data, resp)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	komodoLimiter, gitLimiter := rateLimiters(data.RateLimit)
+	httpClient.Transport = komodoLimiter.Transport(newLoggingTransport("komodo", true, httpClient.Transport))
+	p.serverLocks = newServerLocks()
+	p.client = komodo.NewClient(p.endpoint, p.apiKey, p.apiSecret, httpClient)
+	if data.Retry != nil {
+		policy := retryPolicy(ctx, *data.Retry, resp)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		p.client.SetRetryPolicy(policy)
+	}
+
+	githubApp := p.githubAppConfig(data, resp)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	// GITHUB_TOKEN is only a fallback for token authentication, so a token
+	// exported in CI does not clash with a configured GitHub App.
+	if githubApp == nil && p.githubToken == "" {
+		p.githubToken = os.Getenv("GITHUB_TOKEN")
+	}
+
+	// The git host is only needed by resources in git sync mode, so missing
+	// credentials are reported when such a resource is used rather than here.
+	p.gitHost = nil
+	if p.githubToken != "" || githubApp != nil {
+		gitHost, err := githost.New(githost.Config{
+			Provider:   data.GitProvider.ValueString(),
+			BaseURL:    data.GitBaseURL.ValueString(),
+			Token:      p.githubToken,
+			GitHubApp:  githubApp,
+			HTTPClient: &http.Client{Timeout: 60 * time.Second, Transport: gitLimiter.Transport(newLoggingTransport("git", false, nil))},
+		})
+		if err != nil {
+			attr := tfpath.Root("git_base_url")
+			if githubApp != nil {
+				attr = tfpath.Root("github_app_private_key_file")
+			}
+			resp.Diagnostics.AddAttributeError(attr, "Invalid Git Provider Configuration", err.Error())
+			return
+		}
+		p.gitHost = gitHost
+	}
+
+	if data.Preflight.ValueBool() {
+		p.preflight(withLogging(ctx, p.logSecrets()), resp)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	resp.DataSourceData = p
+	resp.ResourceData = p
+}
+
+// komodoHTTPClient builds the HTTP client shared by every Komodo request from
+// the TLS, proxy, header and timeout settings in data.
+func (p *KomodoProvider) komodoHTTPClient(ctx context.Context, data KomodoProviderModel, resp *tfprovider.ConfigureResponse) *http.Client {
 	// http.DefaultClient has no timeout (Timeout: 0) — a Komodo core that
 	// accepts the connection but never responds would block the request (and
 	// therefore terraform apply) forever, holding the state lock and leaving
-	// cloud resources live. Use a bounded client so a stuck call fails fast and
-	// the retry loops / terraform can make progress.
-	p.client = &http.Client{Timeout: 60 * time.Second}
-	
-	resp.DataSourceData = p
-	resp.ResourceData = p
+	// cloud resources live. Always use a bounded client so a stuck call fails
+	// fast and the retry loops / terraform can make progress.
+	timeout := komodo.DefaultTimeout
+	if value := data.RequestTimeout.ValueString(); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			resp.Diagnostics.AddAttributeError(tfpath.Root("request_timeout"), "Invalid Request Timeout",
+				fmt.Sprintf("%q is not a positive duration such as \"90s\".", value))
+			return nil
+		}
+		timeout = parsed
+	}
+
+	if data.ClientCertFile.ValueString() != "" && data.ClientKeyFile.ValueString() == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("client_key_file"), "Missing Client Key",
+			"client_key_file is required when client_cert_file is set.")
+	}
+	if data.ClientKeyFile.ValueString() != "" && data.ClientCertFile.ValueString() == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("client_cert_file"), "Missing Client Certificate",
+			"client_cert_file is required when client_key_file is set.")
+	}
+
+	var headers map[string]string
+	if !data.Headers.IsNull() {
+		resp.Diagnostics.Append(data.Headers.ElementsAs(ctx, &headers, false)...)
+	}
+	if resp.Diagnostics.HasError() {
+		return nil
+	}
+
+	httpClient, err := komodo.NewHTTPClient(komodo.TransportConfig{
+		CACertFile:         data.CACertFile.ValueString(),
+		ClientCertFile:     data.ClientCertFile.ValueString(),
+		ClientKeyFile:      data.ClientKeyFile.ValueString(),
+		InsecureSkipVerify: data.InsecureSkipVerify.ValueBool(),
+		ProxyURL:           data.ProxyURL.ValueString(),
+		Headers:            headers,
+		Timeout:            timeout,
+	})
+	if err != nil {
+		resp.Diagnostics.AddError("Invalid Komodo Transport Configuration", fmt.Sprintf("Error configuring the Komodo HTTP client: %s", err))
+		return nil
+	}
+	return httpClient
+}
+
+// rateLimiters returns the limiters for Komodo and git provider requests,
+// using the defaults for anything data leaves unset.
+func rateLimiters(data *RateLimitModel) (komodoLimiter, gitLimiter *ratelimit.Limiter) {
+	if data == nil {
+		data = &RateLimitModel{}
+	}
+	float64Or := func(value tftypes.Float64, def float64) float64 {
+		if value.IsNull() || value.IsUnknown() {
+			return def
+		}
+		return value.ValueFloat64()
+	}
+	intOr := func(value tftypes.Int64, def int) int {
+		if value.IsNull() || value.IsUnknown() {
+			return def
+		}
+		return int(value.ValueInt64())
+	}
+
+	komodoLimiter = ratelimit.New(
+		float64Or(data.KomodoRequestsPerSecond, defaultKomodoRequestsPerSecond),
+		intOr(data.KomodoMaxInFlight, defaultKomodoMaxInFlight),
+	)
+	gitLimiter = ratelimit.New(
+		float64Or(data.GitRequestsPerSecond, defaultGitRequestsPerSecond),
+		intOr(data.GitMaxInFlight, defaultGitMaxInFlight),
+	)
+	return komodoLimiter, gitLimiter
+}
+
+// retryPolicy returns DefaultRetryPolicy with the fields set in data
+// overridden.
+func retryPolicy(ctx context.Context, data RetryModel, resp *tfprovider.ConfigureResponse) komodo.RetryPolicy {
+	policy := komodo.DefaultRetryPolicy
+
+	if !data.MaxAttempts.IsNull() {
+		policy.MaxAttempts = int(data.MaxAttempts.ValueInt64())
+	}
+	for _, d := range []struct {
+		name   string
+		value  tftypes.String
+		target *time.Duration
+	}{
+		{"base_backoff", data.BaseBackoff, &policy.BaseBackoff},
+		{"max_backoff", data.MaxBackoff, &policy.MaxBackoff},
+	} {
+		if d.value.IsNull() {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value.ValueString())
+		if err != nil || parsed < 0 {
+			resp.Diagnostics.AddAttributeError(tfpath.Root("retry").AtName(d.name), "Invalid Retry Backoff",
+				fmt.Sprintf("%q is not a duration such as \"5s\".", d.value.ValueString()))
+			continue
+		}
+		*d.target = parsed
+	}
+	if !data.Jitter.IsNull() {
+		policy.Jitter = data.Jitter.ValueFloat64()
+	}
+
+	for _, c := range []struct {
+		value  tftypes.List
+		target *[]int
+	}{
+		{data.RetryableStatusCodes, &policy.RetryableStatusCodes},
+		{data.WriteStatusCodes, &policy.UnprocessedStatusCodes},
+	} {
+		if c.value.IsNull() {
+			continue
+		}
+		var codes []int64
+		resp.Diagnostics.Append(c.value.ElementsAs(ctx, &codes, false)...)
+		*c.target = make([]int, 0, len(codes))
+		for _, code := range codes {
+			*c.target = append(*c.target, int(code))
+		}
+	}
+	if !data.RetryableErrorKinds.IsNull() {
+		var kinds []string
+		resp.Diagnostics.Append(data.RetryableErrorKinds.ElementsAs(ctx, &kinds, false)...)
+		policy.RetryableKinds = make([]komodo.ErrorKind, 0, len(kinds))
+		for _, kind := range kinds {
+			policy.RetryableKinds = append(policy.RetryableKinds, komodo.ErrorKind(kind))
+		}
+	}
+
+	if policy.MaxBackoff < policy.BaseBackoff {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("retry").AtName("max_backoff"), "Invalid Retry Backoff",
+			fmt.Sprintf("max_backoff (%s) must not be shorter than base_backoff (%s).", policy.MaxBackoff, policy.BaseBackoff))
+	}
+	return policy
+}
+
+// preflightTimeout bounds the calls made by preflight.
+const preflightTimeout = 30 * time.Second
+
+// preflight checks that Komodo and the git host accept the configured
+// credentials and records the Komodo core version on the client.
+func (p *KomodoProvider) preflight(ctx context.Context, resp *tfprovider.ConfigureResponse) {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	version, err := p.client.GetVersion(ctx)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("endpoint"), "Komodo Preflight Failed",
+			fmt.Sprintf("Error reading the Komodo core version from %s: %s", p.client.Endpoint(), err))
+		return
+	}
+	// An old core is not an error here: only the calls that need a newer
+	// one (see komodo.RequireCoreVersion) are refused.
+	p.client.SetCoreVersion(version)
+
+	user, err := p.client.GetUser(ctx)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("api_key"), "Komodo Preflight Failed",
+			fmt.Sprintf("Komodo rejected the API key and secret: %s", err))
+		return
+	}
+	if !user.Enabled {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("api_key"), "Komodo Preflight Failed",
+			fmt.Sprintf("The Komodo user %q the API key belongs to is disabled.", user.Username))
+		return
+	}
+
+	// Without a git host only inline sync mode can be used, which is checked
+	// per resource.
+	if p.gitHost == nil {
+		return
+	}
+	identity, err := p.gitHost.Identity(ctx)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_token"), "Git Preflight Failed",
+			fmt.Sprintf("The git provider rejected the configured credentials: %s", err))
+		return
+	}
+	if identity.Scopes == nil {
+		return
+	}
+	if !slices.Contains(identity.Scopes, "repo") {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_token"), "Insufficient GitHub Token Scopes",
+			fmt.Sprintf("The GitHub token for %s needs the \"repo\" scope to create sync repositories; it has: %s", identity.Login, strings.Join(identity.Scopes, ", ")))
+		return
+	}
+	if !slices.Contains(identity.Scopes, "delete_repo") {
+		resp.Diagnostics.AddAttributeWarning(tfpath.Root("github_token"), "Missing GitHub Token Scope",
+			fmt.Sprintf("The GitHub token for %s lacks the \"delete_repo\" scope, so destroying a resource will fail to delete its sync repository.", identity.Login))
+	}
+}
+
+// logSecrets returns the configured credentials, which must never show up
+// in logs.
+func (p *KomodoProvider) logSecrets() []string {
+	return []string{p.apiKey, p.apiSecret, p.githubToken}
+}
+
+// stringOrEnv returns the configured value, or the environment variable env
+// when the attribute is not set.
+func stringOrEnv(value tftypes.String, env string) string {
+	if !value.IsNull() && value.ValueString() != "" {
+		return value.ValueString()
+	}
+	return os.Getenv(env)
+}
+
+// validateEndpoint checks that endpoint is an absolute http(s) URL.
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("host is missing")
+	}
+	return nil
+}
+
+// githubAppConfig returns the GitHub App credentials from data, or nil when
+// none are configured. The app attributes must be set together, along with
+// github_orgname, and cannot be combined with github_token.
+func (p *KomodoProvider) githubAppConfig(data KomodoProviderModel, resp *tfprovider.ConfigureResponse) *githost.GitHubApp {
+	appID := data.GithubAppID.ValueInt64()
+	installationID := data.GithubAppInstallationID.ValueInt64()
+	keyFile := data.GithubAppPrivateKeyFile.ValueString()
+	if appID == 0 && installationID == 0 && keyFile == "" {
+		return nil
+	}
+
+	if p.githubToken != "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_app_id"), "Conflicting Git Credentials",
+			"github_token and GitHub App authentication cannot be configured together")
+		return nil
+	}
+	if data.GitProvider.ValueString() != "" && data.GitProvider.ValueString() != githost.ProviderGitHub {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("git_provider"), "Invalid Git Provider Configuration",
+			"GitHub App authentication is only supported with git_provider = \"github\"")
+		return nil
+	}
+	if appID == 0 {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_app_id"), "Missing GitHub App ID",
+			"github_app_id is required for GitHub App authentication")
+	}
+	if installationID == 0 {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_app_installation_id"), "Missing GitHub App Installation ID",
+			"github_app_installation_id is required for GitHub App authentication")
+	}
+	if keyFile == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_app_private_key_file"), "Missing GitHub App Private Key",
+			"github_app_private_key_file is required for GitHub App authentication")
+	}
+	// Installation tokens cannot create repositories under a user account
+	// (POST /user/repos), so sync repositories have to go to an organization.
+	if p.githubOrgname == "" {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_orgname"), "Missing GitHub Organization",
+			"github_orgname (or GITHUB_ORG) is required for GitHub App authentication: installation tokens cannot create repositories in a personal account")
+	}
+	if resp.Diagnostics.HasError() {
+		return nil
+	}
+
+	privateKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(tfpath.Root("github_app_private_key_file"), "Invalid GitHub App Private Key",
+			fmt.Sprintf("Error reading private key file: %s", err))
+		return nil
+	}
+
+	return &githost.GitHubApp{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     privateKey,
+	}
 }
 
 func (p *KomodoProvider) Resources(ctx context.Context) []func() tfresource.Resource {
 	return []func() tfresource.Resource{
 		NewKomodoResource,
+		NewServerResource,
+		NewStackResource,
+		NewProcedureResource,
+		NewResourceSyncResource,
+		NewDeploymentResource,
 	}
 }
 
@@ -126,4 +711,3 @@ func (p *KomodoProvider) DataSources(ctx context.Context) []func() tfdatasource.
 func (p *KomodoProvider) Functions(ctx context.Context) []func() tffunction.Function {
 	return []func() tffunction.Function{}
 }
-
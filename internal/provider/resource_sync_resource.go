@@ -0,0 +1,423 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+var _ tfresource.Resource = &resourceSyncResource{}
+var _ tfresource.ResourceWithImportState = &resourceSyncResource{}
+
+// resourceSyncResource manages a single Komodo resource sync, without the
+// ContextWare / ResourceSetup bootstrap of komodo-provider_user.
+type resourceSyncResource struct {
+	client     *komodo.Client
+	logSecrets []string
+}
+
+type ResourceSyncModel struct {
+	Id                tftypes.String `tfsdk:"id"`
+	Name              tftypes.String `tfsdk:"name"`
+	Repo              tftypes.String `tfsdk:"repo"`
+	Branch            tftypes.String `tfsdk:"branch"`
+	GitProvider       tftypes.String `tfsdk:"git_provider"`
+	GitAccount        tftypes.String `tfsdk:"git_account"`
+	ResourcePath      tftypes.List   `tfsdk:"resource_path"`
+	FileContents      tftypes.String `tfsdk:"file_contents"`
+	Delete            tftypes.Bool   `tfsdk:"delete"`
+	IncludeUserGroups tftypes.Bool   `tfsdk:"include_user_groups"`
+	IncludeVariables  tftypes.Bool   `tfsdk:"include_variables"`
+	WebhookEnabled    tftypes.Bool   `tfsdk:"webhook_enabled"`
+	WebhookSecret     tftypes.String `tfsdk:"webhook_secret"`
+	RunOnApply        tftypes.Bool   `tfsdk:"run_on_apply"`
+	PendingDiff       tftypes.List   `tfsdk:"pending_diff"`
+	PendingError      tftypes.String `tfsdk:"pending_error"`
+	Timeouts          timeouts.Value `tfsdk:"timeouts"`
+}
+
+// pendingDiffType is the element type of pending_diff.
+var pendingDiffType = tftypes.ObjectType{AttrTypes: map[string]attr.Type{
+	"operation":     tftypes.StringType,
+	"resource_type": tftypes.StringType,
+	"resource":      tftypes.StringType,
+}}
+
+func NewResourceSyncResource() tfresource.Resource {
+	return &resourceSyncResource{}
+}
+
+func (r *resourceSyncResource) Metadata(ctx context.Context, req tfresource.MetadataRequest, resp *tfresource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_resource_sync"
+}
+
+func (r *resourceSyncResource) Schema(ctx context.Context, req tfresource.SchemaRequest, resp *tfresource.SchemaResponse) {
+	optionalBool := func(description string, value bool) tfschema.BoolAttribute {
+		return tfschema.BoolAttribute{
+			MarkdownDescription: description,
+			Optional:            true,
+			Computed:            true,
+			Default:             booldefault.StaticBool(value),
+		}
+	}
+
+	resp.Schema = tfschema.Schema{
+		MarkdownDescription: "A Komodo resource sync: resources declared in TOML, from a repository or inline, that Komodo creates, updates and optionally deletes when the sync runs",
+		Attributes: map[string]tfschema.Attribute{
+			"id": tfschema.StringAttribute{
+				MarkdownDescription: "The Komodo id of the resource sync",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": tfschema.StringAttribute{
+				MarkdownDescription: "The name of the resource sync. Changing it replaces the sync",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"repo": tfschema.StringAttribute{
+				MarkdownDescription: "Repository holding the resource files, as `owner/name`",
+				Optional:            true,
+			},
+			"branch": tfschema.StringAttribute{
+				MarkdownDescription: "Branch of `repo` to read. Defaults to Komodo's default, `main`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"git_provider": tfschema.StringAttribute{
+				MarkdownDescription: "Domain of the git provider hosting `repo`. Defaults to Komodo's default, `github.com`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"git_account": tfschema.StringAttribute{
+				MarkdownDescription: "Komodo git provider account used to clone `repo`",
+				Optional:            true,
+			},
+			"resource_path": tfschema.ListAttribute{
+				MarkdownDescription: "Files or directories in `repo` to read resources from. Defaults to `resources.toml`",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+			},
+			"file_contents": tfschema.StringAttribute{
+				MarkdownDescription: "The resources TOML, when it is defined here rather than in a repository. Needs Komodo core 1.16 or newer",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.ConflictsWith(tfpath.MatchRoot("repo")),
+				},
+			},
+			"delete":              optionalBool("Delete resources that are missing from the sync's files when it runs. Defaults to `false`", false),
+			"include_user_groups": optionalBool("Also sync user groups. Defaults to `false`", false),
+			"include_variables":   optionalBool("Also sync variables. Defaults to `false`", false),
+			"webhook_enabled":     optionalBool("Whether a push to `repo` can refresh or run the sync through its webhook. Defaults to `true`", true),
+			"webhook_secret": tfschema.StringAttribute{
+				MarkdownDescription: "Secret for the sync's webhook, overriding the core's default",
+				Optional:            true,
+				Sensitive:           true,
+			},
+			"run_on_apply": optionalBool("Run the sync after it is created and after each change to it, and wait for the run to finish. Defaults to `false`", false),
+			"pending_diff": tfschema.ListNestedAttribute{
+				MarkdownDescription: "The changes to resources a run of the sync would make, as of the last refresh",
+				Computed:            true,
+				NestedObject: tfschema.NestedAttributeObject{
+					Attributes: map[string]tfschema.Attribute{
+						"operation": tfschema.StringAttribute{
+							MarkdownDescription: "`Create`, `Update` or `Delete`",
+							Computed:            true,
+						},
+						"resource_type": tfschema.StringAttribute{
+							MarkdownDescription: "The type of the resource, e.g. `Stack`",
+							Computed:            true,
+						},
+						"resource": tfschema.StringAttribute{
+							MarkdownDescription: "The id of the resource, or its name if it is to be created",
+							Computed:            true,
+						},
+					},
+				},
+			},
+			"pending_error": tfschema.StringAttribute{
+				MarkdownDescription: "Why the sync's files could not be read, if they could not; `pending_diff` is then empty",
+				Computed:            true,
+			},
+		},
+		Blocks: map[string]tfschema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *resourceSyncResource) Configure(ctx context.Context, req tfresource.ConfigureRequest, resp *tfresource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	provider, ok := req.ProviderData.(*KomodoProvider)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *KomodoProvider, got: %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = provider.client
+	r.logSecrets = provider.logSecrets()
+}
+
+func (r *resourceSyncResource) Create(ctx context.Context, req tfresource.CreateRequest, resp *tfresource.CreateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ResourceSyncModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, syncRunTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	config, diags := resourceSyncConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "sync", name)
+	tflog.SubsystemInfo(ctx, logSubsystem, "Creating resource sync")
+	sync, err := r.client.CreateResourceSync(ctx, name, config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("creating resource sync %q", name), err)
+		return
+	}
+
+	// A run that rejects the resource files still leaves the sync behind,
+	// so record it before running.
+	resp.Diagnostics.Append(setResourceSyncModel(ctx, &data, sync)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.apply(ctx, &data, sync, createTimeout, &resp.Diagnostics)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *resourceSyncResource) Read(ctx context.Context, req tfresource.ReadRequest, resp *tfresource.ReadResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ResourceSyncModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	sync, err := r.client.GetResourceSync(ctx, data.Id.ValueString())
+	if err != nil {
+		if komodo.IsNotFound(err) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("reading resource sync %q", data.Id.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(setResourceSyncModel(ctx, &data, sync)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *resourceSyncResource) Update(ctx context.Context, req tfresource.UpdateRequest, resp *tfresource.UpdateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data, prior ResourceSyncModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, syncRunTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	config, diags := resourceSyncConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	clearRemoved(data.Repo, prior.Repo, &config.Repo, "")
+	clearRemoved(data.GitAccount, prior.GitAccount, &config.GitAccount, "")
+	clearRemoved(data.FileContents, prior.FileContents, &config.FileContents, "")
+	clearRemoved(data.WebhookSecret, prior.WebhookSecret, &config.WebhookSecret, "")
+	clearRemoved(data.ResourcePath, prior.ResourcePath, &config.ResourcePath, []string{})
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "sync", name)
+	sync, err := r.client.UpdateResourceSync(ctx, data.Id.ValueString(), config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating resource sync %q", name), err)
+		return
+	}
+
+	resp.Diagnostics.Append(setResourceSyncModel(ctx, &data, sync)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.apply(ctx, &data, sync, updateTimeout, &resp.Diagnostics)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *resourceSyncResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ResourceSyncModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, syncRunTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deleting resource sync", map[string]any{"sync": data.Name.ValueString()})
+	if err := r.client.DeleteResourceSync(ctx, data.Id.ValueString()); err != nil && !komodo.IsNotFound(err) {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("deleting resource sync %q", data.Name.ValueString()), err)
+	}
+}
+
+// ImportState adopts an existing resource sync by id or name.
+func (r *resourceSyncResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
+	tfresource.ImportStatePassthroughID(ctx, tfpath.Root("id"), req, resp)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, tfpath.Root("run_on_apply"), false)...)
+}
+
+// apply runs the sync if run_on_apply is set, then refreshes its pending
+// diff into data. A failed refresh is only a warning: the sync itself is in
+// place, and Komodo refreshes the diff on its own schedule too.
+func (r *resourceSyncResource) apply(ctx context.Context, data *ResourceSyncModel, sync *komodo.ResourceSync, timeout time.Duration, diags *diag.Diagnostics) {
+	if data.RunOnApply.ValueBool() {
+		tflog.SubsystemInfo(ctx, logSubsystem, "Running resource sync")
+		update, err := r.client.RunSync(ctx, sync.ID.String())
+		if err != nil {
+			addAPIError(diags, "API Error", fmt.Sprintf("running resource sync %q", sync.Name), err)
+			return
+		}
+		if err := waitForUpdate(ctx, r.client, update, timeout); err != nil {
+			addAPIError(diags, "Sync Error", fmt.Sprintf("running resource sync %q", sync.Name), err)
+			return
+		}
+	}
+
+	refreshed, err := r.client.RefreshResourceSyncPending(ctx, sync.ID.String())
+	if err != nil {
+		diags.AddWarning("Pending Diff Not Refreshed", apiErrorDetail(fmt.Sprintf("refreshing resource sync %q", sync.Name), err))
+		return
+	}
+	diags.Append(setResourceSyncModel(ctx, data, refreshed)...)
+}
+
+// resourceSyncConfig builds the Komodo config for the attributes set in
+// data.
+func resourceSyncConfig(ctx context.Context, data ResourceSyncModel) (komodo.ResourceSyncConfig, diag.Diagnostics) {
+	resourcePath, diags := stringsPtr(ctx, data.ResourcePath)
+	return komodo.ResourceSyncConfig{
+		Repo:              stringPtr(data.Repo),
+		Branch:            stringPtr(data.Branch),
+		GitProvider:       stringPtr(data.GitProvider),
+		GitAccount:        stringPtr(data.GitAccount),
+		ResourcePath:      resourcePath,
+		FileContents:      stringPtr(data.FileContents),
+		Delete:            boolPtr(data.Delete),
+		IncludeUserGroups: boolPtr(data.IncludeUserGroups),
+		IncludeVariables:  boolPtr(data.IncludeVariables),
+		WebhookEnabled:    boolPtr(data.WebhookEnabled),
+		WebhookSecret:     stringPtr(data.WebhookSecret),
+	}, diags
+}
+
+// setResourceSyncModel copies sync into data. The webhook secret is kept as
+// configured.
+func setResourceSyncModel(ctx context.Context, data *ResourceSyncModel, sync *komodo.ResourceSync) diag.Diagnostics {
+	config := sync.Config
+	data.Id = tftypes.StringValue(sync.ID.String())
+	data.Name = tftypes.StringValue(sync.Name)
+	data.Repo = optionalString(data.Repo, deref(config.Repo))
+	data.Branch = tftypes.StringValue(deref(config.Branch))
+	data.GitProvider = tftypes.StringValue(deref(config.GitProvider))
+	data.GitAccount = optionalString(data.GitAccount, deref(config.GitAccount))
+	data.FileContents = optionalString(data.FileContents, deref(config.FileContents))
+	data.Delete = tftypes.BoolValue(deref(config.Delete))
+	data.IncludeUserGroups = tftypes.BoolValue(deref(config.IncludeUserGroups))
+	data.IncludeVariables = tftypes.BoolValue(deref(config.IncludeVariables))
+	data.WebhookEnabled = tftypes.BoolValue(deref(config.WebhookEnabled))
+	data.PendingError = tftypes.StringValue(sync.Info.PendingError)
+
+	var resourcePath []string
+	if config.ResourcePath != nil {
+		resourcePath = *config.ResourcePath
+	}
+	var diags, d diag.Diagnostics
+	data.ResourcePath, d = optionalStrings(ctx, data.ResourcePath, resourcePath)
+	diags.Append(d...)
+
+	pending := make([]attr.Value, 0, len(sync.Info.ResourceUpdates))
+	for _, u := range sync.Info.ResourceUpdates {
+		resource := u.Target.ID
+		if resource == "" {
+			resource = u.Data.Data.Name
+		}
+		value, d := tftypes.ObjectValue(pendingDiffType.AttrTypes, map[string]attr.Value{
+			"operation":     tftypes.StringValue(u.Data.Type),
+			"resource_type": tftypes.StringValue(u.Target.Type),
+			"resource":      tftypes.StringValue(resource),
+		})
+		diags.Append(d...)
+		pending = append(pending, value)
+	}
+	data.PendingDiff, d = tftypes.ListValue(pendingDiffType, pending)
+	diags.Append(d...)
+	return diags
+}
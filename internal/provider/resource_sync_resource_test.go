@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// pendingSync is a sync whose next run would create, update and delete one
+// resource each.
+const pendingSync = `{
+	"_id": {"$oid": "6650f1"},
+	"name": "acme",
+	"config": {"file_contents": "[[stack]]\nname = \"web\"\n", "branch": "main", "git_provider": "github.com"},
+	"info": {"resource_updates": [
+		{"target": {"type": "Stack", "id": ""}, "data": {"type": "Create", "data": {"name": "web"}}},
+		{"target": {"type": "Deployment", "id": "6650f2"}, "data": {"type": "Update"}},
+		{"target": {"type": "Procedure", "id": "6650f3"}, "data": {"type": "Delete"}}
+	]}
+}`
+
+// pendingDiff returns the (operation, resource_type, resource) triples of
+// data's pending_diff.
+func pendingDiff(t *testing.T, data ResourceSyncModel) []string {
+	t.Helper()
+	var out []string
+	for _, element := range data.PendingDiff.Elements() {
+		attrs := element.(tftypes.Object).Attributes()
+		out = append(out, strings.Join([]string{
+			attrs["operation"].(tftypes.String).ValueString(),
+			attrs["resource_type"].(tftypes.String).ValueString(),
+			attrs["resource"].(tftypes.String).ValueString(),
+		}, " "))
+	}
+	return out
+}
+
+func TestSetResourceSyncModelPendingDiff(t *testing.T) {
+	var sync komodo.ResourceSync
+	if err := json.Unmarshal([]byte(pendingSync), &sync); err != nil {
+		t.Fatalf("decoding sync: %s", err)
+	}
+	data := ResourceSyncModel{
+		Repo:         tftypes.StringNull(),
+		GitAccount:   tftypes.StringNull(),
+		ResourcePath: tftypes.ListNull(tftypes.StringType),
+	}
+	if diags := setResourceSyncModel(context.Background(), &data, &sync); diags.HasError() {
+		t.Fatalf("setResourceSyncModel: %v", diags)
+	}
+	// A resource the sync would create has no id yet and is named instead.
+	want := []string{"Create Stack web", "Update Deployment 6650f2", "Delete Procedure 6650f3"}
+	if got := pendingDiff(t, data); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("pending_diff = %v, want %v", got, want)
+	}
+	if data.PendingError.ValueString() != "" || !data.Repo.IsNull() {
+		t.Errorf("pending_error, repo = %s, %s; want empty and null", data.PendingError, data.Repo)
+	}
+
+	// A sync whose files cannot be read has no diff, only the error.
+	sync.Info = komodo.ResourceSyncInfo{PendingError: "failed to parse resources.toml"}
+	if diags := setResourceSyncModel(context.Background(), &data, &sync); diags.HasError() {
+		t.Fatalf("setResourceSyncModel: %v", diags)
+	}
+	if data.PendingDiff.IsNull() || len(data.PendingDiff.Elements()) != 0 {
+		t.Errorf("pending_diff = %s, want an empty list", data.PendingDiff)
+	}
+	if data.PendingError.ValueString() != "failed to parse resources.toml" {
+		t.Errorf("pending_error = %s, want the parse error", data.PendingError)
+	}
+}
+
+func TestResourceSyncApplyRefreshesPendingDiff(t *testing.T) {
+	var requests []string
+	refresh := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Type string `json:"type"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req.Type)
+		w.Write([]byte(pendingSync))
+	})
+	server := httptest.NewServer(refresh)
+	defer server.Close()
+	r := &resourceSyncResource{client: komodo.NewClient(server.URL, "key", "secret", server.Client())}
+	sync := &komodo.ResourceSync{ID: "6650f1", Name: "acme"}
+	ctx := context.Background()
+
+	data := ResourceSyncModel{
+		Repo:         tftypes.StringNull(),
+		GitAccount:   tftypes.StringNull(),
+		ResourcePath: tftypes.ListNull(tftypes.StringType),
+		RunOnApply:   tftypes.BoolValue(false),
+		PendingDiff:  tftypes.ListUnknown(pendingDiffType),
+	}
+	var diags diag.Diagnostics
+	r.apply(ctx, &data, sync, time.Minute, &diags)
+	if diags.HasError() || diags.WarningsCount() != 0 {
+		t.Fatalf("apply: %v", diags)
+	}
+	if len(requests) != 1 || requests[0] != "RefreshResourceSyncPending" {
+		t.Errorf("requests = %v, want only a refresh without run_on_apply", requests)
+	}
+	if got := pendingDiff(t, data); len(got) != 3 {
+		t.Errorf("pending_diff = %v, want the 3 refreshed changes", got)
+	}
+
+	// A failed refresh keeps the sync in place with a warning.
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"failed to clone repository"}`, http.StatusInternalServerError)
+	})
+	data.PendingDiff = tftypes.ListUnknown(pendingDiffType)
+	diags = nil
+	r.apply(ctx, &data, sync, time.Minute, &diags)
+	if diags.HasError() || diags.WarningsCount() != 1 || diags[0].Summary() != "Pending Diff Not Refreshed" {
+		t.Errorf("apply with a failed refresh = %v, want one warning", diags)
+	}
+}
+
+// testDelete runs the Delete of r on a sync with the given delete timeout.
+func testDelete(t *testing.T, r *resourceSyncResource, deleteTimeout string) diag.Diagnostics {
+	t.Helper()
+	ctx := context.Background()
+	var schemaResp tfresource.SchemaResponse
+	r.Schema(ctx, tfresource.SchemaRequest{}, &schemaResp)
+
+	timeoutTypes := map[string]attr.Type{"create": tftypes.StringType, "update": tftypes.StringType, "delete": tftypes.StringType}
+	timeoutsObject, diags := tftypes.ObjectValue(timeoutTypes, map[string]attr.Value{
+		"create": tftypes.StringNull(),
+		"update": tftypes.StringNull(),
+		"delete": tftypes.StringValue(deleteTimeout),
+	})
+	if diags.HasError() {
+		t.Fatalf("building timeouts: %v", diags)
+	}
+	data := ResourceSyncModel{
+		Id:           tftypes.StringValue("6650f1"),
+		Name:         tftypes.StringValue("acme"),
+		ResourcePath: tftypes.ListNull(tftypes.StringType),
+		PendingDiff:  tftypes.ListNull(pendingDiffType),
+		Timeouts:     timeouts.Value{Object: timeoutsObject},
+	}
+	req := tfresource.DeleteRequest{State: tfsdk.State{Schema: schemaResp.Schema}}
+	if diags := req.State.Set(ctx, &data); diags.HasError() {
+		t.Fatalf("setting state: %v", diags)
+	}
+	resp := tfresource.DeleteResponse{State: req.State}
+	r.Delete(ctx, req, &resp)
+	return resp.Diagnostics
+}
+
+func TestResourceSyncDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"deleted", http.StatusOK, `{}`, false},
+		{"already gone", http.StatusInternalServerError, `{"error":"did not find any resource_sync matching 6650f1"}`, false},
+		{"rejected", http.StatusForbidden, `{"error":"user does not have permission"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Type   string                          `json:"type"`
+					Params komodo.DeleteResourceSyncParams `json:"params"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				deleted = append(deleted, req.Type+" "+req.Params.ID)
+				http.Error(w, tt.body, tt.status)
+			}))
+			defer server.Close()
+			r := &resourceSyncResource{client: komodo.NewClient(server.URL, "key", "secret", server.Client())}
+
+			diags := testDelete(t, r, "1m")
+			if got := diags.HasError(); got != tt.wantErr {
+				t.Errorf("Delete error = %t, want %t: %v", got, tt.wantErr, diags)
+			}
+			if len(deleted) != 1 || deleted[0] != "DeleteResourceSync 6650f1" {
+				t.Errorf("requests = %v, want one DeleteResourceSync of the sync", deleted)
+			}
+		})
+	}
+}
+
+func TestResourceSyncDeleteTimeout(t *testing.T) {
+	// A core that never answers. The request context is only cancelled once
+	// the body has been read.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	r := &resourceSyncResource{client: komodo.NewClient(server.URL, "key", "secret", server.Client())}
+
+	start := time.Now()
+	diags := testDelete(t, r, "100ms")
+	if !diags.HasError() {
+		t.Fatal("Delete against a core that never answers succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Delete took %s, want it bounded by the 100ms delete timeout", elapsed)
+	}
+}
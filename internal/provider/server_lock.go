@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"example.com/me/komodo-provider/internal/komodo"
+)
+
+// serverLocks serialises work on a Komodo server across all resources of one
+// provider instance. Komodo rejects a procedure run with "Procedure busy"
+// while another one is still running on the same server, so resources that
+// share a server take turns instead.
+type serverLocks struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func newServerLocks() *serverLocks {
+	return &serverLocks{locks: map[string]chan struct{}{}}
+}
+
+// lock blocks until the lock for server is free or ctx is done. On success
+// it returns the function that releases the lock.
+func (l *serverLocks) lock(ctx context.Context, server string) (func(), error) {
+	l.mu.Lock()
+	ch, ok := l.locks[server]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		l.locks[server] = ch
+	}
+	l.mu.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lockServer locks server, given by id or name, under its id, so that
+// resources naming the same server by id and by name share one lock. A
+// server that does not exist is locked under the given value: nothing can be
+// running on it.
+func (l *serverLocks) lockServer(ctx context.Context, client *komodo.Client, server string) (func(), error) {
+	key := server
+	s, err := client.GetServer(ctx, server)
+	switch {
+	case err == nil:
+		key = string(s.ID)
+	case !komodo.IsNotFound(err):
+		return nil, err
+	}
+	return l.lock(ctx, key)
+}
+
+// lockServerOf is lockServer for the server a stack or deployment is
+// assigned to. One without a server has nothing to wait for, so server may
+// be empty, in which case nothing is locked.
+func (l *serverLocks) lockServerOf(ctx context.Context, client *komodo.Client, server string) (func(), error) {
+	if server == "" {
+		return func() {}, nil
+	}
+	return l.lockServer(ctx, client, server)
+}
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+)
+
+func TestLockServerSharesLockByIDAndName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"_id":{"$oid":"6650f1"},"name":"server-alice"}`))
+	}))
+	defer server.Close()
+	client := komodo.NewClient(server.URL, "key", "secret", server.Client())
+	locks := newServerLocks()
+
+	unlock, err := locks.lockServer(context.Background(), client, "server-alice")
+	if err != nil {
+		t.Fatalf("locking by name: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := locks.lockServer(ctx, client, "6650f1"); err == nil {
+		t.Fatal("locking by id succeeded while the name lock was held")
+	}
+
+	unlock()
+	unlock, err = locks.lockServer(context.Background(), client, "6650f1")
+	if err != nil {
+		t.Fatalf("locking by id after release: %s", err)
+	}
+	unlock()
+}
+
+func TestLockServerMissingServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"did not find any server matching server-bob"}`, http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := komodo.NewClient(server.URL, "key", "secret", server.Client())
+
+	unlock, err := newServerLocks().lockServer(context.Background(), client, "server-bob")
+	if err != nil {
+		t.Fatalf("locking a missing server: %s", err)
+	}
+	unlock()
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	})
+	if _, err := newServerLocks().lockServer(context.Background(), client, "server-bob"); err == nil || !strings.Contains(err.Error(), "invalid api key") {
+		t.Errorf("lockServer with a rejected key = %v, want the API error", err)
+	}
+}
@@ -0,0 +1,395 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/float64validator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/float64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+var _ tfresource.Resource = &serverResource{}
+var _ tfresource.ResourceWithImportState = &serverResource{}
+
+// defaultServerCreateTimeout covers waiting for a self-registering periphery
+// and for it to come online, 15 minutes each as for client deployments.
+const defaultServerCreateTimeout = 30 * time.Minute
+
+// serverResource manages a Komodo server on its own, for deployments that do
+// not want one derived from a komodo-provider_user name.
+type serverResource struct {
+	client      *komodo.Client
+	serverLocks *serverLocks
+	logSecrets  []string
+}
+
+type ServerModel struct {
+	Id                    tftypes.String  `tfsdk:"id"`
+	Name                  tftypes.String  `tfsdk:"name"`
+	Address               tftypes.String  `tfsdk:"address"`
+	Enabled               tftypes.Bool    `tfsdk:"enabled"`
+	Region                tftypes.String  `tfsdk:"region"`
+	Passkey               tftypes.String  `tfsdk:"passkey"`
+	IgnoreMounts          tftypes.List    `tfsdk:"ignore_mounts"`
+	StatsMonitoring       tftypes.Bool    `tfsdk:"stats_monitoring"`
+	SendUnreachableAlerts tftypes.Bool    `tfsdk:"send_unreachable_alerts"`
+	SendCPUAlerts         tftypes.Bool    `tfsdk:"send_cpu_alerts"`
+	SendMemAlerts         tftypes.Bool    `tfsdk:"send_mem_alerts"`
+	SendDiskAlerts        tftypes.Bool    `tfsdk:"send_disk_alerts"`
+	CPUWarning            tftypes.Float64 `tfsdk:"cpu_warning"`
+	CPUCritical           tftypes.Float64 `tfsdk:"cpu_critical"`
+	MemWarning            tftypes.Float64 `tfsdk:"mem_warning"`
+	MemCritical           tftypes.Float64 `tfsdk:"mem_critical"`
+	DiskWarning           tftypes.Float64 `tfsdk:"disk_warning"`
+	DiskCritical          tftypes.Float64 `tfsdk:"disk_critical"`
+	WaitForRegistration   tftypes.Bool    `tfsdk:"wait_for_registration"`
+	Timeouts              timeouts.Value  `tfsdk:"timeouts"`
+}
+
+func NewServerResource() tfresource.Resource {
+	return &serverResource{}
+}
+
+func (r *serverResource) Metadata(ctx context.Context, req tfresource.MetadataRequest, resp *tfresource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_server"
+}
+
+func (r *serverResource) Schema(ctx context.Context, req tfresource.SchemaRequest, resp *tfresource.SchemaResponse) {
+	// Settings Komodo fills in with its own defaults when they are not
+	// configured.
+	computedBool := func(description string) tfschema.BoolAttribute {
+		return tfschema.BoolAttribute{
+			MarkdownDescription: description,
+			Optional:            true,
+			Computed:            true,
+			PlanModifiers:       []planmodifier.Bool{boolplanmodifier.UseStateForUnknown()},
+		}
+	}
+	threshold := func(description string) tfschema.Float64Attribute {
+		return tfschema.Float64Attribute{
+			MarkdownDescription: description,
+			Optional:            true,
+			Computed:            true,
+			PlanModifiers:       []planmodifier.Float64{float64planmodifier.UseStateForUnknown()},
+			Validators:          []validator.Float64{float64validator.Between(0, 100)},
+		}
+	}
+
+	resp.Schema = tfschema.Schema{
+		MarkdownDescription: "A Komodo server: the periphery agent on one host that stacks, deployments and procedures run on",
+		Attributes: map[string]tfschema.Attribute{
+			"id": tfschema.StringAttribute{
+				MarkdownDescription: "The Komodo id of the server",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": tfschema.StringAttribute{
+				MarkdownDescription: "The name of the server. With `wait_for_registration`, the name the periphery registers itself under. Changing it replaces the server",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"address": tfschema.StringAttribute{
+				MarkdownDescription: "The periphery URL core connects to, e.g. `https://10.0.0.5:8120`. Leave unset for a periphery that connects out to core",
+				Optional:            true,
+			},
+			"enabled": tfschema.BoolAttribute{
+				MarkdownDescription: "Whether core connects to the server. Defaults to `true`",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(true),
+			},
+			"region": tfschema.StringAttribute{
+				MarkdownDescription: "A free-form region label",
+				Optional:            true,
+			},
+			"passkey": tfschema.StringAttribute{
+				MarkdownDescription: "Passkey for this periphery, overriding the core's default",
+				Optional:            true,
+				Sensitive:           true,
+			},
+			"ignore_mounts": tfschema.ListAttribute{
+				MarkdownDescription: "Mount points to leave out of the disk stats",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+			},
+			"stats_monitoring":        computedBool("Whether core collects system stats from the server"),
+			"send_unreachable_alerts": computedBool("Whether to alert when the server cannot be reached"),
+			"send_cpu_alerts":         computedBool("Whether to alert on CPU usage above the thresholds"),
+			"send_mem_alerts":         computedBool("Whether to alert on memory usage above the thresholds"),
+			"send_disk_alerts":        computedBool("Whether to alert on disk usage above the thresholds"),
+			"cpu_warning":             threshold("CPU usage, in percent, that raises a warning"),
+			"cpu_critical":            threshold("CPU usage, in percent, that raises a critical alert"),
+			"mem_warning":             threshold("Memory usage, in percent, that raises a warning"),
+			"mem_critical":            threshold("Memory usage, in percent, that raises a critical alert"),
+			"disk_warning":            threshold("Disk usage, in percent, that raises a warning"),
+			"disk_critical":           threshold("Disk usage, in percent, that raises a critical alert"),
+			"wait_for_registration": tfschema.BoolAttribute{
+				MarkdownDescription: "Instead of creating the server, wait for a periphery started with an onboarding key to register itself under `name`, then apply this configuration and, if enabled, wait for it to come online",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+		},
+		Blocks: map[string]tfschema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+			}),
+		},
+	}
+}
+
+func (r *serverResource) Configure(ctx context.Context, req tfresource.ConfigureRequest, resp *tfresource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	provider, ok := req.ProviderData.(*KomodoProvider)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *KomodoProvider, got: %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = provider.client
+	r.serverLocks = provider.serverLocks
+	r.logSecrets = provider.logSecrets()
+}
+
+func (r *serverResource) Create(ctx context.Context, req tfresource.CreateRequest, resp *tfresource.CreateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ServerModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultServerCreateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	config, diags := serverConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "server", name)
+
+	var server *komodo.Server
+	var err error
+	if data.WaitForRegistration.ValueBool() {
+		tflog.SubsystemInfo(ctx, logSubsystem, "Waiting for server to register", map[string]any{"timeout": createTimeout.String()})
+		if err := waitForServerAvailability(ctx, r.client, name, 15*time.Minute, 10*time.Second); err != nil {
+			addAPIError(&resp.Diagnostics, "Server Error", fmt.Sprintf("waiting for server %q to register", name), err)
+			return
+		}
+		server, err = r.client.UpdateServer(ctx, name, config)
+		if err != nil {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating server %q", name), err)
+			return
+		}
+	} else {
+		tflog.SubsystemInfo(ctx, logSubsystem, "Creating server")
+		server, err = r.client.CreateServer(ctx, name, config)
+		if err != nil {
+			addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("creating server %q", name), err)
+			return
+		}
+	}
+
+	// The server exists in Komodo from here on. Record it before waiting for
+	// its periphery agent, which may not connect before the timeout.
+	resp.Diagnostics.Append(setServerModel(ctx, &data, server)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.WaitForRegistration.ValueBool() && data.Enabled.ValueBool() {
+		if err := waitForServerStateEnabled(ctx, r.client, name, 15*time.Minute, 10*time.Second); err != nil {
+			addAPIError(&resp.Diagnostics, "Server Error", fmt.Sprintf("waiting for server %q to reach OK state", name), err)
+			return
+		}
+	}
+}
+
+func (r *serverResource) Read(ctx context.Context, req tfresource.ReadRequest, resp *tfresource.ReadResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ServerModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	server, err := r.client.GetServer(ctx, data.Id.ValueString())
+	if err != nil {
+		if komodo.IsNotFound(err) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("reading server %q", data.Id.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(setServerModel(ctx, &data, server)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *serverResource) Update(ctx context.Context, req tfresource.UpdateRequest, resp *tfresource.UpdateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ServerModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	config, diags := serverConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var prior ServerModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	clearRemoved(data.Address, prior.Address, &config.Address, "")
+	clearRemoved(data.Region, prior.Region, &config.Region, "")
+	clearRemoved(data.Passkey, prior.Passkey, &config.Passkey, "")
+	clearRemoved(data.IgnoreMounts, prior.IgnoreMounts, &config.IgnoreMounts, []string{})
+
+	server, err := r.client.UpdateServer(ctx, data.Id.ValueString(), config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating server %q", data.Name.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(setServerModel(ctx, &data, server)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *serverResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data ServerModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Wait for any procedure still running on the server.
+	unlock, err := r.serverLocks.lockServer(ctx, r.client, data.Id.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Delete Interrupted", fmt.Sprintf("Error waiting for other procedures on %s: %s", data.Name.ValueString(), err))
+		return
+	}
+	defer unlock()
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deleting server", map[string]any{"server": data.Name.ValueString()})
+	if err := r.client.DeleteServer(ctx, data.Id.ValueString()); err != nil && !komodo.IsNotFound(err) {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("deleting server %q", data.Name.ValueString()), err)
+	}
+}
+
+// ImportState adopts an existing server by id or name.
+func (r *serverResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
+	tfresource.ImportStatePassthroughID(ctx, tfpath.Root("id"), req, resp)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, tfpath.Root("wait_for_registration"), false)...)
+}
+
+// serverConfig builds the Komodo config for the attributes set in data.
+func serverConfig(ctx context.Context, data ServerModel) (komodo.ServerConfig, diag.Diagnostics) {
+	ignoreMounts, diags := stringsPtr(ctx, data.IgnoreMounts)
+	return komodo.ServerConfig{
+		Address:               stringPtr(data.Address),
+		Enabled:               boolPtr(data.Enabled),
+		Region:                stringPtr(data.Region),
+		Passkey:               stringPtr(data.Passkey),
+		IgnoreMounts:          ignoreMounts,
+		StatsMonitoring:       boolPtr(data.StatsMonitoring),
+		SendUnreachableAlerts: boolPtr(data.SendUnreachableAlerts),
+		SendCPUAlerts:         boolPtr(data.SendCPUAlerts),
+		SendMemAlerts:         boolPtr(data.SendMemAlerts),
+		SendDiskAlerts:        boolPtr(data.SendDiskAlerts),
+		CPUWarning:            float64Ptr(data.CPUWarning),
+		CPUCritical:           float64Ptr(data.CPUCritical),
+		MemWarning:            float64Ptr(data.MemWarning),
+		MemCritical:           float64Ptr(data.MemCritical),
+		DiskWarning:           float64Ptr(data.DiskWarning),
+		DiskCritical:          float64Ptr(data.DiskCritical),
+	}, diags
+}
+
+// setServerModel copies server into data. The passkey is kept as configured;
+// Komodo does not hand it back.
+func setServerModel(ctx context.Context, data *ServerModel, server *komodo.Server) diag.Diagnostics {
+	config := server.Config
+	data.Id = tftypes.StringValue(server.ID.String())
+	data.Name = tftypes.StringValue(server.Name)
+	data.Address = optionalString(data.Address, deref(config.Address))
+	data.Region = optionalString(data.Region, deref(config.Region))
+	data.Enabled = tftypes.BoolValue(deref(config.Enabled))
+	data.StatsMonitoring = tftypes.BoolValue(deref(config.StatsMonitoring))
+	data.SendUnreachableAlerts = tftypes.BoolValue(deref(config.SendUnreachableAlerts))
+	data.SendCPUAlerts = tftypes.BoolValue(deref(config.SendCPUAlerts))
+	data.SendMemAlerts = tftypes.BoolValue(deref(config.SendMemAlerts))
+	data.SendDiskAlerts = tftypes.BoolValue(deref(config.SendDiskAlerts))
+	data.CPUWarning = tftypes.Float64Value(deref(config.CPUWarning))
+	data.CPUCritical = tftypes.Float64Value(deref(config.CPUCritical))
+	data.MemWarning = tftypes.Float64Value(deref(config.MemWarning))
+	data.MemCritical = tftypes.Float64Value(deref(config.MemCritical))
+	data.DiskWarning = tftypes.Float64Value(deref(config.DiskWarning))
+	data.DiskCritical = tftypes.Float64Value(deref(config.DiskCritical))
+	if data.Passkey.IsUnknown() {
+		data.Passkey = tftypes.StringNull()
+	}
+
+	var ignoreMounts []string
+	if config.IgnoreMounts != nil {
+		ignoreMounts = *config.IgnoreMounts
+	}
+	var diags diag.Diagnostics
+	data.IgnoreMounts, diags = optionalStrings(ctx, data.IgnoreMounts, ignoreMounts)
+	return diags
+}
+
+// serverReference is resourceReference for a reference to a server.
+func serverReference(ctx context.Context, client *komodo.Client, prior tftypes.String, serverID string) tftypes.String {
+	return resourceReference(ctx, prior, serverID, func(ctx context.Context, server string) (string, error) {
+		s, err := client.GetServer(ctx, server)
+		if err != nil {
+			return "", err
+		}
+		return s.ID.String(), nil
+	})
+}
@@ -0,0 +1,453 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfpath "github.com/hashicorp/terraform-plugin-framework/path"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	tfschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+var _ tfresource.Resource = &stackResource{}
+var _ tfresource.ResourceWithImportState = &stackResource{}
+
+// defaultStackTimeout bounds create, update and delete of a stack. A deploy
+// may pull large images, so it matches procedureRunTimeout.
+const defaultStackTimeout = procedureRunTimeout
+
+// stackResource manages a single Komodo stack, a docker compose project on
+// one server, outside of any resources.toml.
+type stackResource struct {
+	client      *komodo.Client
+	serverLocks *serverLocks
+	logSecrets  []string
+}
+
+type StackModel struct {
+	Id              tftypes.String `tfsdk:"id"`
+	Name            tftypes.String `tfsdk:"name"`
+	ServerID        tftypes.String `tfsdk:"server_id"`
+	FileContents    tftypes.String `tfsdk:"file_contents"`
+	Repo            tftypes.String `tfsdk:"repo"`
+	Branch          tftypes.String `tfsdk:"branch"`
+	GitProvider     tftypes.String `tfsdk:"git_provider"`
+	GitAccount      tftypes.String `tfsdk:"git_account"`
+	FilePaths       tftypes.List   `tfsdk:"file_paths"`
+	FilesOnHost     tftypes.Bool   `tfsdk:"files_on_host"`
+	RunDirectory    tftypes.String `tfsdk:"run_directory"`
+	Environment     tftypes.String `tfsdk:"environment"`
+	Reclone         tftypes.Bool   `tfsdk:"reclone"`
+	DeployOnChange  tftypes.Bool   `tfsdk:"deploy_on_change"`
+	DestroyOnDelete tftypes.Bool   `tfsdk:"destroy_on_delete"`
+	Timeouts        timeouts.Value `tfsdk:"timeouts"`
+}
+
+func NewStackResource() tfresource.Resource {
+	return &stackResource{}
+}
+
+func (r *stackResource) Metadata(ctx context.Context, req tfresource.MetadataRequest, resp *tfresource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_stack"
+}
+
+func (r *stackResource) Schema(ctx context.Context, req tfresource.SchemaRequest, resp *tfresource.SchemaResponse) {
+	resp.Schema = tfschema.Schema{
+		MarkdownDescription: "A Komodo stack: a docker compose project deployed on one server",
+		Attributes: map[string]tfschema.Attribute{
+			"id": tfschema.StringAttribute{
+				MarkdownDescription: "The Komodo id of the stack",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": tfschema.StringAttribute{
+				MarkdownDescription: "The name of the stack. Changing it replaces the stack",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"server_id": tfschema.StringAttribute{
+				MarkdownDescription: "Id or name of the server to deploy on, e.g. `komodo-provider_server.edge.id`",
+				Optional:            true,
+			},
+			"file_contents": tfschema.StringAttribute{
+				MarkdownDescription: "The compose file, when it is defined here rather than in a repository or on the host",
+				Optional:            true,
+			},
+			"repo": tfschema.StringAttribute{
+				MarkdownDescription: "Repository holding the compose files, as `owner/name`",
+				Optional:            true,
+			},
+			"branch": tfschema.StringAttribute{
+				MarkdownDescription: "Branch of `repo` to deploy. Defaults to Komodo's default, `main`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"git_provider": tfschema.StringAttribute{
+				MarkdownDescription: "Domain of the git provider hosting `repo`. Defaults to Komodo's default, `github.com`",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"git_account": tfschema.StringAttribute{
+				MarkdownDescription: "Komodo git provider account used to clone `repo`",
+				Optional:            true,
+			},
+			"file_paths": tfschema.ListAttribute{
+				MarkdownDescription: "Compose files relative to `run_directory`. Defaults to `compose.yaml`",
+				ElementType:         tftypes.StringType,
+				Optional:            true,
+			},
+			"files_on_host": tfschema.BoolAttribute{
+				MarkdownDescription: "Read the compose files from `run_directory` on the server instead of a repository or `file_contents`",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"run_directory": tfschema.StringAttribute{
+				MarkdownDescription: "Directory `docker compose` runs in, relative to the repository root, or an absolute path with `files_on_host`",
+				Optional:            true,
+			},
+			"environment": tfschema.StringAttribute{
+				MarkdownDescription: "Variables written to the stack's `.env` file, one `KEY=value` per line",
+				Optional:            true,
+				Sensitive:           true,
+			},
+			"reclone": tfschema.BoolAttribute{
+				MarkdownDescription: "Delete and clone the repository again on each deploy instead of pulling",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"deploy_on_change": tfschema.BoolAttribute{
+				MarkdownDescription: "Deploy the stack after it is created and whenever its configuration changes, and wait for the deploy to finish",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"destroy_on_delete": tfschema.BoolAttribute{
+				MarkdownDescription: "Take the stack's containers down (`DestroyStack`) before deleting it. Otherwise they keep running",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+		},
+		Blocks: map[string]tfschema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *stackResource) Configure(ctx context.Context, req tfresource.ConfigureRequest, resp *tfresource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	provider, ok := req.ProviderData.(*KomodoProvider)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *KomodoProvider, got: %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = provider.client
+	r.serverLocks = provider.serverLocks
+	r.logSecrets = provider.logSecrets()
+}
+
+func (r *stackResource) Create(ctx context.Context, req tfresource.CreateRequest, resp *tfresource.CreateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data StackModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultStackTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	config, diags := stackConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "stack", name)
+	tflog.SubsystemInfo(ctx, logSubsystem, "Creating stack")
+	stack, err := r.client.CreateStack(ctx, name, config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("creating stack %q", name), err)
+		return
+	}
+
+	// A compose file that fails to come up does not remove the stack, so
+	// record it before the first deploy.
+	resp.Diagnostics.Append(r.setStackModel(ctx, &data, stack)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.DeployOnChange.ValueBool() {
+		r.deploy(ctx, stack, createTimeout, &resp.Diagnostics)
+	}
+}
+
+func (r *stackResource) Read(ctx context.Context, req tfresource.ReadRequest, resp *tfresource.ReadResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data StackModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	stack, err := r.client.GetStack(ctx, data.Id.ValueString())
+	if err != nil {
+		if komodo.IsNotFound(err) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("reading stack %q", data.Id.ValueString()), err)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setStackModel(ctx, &data, stack)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *stackResource) Update(ctx context.Context, req tfresource.UpdateRequest, resp *tfresource.UpdateResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data, prior StackModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultStackTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	config, diags := stackConfig(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	priorConfig, diags := stackConfig(ctx, prior)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	changed := !reflect.DeepEqual(config, priorConfig)
+
+	clearRemoved(data.ServerID, prior.ServerID, &config.ServerID, "")
+	clearRemoved(data.FileContents, prior.FileContents, &config.FileContents, "")
+	clearRemoved(data.Repo, prior.Repo, &config.Repo, "")
+	clearRemoved(data.GitAccount, prior.GitAccount, &config.GitAccount, "")
+	clearRemoved(data.RunDirectory, prior.RunDirectory, &config.RunDirectory, "")
+	clearRemoved(data.Environment, prior.Environment, &config.Environment, "")
+	clearRemoved(data.FilePaths, prior.FilePaths, &config.FilePaths, []string{})
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "stack", name)
+	stack, err := r.client.UpdateStack(ctx, data.Id.ValueString(), config)
+	if err != nil {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("updating stack %q", name), err)
+		return
+	}
+
+	// The new config is only recorded once it is deployed. A failed deploy
+	// puts the prior config back, in Komodo and in state, so that the next
+	// plan still shows the change and the next apply deploys it again.
+	if changed && data.DeployOnChange.ValueBool() && !r.deploy(ctx, stack, updateTimeout, &resp.Diagnostics) {
+		r.restore(ctx, data, prior, priorConfig, &resp.Diagnostics)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &prior)...)
+		return
+	}
+
+	resp.Diagnostics.Append(r.setStackModel(ctx, &data, stack)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// restore puts the config of prior back on the stack after the update to
+// data failed to deploy.
+func (r *stackResource) restore(ctx context.Context, data, prior StackModel, config komodo.StackConfig, diags *diag.Diagnostics) {
+	// ctx may have run out during the deploy.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	clearRemoved(prior.ServerID, data.ServerID, &config.ServerID, "")
+	clearRemoved(prior.FileContents, data.FileContents, &config.FileContents, "")
+	clearRemoved(prior.Repo, data.Repo, &config.Repo, "")
+	clearRemoved(prior.GitAccount, data.GitAccount, &config.GitAccount, "")
+	clearRemoved(prior.RunDirectory, data.RunDirectory, &config.RunDirectory, "")
+	clearRemoved(prior.Environment, data.Environment, &config.Environment, "")
+	clearRemoved(prior.FilePaths, data.FilePaths, &config.FilePaths, []string{})
+
+	tflog.SubsystemWarn(ctx, logSubsystem, "Deploy failed, restoring the prior stack config")
+	if _, err := r.client.UpdateStack(ctx, prior.Id.ValueString(), config); err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("restoring stack %q after the failed deploy", prior.Name.ValueString()), err)
+	}
+}
+
+func (r *stackResource) Delete(ctx context.Context, req tfresource.DeleteRequest, resp *tfresource.DeleteResponse) {
+	ctx = withLogging(ctx, r.logSecrets)
+
+	var data StackModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultStackTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	name := data.Name.ValueString()
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, "stack", name)
+
+	if data.DestroyOnDelete.ValueBool() && !r.destroy(ctx, data, deleteTimeout, &resp.Diagnostics) {
+		return
+	}
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deleting stack")
+	if err := r.client.DeleteStack(ctx, data.Id.ValueString()); err != nil && !komodo.IsNotFound(err) {
+		addAPIError(&resp.Diagnostics, "API Error", fmt.Sprintf("deleting stack %q", name), err)
+	}
+}
+
+// ImportState adopts an existing stack by id or name.
+func (r *stackResource) ImportState(ctx context.Context, req tfresource.ImportStateRequest, resp *tfresource.ImportStateResponse) {
+	tfresource.ImportStatePassthroughID(ctx, tfpath.Root("id"), req, resp)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, tfpath.Root("deploy_on_change"), false)...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, tfpath.Root("destroy_on_delete"), false)...)
+}
+
+// deploy runs DeployStack and waits for it to finish. It reports whether the
+// deploy succeeded.
+func (r *stackResource) deploy(ctx context.Context, stack *komodo.Stack, timeout time.Duration, diags *diag.Diagnostics) bool {
+	unlock, err := r.serverLocks.lockServerOf(ctx, r.client, deref(stack.Config.ServerID))
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("waiting for other work on the server of stack %q", stack.Name), err)
+		return false
+	}
+	defer unlock()
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Deploying stack")
+	update, err := r.client.DeployStack(ctx, stack.ID.String())
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("deploying stack %q", stack.Name), err)
+		return false
+	}
+	if err := waitForUpdate(ctx, r.client, update, timeout); err != nil {
+		addAPIError(diags, "Stack Error", fmt.Sprintf("deploying stack %q", stack.Name), err)
+		return false
+	}
+	return true
+}
+
+// destroy runs DestroyStack and waits for it to finish. It reports whether
+// the stack can be deleted next, which it cannot when the destroy failed or
+// the stack is already gone.
+func (r *stackResource) destroy(ctx context.Context, data StackModel, timeout time.Duration, diags *diag.Diagnostics) bool {
+	name := data.Name.ValueString()
+	unlock, err := r.serverLocks.lockServerOf(ctx, r.client, data.ServerID.ValueString())
+	if err != nil {
+		addAPIError(diags, "API Error", fmt.Sprintf("waiting for other work on the server of stack %q", name), err)
+		return false
+	}
+	defer unlock()
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "Destroying stack")
+	update, err := r.client.DestroyStack(ctx, data.Id.ValueString())
+	if err != nil {
+		if !komodo.IsNotFound(err) {
+			addAPIError(diags, "API Error", fmt.Sprintf("destroying stack %q", name), err)
+		}
+		return false
+	}
+	if err := waitForUpdate(ctx, r.client, update, timeout); err != nil {
+		addAPIError(diags, "Stack Error", fmt.Sprintf("destroying stack %q", name), err)
+		return false
+	}
+	return true
+}
+
+// stackConfig builds the Komodo config for the attributes set in data.
+func stackConfig(ctx context.Context, data StackModel) (komodo.StackConfig, diag.Diagnostics) {
+	filePaths, diags := stringsPtr(ctx, data.FilePaths)
+	return komodo.StackConfig{
+		ServerID:     stringPtr(data.ServerID),
+		FileContents: stringPtr(data.FileContents),
+		Repo:         stringPtr(data.Repo),
+		Branch:       stringPtr(data.Branch),
+		GitProvider:  stringPtr(data.GitProvider),
+		GitAccount:   stringPtr(data.GitAccount),
+		FilePaths:    filePaths,
+		FilesOnHost:  boolPtr(data.FilesOnHost),
+		RunDirectory: stringPtr(data.RunDirectory),
+		Environment:  stringPtr(data.Environment),
+		Reclone:      boolPtr(data.Reclone),
+	}, diags
+}
+
+// setStackModel copies stack into data.
+func (r *stackResource) setStackModel(ctx context.Context, data *StackModel, stack *komodo.Stack) diag.Diagnostics {
+	config := stack.Config
+	data.Id = tftypes.StringValue(stack.ID.String())
+	data.Name = tftypes.StringValue(stack.Name)
+	data.ServerID = serverReference(ctx, r.client, data.ServerID, deref(config.ServerID))
+	data.FileContents = optionalString(data.FileContents, deref(config.FileContents))
+	data.Repo = optionalString(data.Repo, deref(config.Repo))
+	data.Branch = tftypes.StringValue(deref(config.Branch))
+	data.GitProvider = tftypes.StringValue(deref(config.GitProvider))
+	data.GitAccount = optionalString(data.GitAccount, deref(config.GitAccount))
+	data.FilesOnHost = tftypes.BoolValue(deref(config.FilesOnHost))
+	data.RunDirectory = optionalString(data.RunDirectory, deref(config.RunDirectory))
+	data.Environment = optionalString(data.Environment, deref(config.Environment))
+	data.Reclone = tftypes.BoolValue(deref(config.Reclone))
+
+	var filePaths []string
+	if config.FilePaths != nil {
+		filePaths = *config.FilePaths
+	}
+	var diags diag.Diagnostics
+	data.FilePaths, diags = optionalStrings(ctx, data.FilePaths, filePaths)
+	return diags
+}
@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tfresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// fakeCore is a Komodo core holding the config of a single stack or
+// deployment, on the server "edge" with id "srv1". Deploys fail while
+// failDeploys is set.
+type fakeCore struct {
+	mu          sync.Mutex
+	config      map[string]any
+	failDeploys bool
+	requests    []string
+}
+
+func newFakeCore(t *testing.T, config map[string]any) (*fakeCore, *komodo.Client) {
+	t.Helper()
+	core := &fakeCore{config: config}
+	server := httptest.NewServer(core)
+	t.Cleanup(server.Close)
+	return core, komodo.NewClient(server.URL, "key", "secret", server.Client())
+}
+
+func (c *fakeCore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type   string `json:"type"`
+		Params struct {
+			Config map[string]any `json:"config"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req.Type)
+
+	var out any
+	switch req.Type {
+	case "GetServer":
+		out = map[string]any{"_id": "srv1", "name": "edge"}
+	case "UpdateStack", "UpdateDeployment":
+		for key, value := range req.Params.Config {
+			c.config[key] = value
+		}
+		fallthrough
+	case "GetStack", "GetDeployment":
+		out = map[string]any{"_id": "s1", "name": "app", "config": c.config}
+	case "DeployStack", "DestroyStack", "Deploy", "Destroy":
+		failed := c.failDeploys && (req.Type == "DeployStack" || req.Type == "Deploy")
+		out = komodo.Update{ID: "u1", Operation: req.Type, Status: komodo.UpdateStatusComplete, Success: !failed}
+	default:
+		http.Error(w, `{"error":"unexpected request"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// sent returns the requests the core has seen since the last call.
+func (c *fakeCore) sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	requests := c.requests
+	c.requests = nil
+	return requests
+}
+
+// nullTimeouts is an unset timeouts block with create, update and delete.
+func nullTimeouts() timeouts.Value {
+	return timeouts.Value{Object: tftypes.ObjectNull(map[string]attr.Type{
+		"create": tftypes.StringType,
+		"update": tftypes.StringType,
+		"delete": tftypes.StringType,
+	})}
+}
+
+// testUpdate runs the Update of r from prior to planned and returns the
+// state it records.
+func testUpdate[M any](t *testing.T, ctx context.Context, r tfresource.Resource, prior, planned M) (M, diag.Diagnostics) {
+	t.Helper()
+	var schemaResp tfresource.SchemaResponse
+	r.Schema(ctx, tfresource.SchemaRequest{}, &schemaResp)
+	req := tfresource.UpdateRequest{
+		Plan:  tfsdk.Plan{Schema: schemaResp.Schema},
+		State: tfsdk.State{Schema: schemaResp.Schema},
+	}
+	if diags := req.Plan.Set(ctx, &planned); diags.HasError() {
+		t.Fatalf("setting plan: %v", diags)
+	}
+	if diags := req.State.Set(ctx, &prior); diags.HasError() {
+		t.Fatalf("setting state: %v", diags)
+	}
+	resp := tfresource.UpdateResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: req.Plan.Raw.Copy()}}
+	r.Update(ctx, req, &resp)
+
+	var state M
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("reading state: %v", diags)
+	}
+	return state, resp.Diagnostics
+}
+
+// testRead runs the Read of r on state and returns the refreshed state.
+func testRead[M any](t *testing.T, ctx context.Context, r tfresource.Resource, state M) M {
+	t.Helper()
+	var schemaResp tfresource.SchemaResponse
+	r.Schema(ctx, tfresource.SchemaRequest{}, &schemaResp)
+	req := tfresource.ReadRequest{State: tfsdk.State{Schema: schemaResp.Schema}}
+	if diags := req.State.Set(ctx, &state); diags.HasError() {
+		t.Fatalf("setting state: %v", diags)
+	}
+	resp := tfresource.ReadResponse{State: req.State}
+	r.Read(ctx, req, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: %v", resp.Diagnostics)
+	}
+	var refreshed M
+	if diags := resp.State.Get(ctx, &refreshed); diags.HasError() {
+		t.Fatalf("reading state: %v", diags)
+	}
+	return refreshed
+}
+
+func TestStackUpdateDeployOnChange(t *testing.T) {
+	ctx := context.Background()
+	core, client := newFakeCore(t, map[string]any{
+		"server_id":     "srv1",
+		"file_contents": "services: {web: {image: nginx:1.26}}",
+		"branch":        "main",
+		"git_provider":  "github.com",
+	})
+	r := &stackResource{client: client, serverLocks: newServerLocks()}
+
+	prior := StackModel{
+		Id:              tftypes.StringValue("s1"),
+		Name:            tftypes.StringValue("app"),
+		ServerID:        tftypes.StringValue("edge"),
+		FileContents:    tftypes.StringValue("services: {web: {image: nginx:1.26}}"),
+		Branch:          tftypes.StringValue("main"),
+		GitProvider:     tftypes.StringValue("github.com"),
+		FilePaths:       tftypes.ListNull(tftypes.StringType),
+		FilesOnHost:     tftypes.BoolValue(false),
+		Reclone:         tftypes.BoolValue(false),
+		DeployOnChange:  tftypes.BoolValue(true),
+		DestroyOnDelete: tftypes.BoolValue(false),
+		Timeouts:        nullTimeouts(),
+	}
+	planned := prior
+	planned.FileContents = tftypes.StringValue("services: {web: {image: nginx:1.27}}")
+	planned.Environment = tftypes.StringValue("PORT=8080")
+
+	// A failed deploy leaves the prior config in Komodo and in state, so
+	// that the change is still planned after a refresh.
+	core.failDeploys = true
+	state, diags := testUpdate(t, ctx, r, prior, planned)
+	if !diags.HasError() {
+		t.Fatal("Update with a failing deploy succeeded")
+	}
+	if got := core.sent(); !slices.Contains(got, "DeployStack") || got[len(got)-1] != "UpdateStack" {
+		t.Errorf("requests = %v, want a deploy followed by restoring the config", got)
+	}
+	state = testRead(t, ctx, r, state)
+	if !state.FileContents.Equal(prior.FileContents) || !state.Environment.IsNull() {
+		t.Errorf("file_contents, environment = %s, %s after the failed deploy; want the prior %s, null", state.FileContents, state.Environment, prior.FileContents)
+	}
+
+	// The next apply deploys the change again.
+	core.failDeploys = false
+	state, diags = testUpdate(t, ctx, r, state, planned)
+	if diags.HasError() {
+		t.Fatalf("Update: %v", diags)
+	}
+	if got := core.sent(); !slices.Contains(got, "DeployStack") {
+		t.Errorf("requests = %v, want the change deployed again", got)
+	}
+	if !state.FileContents.Equal(planned.FileContents) || !state.Environment.Equal(planned.Environment) {
+		t.Errorf("file_contents, environment = %s, %s; want the planned ones", state.FileContents, state.Environment)
+	}
+
+	// Nothing is deployed without a change, or with deploy_on_change off.
+	if _, diags := testUpdate(t, ctx, r, state, state); diags.HasError() {
+		t.Fatalf("Update without a change: %v", diags)
+	}
+	off := planned
+	off.DeployOnChange = tftypes.BoolValue(false)
+	off.FileContents = tftypes.StringValue("services: {web: {image: nginx:1.28}}")
+	if _, diags := testUpdate(t, ctx, r, state, off); diags.HasError() {
+		t.Fatalf("Update with deploy_on_change off: %v", diags)
+	}
+	if got := core.sent(); slices.Contains(got, "DeployStack") {
+		t.Errorf("requests = %v, want no deploy", got)
+	}
+}
+
+func TestStackDeployWaitsForServer(t *testing.T) {
+	core, client := newFakeCore(t, map[string]any{"server_id": "srv1"})
+	r := &stackResource{client: client, serverLocks: newServerLocks()}
+
+	// Another resource is running something on the server.
+	unlock, err := r.serverLocks.lock(context.Background(), "srv1")
+	if err != nil {
+		t.Fatalf("locking server: %s", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stack := &komodo.Stack{ID: "s1", Name: "app", Config: komodo.StackConfig{ServerID: komodo.Ptr("srv1")}}
+	var diags diag.Diagnostics
+	if r.deploy(ctx, stack, time.Minute, &diags) {
+		t.Fatal("deploy succeeded while the server was locked")
+	}
+	if got := core.sent(); slices.Contains(got, "DeployStack") {
+		t.Errorf("requests = %v, want no deploy while the server is locked", got)
+	}
+}
@@ -0,0 +1,302 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"example.com/me/komodo-provider/internal/githost"
+)
+
+// syncRepositoryFile is the file the ResourceSetup sync reads from the sync
+// repository.
+const syncRepositoryFile = "resources.toml"
+
+const (
+	committerName  = "Terraform Provider"
+	committerEmail = "terraform@example.com"
+)
+
+// requireGitHost returns an error when the provider has no git host
+// configured, e.g. because no token was given.
+func (r *komodoResource) requireGitHost() error {
+	if r.gitHost == nil {
+		return fmt.Errorf("git credentials are not set. Please provide github_token (or the GITHUB_TOKEN environment variable) or GitHub App authentication in the provider configuration")
+	}
+	return nil
+}
+
+// repoOwner returns the account the sync repository lives under: the given
+// organization, or the authenticated user when orgname is empty. It fails
+// without a git host even when orgname is set, since every caller goes on to
+// use the host.
+func (r *komodoResource) repoOwner(ctx context.Context, orgname string) (string, error) {
+	if err := r.requireGitHost(); err != nil {
+		return "", err
+	}
+	if orgname != "" {
+		return orgname, nil
+	}
+
+	login, err := r.gitHost.CurrentUser(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get authenticated user: %v", err)
+	}
+	return login, nil
+}
+
+// createSyncRepository creates the <name>_syncresources repository, seeds it
+// with resources.toml and, if requested, generates SSH keys, uploads the
+// public key as a deploy key and embeds both keys in the file. It returns the
+// generated private and public keys.
+func (r *komodoResource) createSyncRepository(ctx context.Context, orgname, repoName string, fileContents string, generateSSHKeys bool) (string, string, error) {
+	// Sanitize the repository name and append "_syncresources"
+	sanitizedName := sanitizeRepoName(repoName) + "_syncresources"
+
+	if err := r.requireGitHost(); err != nil {
+		return "", "", err
+	}
+
+	// If org name is provided, create in that organization
+	// Otherwise, create in the authenticated user's account
+	repo, err := r.gitHost.CreateRepository(ctx, orgname, sanitizedName, githost.CreateRepositoryOptions{
+		Description: "Created by custom Terraform provider",
+		Private:     true,
+		AutoInit:    true, // Initialize with README so we have a main branch
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create repository: %v", err)
+	}
+
+	// Wait a moment for the repository to be fully initialized
+	if err := sleepContext(ctx, 2*time.Second); err != nil {
+		return "", "", err
+	}
+
+	repoOwner, err := r.repoOwner(ctx, orgname)
+	if err != nil {
+		return "", "", err
+	}
+
+	var privateKey, publicKey string
+
+	// Generate SSH key pair if requested
+	if generateSSHKeys {
+		privateKey, publicKey, err = r.generateSSHKeyPair()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate SSH key pair: %v", err)
+		}
+
+		// Upload the public key as a deploy key
+		deployKeyTitle := fmt.Sprintf("terraform-deploy-key-%d", time.Now().Unix())
+		err = r.uploadDeployKey(ctx, repoOwner, sanitizedName, publicKey, deployKeyTitle, false)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to upload deploy key: %v", err)
+		}
+	}
+
+	// If file contents are provided, create the file
+	if fileContents != "" {
+		updatedFileContents := fileContents
+
+		// Add SSH keys to the file contents if they were generated
+		if generateSSHKeys && privateKey != "" && publicKey != "" {
+			updatedFileContents = r.addSSHKeysToFileContents(fileContents, privateKey, publicKey)
+		}
+
+		commitMessage := "Add resources.toml via Terraform"
+		if generateSSHKeys && privateKey != "" && publicKey != "" {
+			commitMessage = "Add resources.toml with SSH keys via Terraform"
+		}
+
+		err = r.gitHost.PutFile(ctx, repoOwner, sanitizedName, syncRepositoryFile, githost.PutFileOptions{
+			Message:        commitMessage,
+			Content:        updatedFileContents,
+			Branch:         repo.DefaultBranch,
+			CommitterName:  committerName,
+			CommitterEmail: committerEmail,
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create file in repository: %v", err)
+		}
+	}
+
+	return privateKey, publicKey, nil
+}
+
+// getRepositoryFile returns the current contents of resources.toml in the
+// sync repository. found is false if the repository itself does not exist.
+func (r *komodoResource) getRepositoryFile(ctx context.Context, orgname, repoName string) (string, bool, error) {
+	sanitizedName := sanitizeRepoName(repoName) + "_syncresources"
+
+	owner, err := r.repoOwner(ctx, orgname)
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err := r.gitHost.GetRepository(ctx, owner, sanitizedName); err != nil {
+		if errors.Is(err, githost.ErrNotFound) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to get repository info: %v", err)
+	}
+
+	// The repository exists but resources.toml is only written when
+	// file_contents is set, so a missing file is an empty one.
+	file, err := r.gitHost.GetFile(ctx, owner, sanitizedName, syncRepositoryFile, "")
+	if err != nil {
+		if errors.Is(err, githost.ErrNotFound) {
+			return "", true, nil
+		}
+		return "", true, fmt.Errorf("failed to get resources.toml: %v", err)
+	}
+	return file.Content, true, nil
+}
+
+// deleteSyncRepository deletes the <name>_syncresources repository. A
+// repository that is already gone counts as deleted so a retried destroy can
+// finish.
+func (r *komodoResource) deleteSyncRepository(ctx context.Context, orgname, repoName string) error {
+	// Sanitize the repository name and append _syncresources
+	sanitizedName := sanitizeRepoName(repoName) + "_syncresources"
+
+	owner, err := r.repoOwner(ctx, orgname)
+	if err != nil {
+		return err
+	}
+
+	if err := r.gitHost.DeleteRepository(ctx, owner, sanitizedName); err != nil {
+		if errors.Is(err, githost.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete repository: %v", err)
+	}
+
+	return nil
+}
+
+// archiveSyncRepository archives the <name>_syncresources repository instead
+// of deleting it, keeping resources.toml and its history. A repository that
+// is already gone needs no archiving.
+func (r *komodoResource) archiveSyncRepository(ctx context.Context, orgname, repoName string) error {
+	sanitizedName := sanitizeRepoName(repoName) + "_syncresources"
+
+	owner, err := r.repoOwner(ctx, orgname)
+	if err != nil {
+		return err
+	}
+
+	if err := r.gitHost.ArchiveRepository(ctx, owner, sanitizedName); err != nil {
+		if errors.Is(err, githost.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to archive repository: %v", err)
+	}
+
+	return nil
+}
+
+// Helper function to sanitize repository names
+func sanitizeRepoName(name string) string {
+	// Replace spaces with hyphens
+	name = strings.ReplaceAll(name, " ", "-")
+
+	// Remove special characters
+	reg := regexp.MustCompile(`[^a-zA-Z0-9\-_.]`)
+	name = reg.ReplaceAllString(name, "")
+
+	// Convert to lowercase
+	name = strings.ToLower(name)
+
+	return name
+}
+
+// updateFileInRepository writes fileContents to resources.toml in the sync
+// repository. When generateSSHKeys is set it keeps the SSH keys already
+// embedded in the file, or else privateKey and publicKey from state, and only
+// generates new ones when there are neither. It returns the keys in use,
+// which are in the file as long as it has an environment section.
+func (r *komodoResource) updateFileInRepository(ctx context.Context, repoName, owner, fileContents string, generateSSHKeys bool, privateKey, publicKey string) (string, string, error) {
+	// Append _syncresources to the repo name
+	repoName = repoName + "_syncresources"
+
+	if err := r.requireGitHost(); err != nil {
+		return "", "", err
+	}
+
+	// Get the repository to determine the default branch
+	repo, err := r.gitHost.GetRepository(ctx, owner, repoName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get repository info: %v", err)
+	}
+
+	// Get the current file to get its SHA and extract existing SSH keys
+	existing, err := r.gitHost.GetFile(ctx, owner, repoName, syncRepositoryFile, repo.DefaultBranch)
+	if err != nil && !errors.Is(err, githost.ErrNotFound) {
+		return "", "", fmt.Errorf("failed to get resources.toml: %v", err)
+	}
+
+	updatedFileContents := fileContents
+
+	// Handle SSH keys based on the generateSSHKeys flag
+	if generateSSHKeys {
+		// Prefer the keys in the file, then the ones in state: a file
+		// without an environment section never holds keys, and generating
+		// new ones on every update would pile up deploy keys.
+		if existing != nil {
+			if filePrivateKey, filePublicKey := extractSSHKeysFromFileContents(existing.Content); filePrivateKey != "" && filePublicKey != "" {
+				privateKey, publicKey = restorePEMHeaders(filePrivateKey), filePublicKey
+			}
+		}
+
+		if privateKey == "" || publicKey == "" {
+			// Generate new SSH keys if none exist
+			privateKey, publicKey, err = r.generateSSHKeyPair()
+			if err != nil {
+				return "", "", fmt.Errorf("failed to generate SSH key pair: %v", err)
+			}
+
+			// Upload the new deploy key
+			deployKeyTitle := fmt.Sprintf("terraform-deploy-key-%d", time.Now().Unix())
+			err = r.uploadDeployKey(ctx, owner, repoName, publicKey, deployKeyTitle, false)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to upload deploy key: %v", err)
+			}
+		}
+
+		updatedFileContents = r.addSSHKeysToFileContents(fileContents, privateKey, publicKey)
+	} else {
+		privateKey, publicKey = "", ""
+	}
+
+	opts := githost.PutFileOptions{
+		Message:        "Update resources.toml via Terraform",
+		Content:        updatedFileContents,
+		Branch:         repo.DefaultBranch,
+		CommitterName:  committerName,
+		CommitterEmail: committerEmail,
+	}
+
+	// If the file exists, include its SHA
+	if existing != nil {
+		opts.SHA = existing.SHA
+	}
+
+	if err := r.gitHost.PutFile(ctx, owner, repoName, syncRepositoryFile, opts); err != nil {
+		return "", "", fmt.Errorf("failed to update file in repository: %v", err)
+	}
+
+	return privateKey, publicKey, nil
+}
+
+// uploadDeployKey uploads the public key as a deploy key to the sync repository
+func (r *komodoResource) uploadDeployKey(ctx context.Context, owner, repoName, publicKey, title string, readOnly bool) error {
+	if err := r.gitHost.AddDeployKey(ctx, owner, repoName, title, publicKey, readOnly); err != nil {
+		return fmt.Errorf("failed to upload deploy key: %v", err)
+	}
+
+	return nil
+}
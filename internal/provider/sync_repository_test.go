@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"example.com/me/komodo-provider/internal/githost"
+)
+
+// fakeGitHost is a githost.Host holding a single resources.toml in memory.
+type fakeGitHost struct {
+	githost.Host
+	file       *githost.File
+	deployKeys []string
+}
+
+func (h *fakeGitHost) GetRepository(ctx context.Context, owner, name string) (*githost.Repository, error) {
+	return &githost.Repository{Owner: owner, Name: name, DefaultBranch: "main"}, nil
+}
+
+func (h *fakeGitHost) GetFile(ctx context.Context, owner, repo, path, ref string) (*githost.File, error) {
+	if h.file == nil {
+		return nil, githost.ErrNotFound
+	}
+	return h.file, nil
+}
+
+func (h *fakeGitHost) PutFile(ctx context.Context, owner, repo, path string, opts githost.PutFileOptions) error {
+	h.file = &githost.File{Content: opts.Content, SHA: "sha-" + opts.Message}
+	return nil
+}
+
+func (h *fakeGitHost) AddDeployKey(ctx context.Context, owner, repo, title, key string, readOnly bool) error {
+	h.deployKeys = append(h.deployKeys, key)
+	return nil
+}
+
+func TestUpdateFileInRepositoryKeepsKeys(t *testing.T) {
+	r := &komodoResource{}
+	statePrivate, statePublic, err := r.generateSSHKeyPair()
+	if err != nil {
+		t.Fatalf("generating key pair: %s", err)
+	}
+	ctx := context.Background()
+
+	t.Run("no environment section", func(t *testing.T) {
+		host := &fakeGitHost{file: &githost.File{Content: "[[stack]]\nname = \"app\"\n", SHA: "abc"}}
+		r := &komodoResource{gitHost: host}
+
+		// Every update keeps the keys from state: there is nowhere in the
+		// file to read them back from, and no new deploy key is uploaded.
+		for _, contents := range []string{"[[stack]]\nname = \"app\"\n", "[[stack]]\nname = \"web\"\n"} {
+			privateKey, publicKey, err := r.updateFileInRepository(ctx, "acme", "acme", contents, true, statePrivate, statePublic)
+			if err != nil {
+				t.Fatalf("updateFileInRepository: %s", err)
+			}
+			if privateKey != statePrivate || publicKey != statePublic {
+				t.Errorf("keys changed on update of a file without an environment section")
+			}
+			if host.file.Content != contents {
+				t.Errorf("file = %q, want %q unchanged", host.file.Content, contents)
+			}
+		}
+		if len(host.deployKeys) != 0 {
+			t.Errorf("uploaded %d deploy keys, want none", len(host.deployKeys))
+		}
+	})
+
+	t.Run("environment section", func(t *testing.T) {
+		contents := "[[stack]]\n[stack.config]\nenvironment = \"\"\"\nPORT=8080\n\"\"\"\n"
+		host := &fakeGitHost{file: &githost.File{Content: r.addSSHKeysToFileContents(contents, statePrivate, statePublic), SHA: "abc"}}
+		r := &komodoResource{gitHost: host}
+
+		// The keys in the file win over state.
+		privateKey, publicKey, err := r.updateFileInRepository(ctx, "acme", "acme", contents, true, "", "")
+		if err != nil {
+			t.Fatalf("updateFileInRepository: %s", err)
+		}
+		if privateKey != statePrivate || publicKey != statePublic {
+			t.Errorf("keys embedded in the file were not kept")
+		}
+		if filePrivate, filePublic := extractSSHKeysFromFileContents(host.file.Content); restorePEMHeaders(filePrivate) != statePrivate || filePublic != statePublic {
+			t.Errorf("updated file does not embed the kept keys:\n%s", host.file.Content)
+		}
+		if len(host.deployKeys) != 0 {
+			t.Errorf("uploaded %d deploy keys, want none", len(host.deployKeys))
+		}
+	})
+
+	t.Run("no keys yet", func(t *testing.T) {
+		host := &fakeGitHost{}
+		r := &komodoResource{gitHost: host}
+
+		privateKey, publicKey, err := r.updateFileInRepository(ctx, "acme", "acme", "[[stack]]\n", true, "", "")
+		if err != nil {
+			t.Fatalf("updateFileInRepository: %s", err)
+		}
+		if privateKey == "" || len(host.deployKeys) != 1 || host.deployKeys[0] != publicKey {
+			t.Errorf("new keys were not generated and uploaded once: %d deploy keys", len(host.deployKeys))
+		}
+	})
+
+	t.Run("keys turned off", func(t *testing.T) {
+		host := &fakeGitHost{}
+		r := &komodoResource{gitHost: host}
+
+		privateKey, publicKey, err := r.updateFileInRepository(ctx, "acme", "acme", "[[stack]]\n", false, statePrivate, statePublic)
+		if err != nil {
+			t.Fatalf("updateFileInRepository: %s", err)
+		}
+		if privateKey != "" || publicKey != "" {
+			t.Error("keys returned with generate_ssh_keys off")
+		}
+	})
+}
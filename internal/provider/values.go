@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	tftypes "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Conversions between Terraform values and the pointer fields of the Komodo
+// partial config structs. A null or unknown value maps to nil, which leaves
+// the field unchanged in Komodo.
+
+func stringPtr(v tftypes.String) *string {
+	if v.IsNull() || v.IsUnknown() {
+		return nil
+	}
+	s := v.ValueString()
+	return &s
+}
+
+func boolPtr(v tftypes.Bool) *bool {
+	if v.IsNull() || v.IsUnknown() {
+		return nil
+	}
+	b := v.ValueBool()
+	return &b
+}
+
+func float64Ptr(v tftypes.Float64) *float64 {
+	if v.IsNull() || v.IsUnknown() {
+		return nil
+	}
+	f := v.ValueFloat64()
+	return &f
+}
+
+// stringsPtr returns the elements of a list of strings, or nil if the list
+// is null or unknown. An empty list gives a pointer to an empty slice, so it
+// clears the field.
+func stringsPtr(ctx context.Context, v tftypes.List) (*[]string, diag.Diagnostics) {
+	if v.IsNull() || v.IsUnknown() {
+		return nil, nil
+	}
+	out := []string{}
+	diags := v.ElementsAs(ctx, &out, false)
+	return &out, diags
+}
+
+// clearRemoved sets *field to empty when an optional attribute is null in the
+// plan but set in the prior state. A null attribute otherwise converts to nil,
+// which Komodo reads as "leave unchanged", so removing it from the
+// configuration would never clear it.
+func clearRemoved[T any](planned, prior attr.Value, field **T, empty T) {
+	if planned.IsNull() && !prior.IsNull() {
+		*field = &empty
+	}
+}
+
+// optionalString returns s as a value, keeping prior null when Komodo reports
+// the empty string for an attribute that was never set.
+func optionalString(prior tftypes.String, s string) tftypes.String {
+	if s == "" && prior.IsNull() {
+		return prior
+	}
+	return tftypes.StringValue(s)
+}
+
+// optionalStrings is optionalString for lists of strings.
+func optionalStrings(ctx context.Context, prior tftypes.List, s []string) (tftypes.List, diag.Diagnostics) {
+	if len(s) == 0 && prior.IsNull() {
+		return prior, nil
+	}
+	if s == nil {
+		s = []string{}
+	}
+	return tftypes.ListValueFrom(ctx, tftypes.StringType, s)
+}
+
+// resourceReference returns the value to keep in state for a reference to a
+// Komodo resource that Komodo reports as id. Komodo accepts a name where it
+// expects an id but hands back the id, so a configured name is kept as long
+// as lookup still resolves it to that id.
+func resourceReference(ctx context.Context, prior tftypes.String, id string, lookup func(ctx context.Context, nameOrID string) (string, error)) tftypes.String {
+	if id == "" && prior.IsNull() {
+		return prior
+	}
+	if prior.IsNull() || prior.IsUnknown() || prior.ValueString() == id {
+		return tftypes.StringValue(id)
+	}
+	if resolved, err := lookup(ctx, prior.ValueString()); err == nil && resolved == id {
+		return prior
+	}
+	return tftypes.StringValue(id)
+}
+
+// deref returns *p, or the zero value if p is nil.
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// waitForServerAvailability polls until serverName is known to Komodo, which
+// for a periphery that connects out to core means it has self-registered.
+func waitForServerAvailability(ctx context.Context, client *komodo.Client, serverName string, timeout, interval time.Duration) error {
+	err := pollUntil(ctx, timeout, interval, func(ctx context.Context) bool {
+		// If GetServer succeeds, the server exists in Komodo - periphery has
+		// connected and self-registered. In outbound mode, periphery connects
+		// to Core so no address is stored.
+		_, err := client.GetServer(ctx, serverName)
+		if err != nil {
+			tflog.SubsystemDebug(ctx, logSubsystem, "Waiting for server to register", map[string]any{"server": serverName, "error": err.Error()})
+		}
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("server %s did not become available: %w", serverName, err)
+	}
+	return nil
+}
+
+// waitForServerStateEnabled polls until serverName reports the OK state.
+func waitForServerStateEnabled(ctx context.Context, client *komodo.Client, serverName string, timeout, interval time.Duration) error {
+	err := pollUntil(ctx, timeout, interval, func(ctx context.Context) bool {
+		state, err := client.GetServerState(ctx, serverName)
+		if err != nil {
+			tflog.SubsystemDebug(ctx, logSubsystem, "Waiting for server to reach OK state", map[string]any{"server": serverName, "error": err.Error()})
+			return false
+		}
+		if state.Status != komodo.ServerStatusOk {
+			tflog.SubsystemDebug(ctx, logSubsystem, "Waiting for server to reach OK state", map[string]any{"server": serverName, "status": string(state.Status)})
+		}
+		return state.Status == komodo.ServerStatusOk
+	})
+	if err != nil {
+		return fmt.Errorf("server %s did not reach OK state: %w", serverName, err)
+	}
+	return nil
+}
+
+// waitForUpdate follows the Update returned by an execute call until Komodo
+// marks it complete. If the execution failed, the returned error carries the
+// logs of the failed stages.
+func waitForUpdate(ctx context.Context, client *komodo.Client, update *komodo.Update, timeout time.Duration) error {
+	if update == nil || update.ID == "" {
+		return nil
+	}
+
+	fields := map[string]any{
+		"operation": update.Operation,
+		"target":    update.Target.ID,
+		"update_id": update.ID.String(),
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "Waiting for execution to complete", fields)
+
+	current := update
+	var lookupErr error
+	err := pollUntil(ctx, timeout, 2*time.Second, func(ctx context.Context) bool {
+		if current.Status == komodo.UpdateStatusComplete {
+			return true
+		}
+		// The client has already retried whatever its retry policy allows, so
+		// a failed lookup (e.g. a rejected key or a deleted update) is final.
+		next, err := client.GetUpdate(ctx, update.ID.String())
+		if err != nil {
+			if ctx.Err() != nil {
+				// Let pollUntil report the timeout or cancellation.
+				return false
+			}
+			lookupErr = err
+			return true
+		}
+		current = next
+		return current.Status == komodo.UpdateStatusComplete
+	})
+	if lookupErr != nil {
+		tflog.SubsystemWarn(ctx, logSubsystem, "Execution status could not be read", fields)
+		return fmt.Errorf("reading the status of %s: %w", update.Operation, lookupErr)
+	}
+	if err != nil {
+		tflog.SubsystemWarn(ctx, logSubsystem, "Execution did not complete", fields)
+		return fmt.Errorf("%s did not complete: %w", update.Operation, err)
+	}
+	fields["success"] = current.Success
+	tflog.SubsystemDebug(ctx, logSubsystem, "Execution completed", fields)
+	return current.Err()
+}
+
+// pollUntil calls check every interval until it returns true. It gives up
+// once timeout has elapsed, or as soon as ctx is cancelled.
+func pollUntil(ctx context.Context, timeout, interval time.Duration, check func(ctx context.Context) bool) error {
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		if check(pollCtx) {
+			return nil
+		}
+		if err := sleepContext(pollCtx, interval); err != nil {
+			// Report the caller's cancellation as is; our own deadline
+			// expiring is a plain timeout.
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+}
+
+// sleepContext sleeps for d, returning early with ctx.Err() if ctx is
+// cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
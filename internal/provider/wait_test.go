@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/me/komodo-provider/internal/komodo"
+)
+
+func TestWaitForUpdateStopsOnLookupError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error":"invalid api key"}`},
+		{"forbidden", http.StatusForbidden, `{"error":"user does not have permission"}`},
+		{"not found", http.StatusInternalServerError, `{"error":"did not find any update matching 6650f1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				http.Error(w, tt.body, tt.status)
+			}))
+			defer server.Close()
+			client := komodo.NewClient(server.URL, "key", "secret", server.Client())
+
+			update := &komodo.Update{ID: "6650f1", Operation: "RunProcedure", Status: komodo.UpdateStatusInProgress}
+			start := time.Now()
+			err := waitForUpdate(context.Background(), client, update, time.Minute)
+			if err == nil {
+				t.Fatal("waitForUpdate succeeded")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("waitForUpdate took %s, want an immediate error", elapsed)
+			}
+			if got := requests.Load(); got != 1 {
+				t.Errorf("core saw %d GetUpdate requests, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Package ratelimit throttles the HTTP requests the provider sends to a
+// single service, so that many resources applied in parallel do not trip
+// Komodo's "busy" errors or GitHub's secondary rate limits.
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter bounds both the request rate and the number of requests in flight.
+// It is safe for concurrent use; one Limiter should be shared by everything
+// talking to the same service.
+type Limiter struct {
+	// interval is the minimum spacing between request starts; zero means
+	// no rate limit.
+	interval time.Duration
+	// slots holds one token per request allowed in flight; nil means no
+	// concurrency limit.
+	slots chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// New returns a Limiter allowing requestsPerSecond request starts per second
+// and maxInFlight concurrent requests. A value <= 0 disables that limit.
+func New(requestsPerSecond float64, maxInFlight int) *Limiter {
+	l := &Limiter{}
+	if requestsPerSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	if maxInFlight > 0 {
+		l.slots = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// Acquire waits for an in-flight slot and for the request's turn under the
+// rate limit. Every successful Acquire must be paired with a Release.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		l.Release()
+		return err
+	}
+	return nil
+}
+
+// Release frees the slot taken by Acquire.
+func (l *Limiter) Release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// wait reserves the next start time and sleeps until it.
+func (l *Limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Transport wraps base so every request goes through the limiter. The slot
+// is held until the response body has been closed.
+func (l *Limiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{limiter: l, base: base}
+}
+
+type transport struct {
+	limiter *Limiter
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.limiter.Release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: t.limiter.Release}
+	return resp, nil
+}
+
+// releaseOnClose releases a limiter slot once, when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func okResponse(*http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+}
+
+func newRequest(t *testing.T, ctx context.Context) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://komodo/read", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestTransportHoldsSlotUntilBodyClosed(t *testing.T) {
+	transport := New(0, 1).Transport(roundTripFunc(okResponse))
+
+	resp, err := transport.RoundTrip(newRequest(t, context.Background()))
+	if err != nil {
+		t.Fatalf("first request: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(newRequest(t, ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second request with the body still open = %v, want a deadline error", err)
+	}
+
+	resp.Body.Close()
+	resp.Body.Close() // a second Close must not free a slot it does not hold
+	resp, err = transport.RoundTrip(newRequest(t, context.Background()))
+	if err != nil {
+		t.Fatalf("request after closing the body: %s", err)
+	}
+	defer resp.Body.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(newRequest(t, ctx)); err == nil {
+		t.Fatal("double Close released an extra slot")
+	}
+}
+
+func TestTransportReleasesSlotOnError(t *testing.T) {
+	failing := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	transport := New(0, 1).Transport(failing)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := transport.RoundTrip(newRequest(t, ctx))
+		cancel()
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("request %d = %v, want the transport error", i+1, err)
+		}
+	}
+}
+
+func TestTransportLimitsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	slow := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+		return okResponse(req)
+	})
+	transport := New(0, 2).Transport(slow)
+
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			resp, err := transport.RoundTrip(newRequest(t, context.Background()))
+			if err == nil {
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("request failed: %s", err)
+		}
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("%d requests in flight, want at most 2", got)
+	}
+}
+
+func TestLimiterSpacesRequests(t *testing.T) {
+	limiter := New(50, 0) // one start every 20ms
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Acquire(context.Background()); err != nil {
+			t.Fatalf("Acquire: %s", err)
+		}
+		limiter.Release()
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 requests at 50/s took %s, want at least 60ms", elapsed)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	limiter := New(0, 0)
+	for i := 0; i < 100; i++ {
+		if err := limiter.Acquire(context.Background()); err != nil {
+			t.Fatalf("Acquire: %s", err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		limiter.Release()
+	}
+}
+
+func TestLimiterAcquireCancelled(t *testing.T) {
+	limiter := New(1, 0)
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("first Acquire: %s", err)
+	}
+	limiter.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire waiting for its turn after cancel = %v, want context.Canceled", err)
+	}
+}